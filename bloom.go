@@ -0,0 +1,103 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// BloomByteLength is the size of the logs bloom filter of blocks and receipts.
+const BloomByteLength = 256
+
+// Bloom is the 2048 bits bloom filter of the addresses and topics of logs found in blocks
+// and receipts. A bloom can tell for sure that an address or topic is not part of the logs,
+// but only that it might be.
+type Bloom [BloomByteLength]byte
+
+// NewBloom returns the bloom filter held by `data`, as found in `Block.LogsBloom`.
+func NewBloom(data []byte) (out Bloom, err error) {
+	if len(data) != BloomByteLength {
+		return out, fmt.Errorf("invalid bloom length, expected %d bytes, got %d", BloomByteLength, len(data))
+	}
+
+	copy(out[:], data)
+	return out, nil
+}
+
+// Add adds `value`, a log's address or one of its topics, to the filter.
+func (b *Bloom) Add(value []byte) {
+	for _, bit := range bloomBits(value) {
+		b[BloomByteLength-1-bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Test returns `false` if `value`, an address or a topic, is not part of the filter, `true`
+// if it might be.
+func (b *Bloom) Test(value []byte) bool {
+	for _, bit := range bloomBits(value) {
+		if b[BloomByteLength-1-bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// AddLog adds the log's address and topics to the filter.
+func (b *Bloom) AddLog(log *Log) {
+	b.Add(log.Address)
+	for _, topic := range log.Topics {
+		b.Add(topic)
+	}
+}
+
+// Merge adds all the values of `other` to the filter.
+func (b *Bloom) Merge(other Bloom) {
+	for i := range b {
+		b[i] |= other[i]
+	}
+}
+
+func (b Bloom) Bytes() []byte {
+	return b[:]
+}
+
+func (b Bloom) String() string {
+	return hex.EncodeToString(b[:])
+}
+
+func (b Bloom) MarshalText() ([]byte, error) {
+	return []byte("0x" + hex.EncodeToString(b[:])), nil
+}
+
+func (b *Bloom) UnmarshalText(text []byte) error {
+	data, err := NewHex(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid bloom: %w", err)
+	}
+
+	*b, err = NewBloom(data)
+	return err
+}
+
+// bloomBits returns the 3 bits set by `value`, each taken from the low 11 bits of the first 3
+// pairs of bytes of the value's Keccak-256 hash.
+func bloomBits(value []byte) (out [3]uint) {
+	hash := Keccak256(value)
+	for i := range out {
+		out[i] = (uint(hash[2*i])<<8 | uint(hash[2*i+1])) & 2047
+	}
+	return
+}
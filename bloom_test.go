@@ -0,0 +1,53 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloom(t *testing.T) {
+	address := MustNewAddress("0x5a0b54d5dc17e0aadc383d2db43b0a0d3e029c4c")
+	topic := MustNewHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	other := MustNewAddress("0x7a250d5630b4cf539739df2c5dacb4c659f2488d")
+
+	var bloom Bloom
+	assert.False(t, bloom.Test(address))
+
+	bloom.Add(address)
+	assert.True(t, bloom.Test(address))
+	assert.False(t, bloom.Test(topic))
+
+	var topicBloom Bloom
+	topicBloom.Add(topic)
+	bloom.Merge(topicBloom)
+	assert.True(t, bloom.Test(address))
+	assert.True(t, bloom.Test(topic))
+	assert.False(t, bloom.Test(other))
+
+	data, err := json.Marshal(bloom)
+	require.NoError(t, err)
+
+	var decoded Bloom
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, bloom, decoded)
+
+	_, err = NewBloom([]byte{0x01})
+	assert.Error(t, err)
+}
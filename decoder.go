@@ -204,6 +204,28 @@ func (d *Decoder) read(typeName string) (out interface{}, err error) {
 		return v, nil
 	case "uint72", "uint80", "uint88", "uint96", "uint104", "uint112", "uint120", "uint128", "uint136", "uint144", "uint152", "uint160", "uint168", "uint176", "uint184", "uint192", "uint200", "uint208", "uint216", "uint224", "uint232", "uint240", "uint248", "uint256":
 		return d.ReadBigInt()
+	case "int8":
+		v, err := d.ReadInt64()
+		if err != nil {
+			return nil, err
+		}
+		return int8(v), nil
+	case "int16":
+		v, err := d.ReadInt64()
+		if err != nil {
+			return nil, err
+		}
+		return int16(v), nil
+	case "int24", "int32":
+		v, err := d.ReadInt64()
+		if err != nil {
+			return nil, err
+		}
+		return int32(v), nil
+	case "int40", "int48", "int56", "int64":
+		return d.ReadInt64()
+	case "int72", "int80", "int88", "int96", "int104", "int112", "int120", "int128", "int136", "int144", "int152", "int160", "int168", "int176", "int184", "int192", "int200", "int208", "int216", "int224", "int232", "int240", "int248", "int256":
+		return d.ReadSignedBigInt()
 	case "method":
 		return d.ReadMethod()
 	case "address":
@@ -312,6 +334,24 @@ func (d *Decoder) ReadBigInt() (out *big.Int, err error) {
 	return new(big.Int).SetBytes(data[:]), nil
 }
 
+// ReadInt64 reads a two's complement signed integer, the value is truncated to its lower 64 bits.
+func (d *Decoder) ReadInt64() (out int64, err error) {
+	data, err := d.ReadBuffer(32)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(data[24:])), nil
+}
+
+// ReadSignedBigInt reads a 256 bits two's complement signed integer.
+func (d *Decoder) ReadSignedBigInt() (out *big.Int, err error) {
+	data, err := d.ReadBuffer(32)
+	if err != nil {
+		return nil, err
+	}
+	return fromTwosComplement(new(big.Int).SetBytes(data)), nil
+}
+
 func (d *Decoder) ReadBuffer(byteCount uint64) ([]byte, error) {
 	if tracer.Enabled() {
 		zlog.Debug("trying to read bytes", zap.Uint64("byte_count", byteCount), zap.Uint64("remaining", d.total-d.offset))
@@ -349,6 +389,16 @@ func newArray(typeName string, count uint64) (decodedArray, error) {
 		return Uint64Array(make([]uint64, count)), nil
 	case "uint72", "uint80", "uint88", "uint96", "uint104", "uint112", "uint120", "uint128", "uint136", "uint144", "uint152", "uint160", "uint168", "uint176", "uint184", "uint192", "uint200", "uint208", "uint216", "uint224", "uint232", "uint240", "uint248", "uint256":
 		return BigIntArray(make([]*big.Int, count)), nil
+	case "int8":
+		return Int8Array(make([]int8, count)), nil
+	case "int16":
+		return Int16Array(make([]int16, count)), nil
+	case "int24", "int32":
+		return Int32Array(make([]int32, count)), nil
+	case "int40", "int48", "int56", "int64":
+		return Int64Array(make([]int64, count)), nil
+	case "int72", "int80", "int88", "int96", "int104", "int112", "int120", "int128", "int136", "int144", "int152", "int160", "int168", "int176", "int184", "int192", "int200", "int208", "int216", "int224", "int232", "int240", "int248", "int256":
+		return BigIntArray(make([]*big.Int, count)), nil
 	case "address":
 		return AddressArray(make([]Address, count)), nil
 	case "string":
@@ -405,3 +455,27 @@ type Uint64Array []uint64
 func (a Uint64Array) At(index uint64, value interface{}) {
 	([]uint64)(a)[index] = value.(uint64)
 }
+
+type Int8Array []int8
+
+func (a Int8Array) At(index uint64, value interface{}) {
+	([]int8)(a)[index] = value.(int8)
+}
+
+type Int16Array []int16
+
+func (a Int16Array) At(index uint64, value interface{}) {
+	([]int16)(a)[index] = value.(int16)
+}
+
+type Int32Array []int32
+
+func (a Int32Array) At(index uint64, value interface{}) {
+	([]int32)(a)[index] = value.(int32)
+}
+
+type Int64Array []int64
+
+func (a Int64Array) At(index uint64, value interface{}) {
+	([]int64)(a)[index] = value.(int64)
+}
@@ -51,6 +51,30 @@ func TestDecoder_Read(t *testing.T) {
 			in:        "0x0000000000000000000000000000000000000000000000000000000000000007",
 			expectOut: uint8(7),
 		},
+		{
+			name:      "int8 negative",
+			typeName:  "int8",
+			in:        "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff80",
+			expectOut: int8(-128),
+		},
+		{
+			name:      "int64 negative",
+			typeName:  "int64",
+			in:        "0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe",
+			expectOut: int64(-2),
+		},
+		{
+			name:      "int256 negative",
+			typeName:  "int256",
+			in:        "0x8000000000000000000000000000000000000000000000000000000000000000",
+			expectOut: new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 255)),
+		},
+		{
+			name:      "int256 positive",
+			typeName:  "int256",
+			in:        "0x000000000000000000000000000000000000000000000000000000000000002a",
+			expectOut: big.NewInt(42),
+		},
 		{
 			name:      "uint24",
 			typeName:  "uint24",
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"math/big"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"go.uber.org/zap"
@@ -228,13 +229,16 @@ func (e *Encoder) writeElement(typeName string, components []*StructComponent, i
 	case "uint64":
 		d, err = e.encodeUintFromInterface(in, 64)
 	case "uint72", "uint80", "uint88", "uint96", "uint104", "uint112", "uint120", "uint128", "uint136", "uint144", "uint152", "uint160", "uint168", "uint176", "uint184", "uint192", "uint200", "uint208", "uint216", "uint224", "uint232", "uint240", "uint248", "uint256":
-		switch v := in.(type) {
-		case big.Int:
-			d, err = e.encodeBigInt(&v)
-		case *big.Int:
-			d, err = e.encodeBigInt(v)
-		default:
-			err = fmt.Errorf("type %q input should be big.Int or *big.Int, got %T", typeName, v)
+		var v *big.Int
+		v, err = bigIntFromInterface(typeName, in)
+		if err == nil {
+			d, err = e.encodeBigUint(v, typeBitSize(typeName, "uint"))
+		}
+	case "int8", "int16", "int24", "int32", "int40", "int48", "int56", "int64", "int72", "int80", "int88", "int96", "int104", "int112", "int120", "int128", "int136", "int144", "int152", "int160", "int168", "int176", "int184", "int192", "int200", "int208", "int216", "int224", "int232", "int240", "int248", "int256":
+		var v *big.Int
+		v, err = bigIntFromInterface(typeName, in)
+		if err == nil {
+			d, err = e.encodeBigSignedInt(v, typeBitSize(typeName, "int"))
 		}
 
 	case "method":
@@ -402,13 +406,19 @@ func (e *Encoder) encodeUintFromInterface(input interface{}, size uint64) ([]byt
 	case Uint64:
 		return e.encodeUint(uint64(v), size)
 	case *big.Int:
-		return e.encodeUint(v.Uint64(), size)
+		return e.encodeBigUint(v, size)
+	case *Uint256:
+		return e.encodeBigUint((*big.Int)(v), size)
 	default:
 		return nil, fmt.Errorf("unsupported uint from type %T", input)
 	}
 }
 
 func (e *Encoder) encodeUint(input uint64, size uint64) ([]byte, error) {
+	if size < 64 && input>>size != 0 {
+		return nil, fmt.Errorf("value %d overflows uint%d", input, size)
+	}
+
 	byteCount := size / 8
 	buf := make([]byte, byteCount)
 	_ = buf[byteCount-1] // early bounds check to guarantee safety of writes below
@@ -424,6 +434,81 @@ func (e *Encoder) encodeBigInt(input *big.Int) ([]byte, error) {
 	return pad(input.Bytes()), nil
 }
 
+func (e *Encoder) encodeBigUint(input *big.Int, size uint64) ([]byte, error) {
+	if input.Sign() < 0 {
+		return nil, fmt.Errorf("value %s is negative, uint%d expected", input, size)
+	}
+
+	if uint64(input.BitLen()) > size {
+		return nil, fmt.Errorf("value %s overflows uint%d", input, size)
+	}
+
+	return e.encodeBigInt(input)
+}
+
+// encodeBigSignedInt encodes `input` in two's complement, sign extended to 256 bits.
+func (e *Encoder) encodeBigSignedInt(input *big.Int, size uint64) ([]byte, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(size-1))
+	if input.Cmp(new(big.Int).Neg(limit)) < 0 || input.Cmp(limit) >= 0 {
+		return nil, fmt.Errorf("value %s overflows int%d", input, size)
+	}
+
+	out := make([]byte, 32)
+	toTwosComplement(input).FillBytes(out)
+
+	return out, nil
+}
+
+// bigIntFromInterface converts the accepted Go inputs of an integer ABI type into a `big.Int`.
+func bigIntFromInterface(typeName string, in interface{}) (*big.Int, error) {
+	switch v := in.(type) {
+	case big.Int:
+		return &v, nil
+	case *big.Int:
+		return v, nil
+	case Uint256:
+		return (*big.Int)(&v), nil
+	case *Uint256:
+		return (*big.Int)(v), nil
+	case Int256:
+		return (*big.Int)(&v), nil
+	case *Int256:
+		return (*big.Int)(v), nil
+	case int:
+		return big.NewInt(int64(v)), nil
+	case int8:
+		return big.NewInt(int64(v)), nil
+	case int16:
+		return big.NewInt(int64(v)), nil
+	case int32:
+		return big.NewInt(int64(v)), nil
+	case int64:
+		return big.NewInt(v), nil
+	case uint8:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	case uint16:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	case uint32:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	case uint64:
+		return new(big.Int).SetUint64(v), nil
+	case Uint64:
+		return new(big.Int).SetUint64(uint64(v)), nil
+	default:
+		return nil, fmt.Errorf("type %q input should be an integer, big.Int, Uint256 or Int256, got %T", typeName, v)
+	}
+}
+
+// typeBitSize returns the bit size of an integer ABI type like `uint128` or `int256`.
+func typeBitSize(typeName string, prefix string) uint64 {
+	size, err := strconv.ParseUint(strings.TrimPrefix(typeName, prefix), 10, 16)
+	if err != nil {
+		return 256
+	}
+
+	return size
+}
+
 func (e *Encoder) encodeBool(input bool) ([]byte, error) {
 	var v *big.Int
 	if input {
@@ -148,6 +148,63 @@ func TestEncoder_Write(t *testing.T) {
 				0x00, 0x08, 0x3c, 0x12, 0x82, 0x6f, 0xe2, 0x3b,
 			},
 		},
+		{
+			name:     "uint256 from Uint256",
+			typeName: "uint256",
+			in:       NewUint256FromUint64(2938),
+			expectBytes: []byte{
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0b, 0x7a,
+			},
+		},
+		{
+			name:        "uint256 negative",
+			typeName:    "uint256",
+			in:          big.NewInt(-1),
+			expectError: true,
+		},
+		{
+			name:        "uint128 overflow",
+			typeName:    "uint128",
+			in:          new(big.Int).Lsh(big.NewInt(1), 128),
+			expectError: true,
+		},
+		{
+			name:        "uint8 overflow",
+			typeName:    "uint8",
+			in:          uint64(256),
+			expectError: true,
+		},
+		{
+			name:     "int256 negative",
+			typeName: "int256",
+			in:       NewInt256FromInt64(-2),
+			expectBytes: []byte{
+				0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+				0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+				0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+				0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe,
+			},
+		},
+		{
+			name:     "int8 positive",
+			typeName: "int8",
+			in:       int8(127),
+			expectBytes: []byte{
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x7f,
+			},
+		},
+		{
+			name:        "int8 overflow",
+			typeName:    "int8",
+			in:          128,
+			expectError: true,
+		},
 		{
 			name:     "address",
 			typeName: "address",
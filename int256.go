@@ -0,0 +1,231 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Int256 is a signed 256 bits integer backed by a `big.Int`, read and written as a JSON-RPC
+// quantity prefixed by `-` when negative (e.g. `"-0x2a"`), decimal strings and JSON numbers
+// are also accepted when reading.
+//
+// Like `Uint256`, the arithmetic methods never modify their receiver and report when the
+// result does not fit in 256 bits, in which case the result is wrapped around in two's
+// complement like the EVM does.
+type Int256 big.Int
+
+// NewInt256 returns a copy of `value` as an `Int256`, it's the caller's responsibility to
+// ensure `value` fits in 256 bits, use `NewInt256FromBig` when unsure.
+func NewInt256(value *big.Int) *Int256 {
+	return (*Int256)(new(big.Int).Set(value))
+}
+
+// NewInt256FromBig returns a copy of `value` as an `Int256`, failing if it overflows 256 bits.
+func NewInt256FromBig(value *big.Int) (*Int256, error) {
+	if value.Cmp(minInt256) < 0 || value.Cmp(maxInt256) > 0 {
+		return nil, fmt.Errorf("invalid int256 number %s: overflows 256 bits", value)
+	}
+
+	return NewInt256(value), nil
+}
+
+func NewInt256FromInt64(value int64) *Int256 {
+	return (*Int256)(big.NewInt(value))
+}
+
+// ParseInt256 parses a hexadecimal (`0x` prefixed) or decimal string, optionally prefixed by a
+// sign, into an `Int256`.
+func ParseInt256(text string) (*Int256, error) {
+	value, err := parseInt256(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*Int256)(value), nil
+}
+
+// MustParseInt256 is like `ParseInt256` but panics on error.
+func MustParseInt256(text string) *Int256 {
+	value, err := ParseInt256(text)
+	if err != nil {
+		panic(err)
+	}
+
+	return value
+}
+
+// Int returns a copy of the value as a `big.Int`, `nil` if the receiver is `nil`.
+func (i *Int256) Int() *big.Int {
+	if i == nil {
+		return nil
+	}
+
+	return new(big.Int).Set((*big.Int)(i))
+}
+
+// Int64 returns the value as an `int64`, `ok` is `false` if it does not fit in 64 bits.
+func (i *Int256) Int64() (value int64, ok bool) {
+	v := (*big.Int)(i)
+	return v.Int64(), v.IsInt64()
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of the value.
+func (i *Int256) Sign() int {
+	return (*big.Int)(i).Sign()
+}
+
+// Cmp compares `i` and `other` and returns -1, 0 or +1 like `big.Int.Cmp`.
+func (i *Int256) Cmp(other *Int256) int {
+	return (*big.Int)(i).Cmp((*big.Int)(other))
+}
+
+// Neg returns `-i`, `overflow` is `true` for the minimum value, which has no positive counterpart.
+func (i *Int256) Neg() (out *Int256, overflow bool) {
+	return wrapInt256(new(big.Int).Neg((*big.Int)(i)))
+}
+
+// Add returns `i + other`, `overflow` is `true` if the sum overflowed 256 bits.
+func (i *Int256) Add(other *Int256) (out *Int256, overflow bool) {
+	return wrapInt256(new(big.Int).Add((*big.Int)(i), (*big.Int)(other)))
+}
+
+// Sub returns `i - other`, `overflow` is `true` if the difference overflowed 256 bits.
+func (i *Int256) Sub(other *Int256) (out *Int256, overflow bool) {
+	return wrapInt256(new(big.Int).Sub((*big.Int)(i), (*big.Int)(other)))
+}
+
+// Mul returns `i * other`, `overflow` is `true` if the product overflowed 256 bits.
+func (i *Int256) Mul(other *Int256) (out *Int256, overflow bool) {
+	return wrapInt256(new(big.Int).Mul((*big.Int)(i), (*big.Int)(other)))
+}
+
+// Quo returns `i / other` truncated towards zero like the EVM's `SDIV`, division by zero
+// returns zero.
+func (i *Int256) Quo(other *Int256) (out *Int256, overflow bool) {
+	if other.Sign() == 0 {
+		return new(Int256), false
+	}
+
+	return wrapInt256(new(big.Int).Quo((*big.Int)(i), (*big.Int)(other)))
+}
+
+func wrapInt256(value *big.Int) (out *Int256, overflow bool) {
+	if value.Cmp(minInt256) >= 0 && value.Cmp(maxInt256) <= 0 {
+		return (*Int256)(value), false
+	}
+
+	return (*Int256)(fromTwosComplement(toTwosComplement(value))), true
+}
+
+// Bytes32 returns the big-endian 32 bytes two's complement representation of the value.
+func (i *Int256) Bytes32() (out [32]byte) {
+	toTwosComplement((*big.Int)(i)).FillBytes(out[:])
+	return
+}
+
+// toTwosComplement returns the 256 bits two's complement representation of `value` as an
+// unsigned number, values outside of the int256 range are truncated to their lower 256 bits.
+func toTwosComplement(value *big.Int) *big.Int {
+	return new(big.Int).And(value, maxUint256)
+}
+
+// fromTwosComplement reads the unsigned 256 bits two's complement representation `value`
+// back as a signed number.
+func fromTwosComplement(value *big.Int) *big.Int {
+	if value.Cmp(maxInt256) <= 0 {
+		return value
+	}
+
+	return new(big.Int).Sub(value, new(big.Int).Add(maxUint256, big.NewInt(1)))
+}
+
+func (i *Int256) String() string {
+	if i == nil {
+		return "<nil>"
+	}
+
+	return (*big.Int)(i).String()
+}
+
+func (i *Int256) MarshalText() ([]byte, error) {
+	return []byte(i.quantity()), nil
+}
+
+func (i *Int256) MarshalJSONRPC() ([]byte, error) {
+	return []byte(`"` + i.quantity() + `"`), nil
+}
+
+func (i *Int256) quantity() string {
+	v := (*big.Int)(i)
+	if v.Sign() < 0 {
+		return "-0x" + new(big.Int).Neg(v).Text(16)
+	}
+
+	return "0x" + v.Text(16)
+}
+
+func (i *Int256) UnmarshalText(text []byte) error {
+	value, err := parseInt256(string(text))
+	if err != nil {
+		return err
+	}
+
+	*i = Int256(*value)
+	return nil
+}
+
+// UnmarshalJSON accepts JSON strings as well as JSON numbers.
+func (i *Int256) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	return i.UnmarshalText(bytes.Trim(data, `"`))
+}
+
+func parseInt256(text string) (*big.Int, error) {
+	negative := false
+	unsigned := text
+	if strings.HasPrefix(unsigned, "-") {
+		negative = true
+		unsigned = unsigned[1:]
+	} else if strings.HasPrefix(unsigned, "+") {
+		unsigned = unsigned[1:]
+	}
+
+	if strings.HasPrefix(unsigned, "-") || strings.HasPrefix(unsigned, "+") {
+		return nil, fmt.Errorf("invalid int256 number %q", text)
+	}
+
+	// The unsigned part of the minimum value overflows 255 bits, so we parse it as an uint256 first
+	value, err := parseUint256(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("invalid int256 number %q: %w", text, err)
+	}
+
+	if negative {
+		value.Neg(value)
+	}
+
+	if value.Cmp(minInt256) < 0 || value.Cmp(maxInt256) > 0 {
+		return nil, fmt.Errorf("invalid int256 number %q: overflows 256 bits", text)
+	}
+
+	return value, nil
+}
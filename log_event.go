@@ -65,7 +65,7 @@ func (l *LogEventDef) Signature() string {
 		args = append(args, parameter.TypeName)
 	}
 
-	return fmt.Sprintf("%s(%s)", l.Name, strings.Join(args, ", "))
+	return fmt.Sprintf("%s(%s)", l.Name, strings.Join(args, ","))
 }
 
 func (l *LogEventDef) String() string {
@@ -0,0 +1,61 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogEventDef_LogID(t *testing.T) {
+	tests := []struct {
+		name            string
+		event           *LogEventDef
+		expectSignature string
+		expectLogID     string
+	}{
+		{
+			name: "single parameter",
+			event: &LogEventDef{
+				Name:       "PairCreated",
+				Parameters: []*LogParameter{{Name: "token0", TypeName: "address", Indexed: true}},
+			},
+			expectSignature: "PairCreated(address)",
+			expectLogID:     "b14a725aeeb25d591b81b16b4c5b25403dd8867bdd1876fa787867f566206be1",
+		},
+		{
+			name: "erc20 transfer",
+			event: &LogEventDef{
+				Name: "Transfer",
+				Parameters: []*LogParameter{
+					{Name: "from", TypeName: "address", Indexed: true},
+					{Name: "to", TypeName: "address", Indexed: true},
+					{Name: "value", TypeName: "uint256"},
+				},
+			},
+			expectSignature: "Transfer(address,address,uint256)",
+			expectLogID:     "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expectSignature, test.event.Signature())
+			assert.Equal(t, test.expectLogID, hex.EncodeToString(test.event.logID()))
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rlp
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// RawValue is an already RLP encoded value, it's written as-is when encoded as part of
+// another value, which is how nested structures are embedded without being re-encoded.
+type RawValue []byte
+
+var rawValueType = reflect.TypeOf(RawValue{})
+
+type Kind uint8
+
+const (
+	KindString Kind = iota
+	KindList
+)
+
+func (k Kind) String() string {
+	if k == KindList {
+		return "list"
+	}
+	return "string"
+}
+
+// Split reads the first RLP value of `input`, returning its kind, its content (the string's
+// bytes or the list's encoded elements) and the remaining bytes following it.
+func Split(input []byte) (kind Kind, content []byte, rest []byte, err error) {
+	if len(input) == 0 {
+		return 0, nil, nil, ErrNoInput
+	}
+
+	// Long strings and lists have their length prefixed by the length of their length
+	var lengthOfLength int
+	switch prefix := magicOffset(input[0]); {
+	case prefix > StringOffset+ShortLength && prefix < SliceOffset:
+		lengthOfLength = int(prefix - StringOffset - ShortLength)
+	case prefix > SliceOffset+ShortLength:
+		lengthOfLength = int(prefix - SliceOffset - ShortLength)
+	}
+
+	if len(input) < 1+lengthOfLength {
+		return 0, nil, nil, fmt.Errorf("read length prefix of %d bytes: %w", lengthOfLength, ErrInvalid)
+	}
+
+	offset, length, typ := decodeLength(input)
+	end := offset + length
+	if end < offset || end > uint64(len(input)) {
+		return 0, nil, nil, fmt.Errorf("value of %d bytes exceeds the %d bytes of input: %w", length, uint64(len(input))-offset, ErrInvalid)
+	}
+
+	kind = KindString
+	if typ == reflect.Slice {
+		kind = KindList
+	}
+
+	return kind, input[offset:end], input[end:], nil
+}
+
+// SplitString reads the first RLP value of `input` which must be a string.
+func SplitString(input []byte) (content []byte, rest []byte, err error) {
+	kind, content, rest, err := Split(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if kind != KindString {
+		return nil, nil, fmt.Errorf("expected string, got %s: %w", kind, ErrInvalid)
+	}
+
+	return content, rest, nil
+}
+
+// SplitList reads the first RLP value of `input` which must be a list, its elements are returned
+// still RLP encoded.
+func SplitList(input []byte) (elements []RawValue, rest []byte, err error) {
+	kind, content, rest, err := Split(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if kind != KindList {
+		return nil, nil, fmt.Errorf("expected list, got %s: %w", kind, ErrInvalid)
+	}
+
+	for len(content) > 0 {
+		_, _, remaining, err := Split(content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list element #%d: %w", len(elements), err)
+		}
+
+		elements = append(elements, RawValue(content[:len(content)-len(remaining)]))
+		content = remaining
+	}
+
+	return elements, rest, nil
+}
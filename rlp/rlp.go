@@ -173,7 +173,8 @@ func encodeLength(n int, offset magicOffset) []byte {
 
 func encodeString(input []byte) ([]byte, error) {
 	if len(input) == 1 && input[0] <= SmallByte {
-		return encodeUint8(input[0])
+		// Unlike integers, a single zero byte is a non-empty string and encodes as itself
+		return []byte{input[0]}, nil
 	} else {
 		return append(encodeLength(len(input), StringOffset), input...), nil
 	}
@@ -223,6 +224,10 @@ func encode(val reflect.Value) ([]byte, error) {
 		val = val.Elem()
 	}
 
+	if val.Type() == rawValueType {
+		return append([]byte{}, val.Bytes()...), nil
+	}
+
 	switch val.Kind() {
 	case reflect.Ptr:
 		if !val.Type().AssignableTo(bigIntType) {
@@ -307,7 +312,7 @@ func decodeLength(input []byte) (uint64, uint64, reflect.Kind) {
 	case magicByte < SliceOffset:
 		// long string: length described by magic = 0xb7 + <byte length of length of string>
 		byteLengthOfLength := magicByte - StringOffset - ShortLength
-		length := getUint64(input[1:byteLengthOfLength])
+		length := getUint64(input[1 : 1+byteLengthOfLength])
 		offset := uint64(byteLengthOfLength + 1)
 		return offset, length, reflect.String
 
@@ -320,7 +325,7 @@ func decodeLength(input []byte) (uint64, uint64, reflect.Kind) {
 	default:
 		// long string: length described by magic = 0xf7 + <byte length of length of string>
 		byteLengthOfLength := magicByte - SliceOffset - ShortLength
-		length := getUint64(input[1:byteLengthOfLength])
+		length := getUint64(input[1 : 1+byteLengthOfLength])
 		offset := uint64(byteLengthOfLength + 1)
 		return offset, length, reflect.Slice
 	}
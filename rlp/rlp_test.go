@@ -101,6 +101,11 @@ func TestEncoding(t *testing.T) {
 				[]byte{0x0f},
 				[]byte{0x0f},
 			},
+			{
+				[]byte{0x00},
+				[]byte{0x00},
+				[]byte{0x00},
+			},
 			{
 				[]byte{0x04, 0x00},
 				[]byte{0x82, 0x04, 0x00},
@@ -309,3 +314,47 @@ func TestEncodeLength(t *testing.T) {
 	// Ensure we have the minimal encoding (no leading zeros)
 	require.Equal(t, []byte{0xb8, 0xff}, encodeLength(0xff, StringOffset))
 }
+
+func TestRawValue(t *testing.T) {
+	enc, err := Encode([]interface{}{RawValue{0xc2, 0x01, 0x02}, []byte("dog")})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xc7, 0xc2, 0x01, 0x02, 0x83, byte('d'), byte('o'), byte('g')}, enc)
+
+	elements, rest, err := SplitList(enc)
+	require.NoError(t, err)
+	require.Empty(t, rest)
+	require.Equal(t, []RawValue{{0xc2, 0x01, 0x02}, {0x83, byte('d'), byte('o'), byte('g')}}, elements)
+
+	content, rest, err := SplitString(elements[1])
+	require.NoError(t, err)
+	require.Empty(t, rest)
+	require.Equal(t, []byte("dog"), content)
+
+	_, _, err = SplitString(elements[0])
+	require.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestSplit_Long(t *testing.T) {
+	long := make([]byte, 300)
+	for i := range long {
+		long[i] = byte(i)
+	}
+
+	enc, err := Encode([]interface{}{long, long})
+	require.NoError(t, err)
+
+	elements, rest, err := SplitList(enc)
+	require.NoError(t, err)
+	require.Empty(t, rest)
+	require.Len(t, elements, 2)
+
+	content, _, err := SplitString(elements[0])
+	require.NoError(t, err)
+	require.Equal(t, long, content)
+
+	_, _, _, err = Split(enc[:len(enc)-1])
+	require.ErrorIs(t, err, ErrInvalid)
+
+	_, _, _, err = Split([]byte{0xb9, 0x01})
+	require.ErrorIs(t, err, ErrInvalid)
+}
@@ -0,0 +1,233 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WithAutoBatching groups the single requests issued concurrently, through `DoRequest` and the
+// methods built on it like `Call`, into JSON-RPC batches. A batch is sent once `window` elapsed
+// since its first request or as soon as it holds `maxBatchSize` requests, `0` meaning no limit.
+// Each caller receives its own response, errors included, as if its request was sent alone.
+//
+// Requests served from the cache are never batched and batches built by `DoRequests` are sent
+// as is.
+func WithAutoBatching(window time.Duration, maxBatchSize int) Option {
+	return func(client *Client) {
+		client.batcher = &autoBatcher{window: window, maxBatchSize: maxBatchSize}
+	}
+}
+
+type autoBatcher struct {
+	transport    Transport
+	window       time.Duration
+	maxBatchSize int
+
+	lock    sync.Mutex
+	pending []*batchedCall
+	timer   *time.Timer
+}
+
+type batchedCall struct {
+	ctx     context.Context
+	raw     []byte
+	request map[string]json.RawMessage
+	done    chan batchedResult
+}
+
+type batchedResult struct {
+	response []byte
+	err      error
+}
+
+func (b *autoBatcher) RoundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(request)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return b.transport.RoundTrip(ctx, request)
+	}
+
+	var single map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &single); err != nil {
+		return nil, fmt.Errorf("invalid json_rpc request: %w", err)
+	}
+
+	call := &batchedCall{ctx: ctx, raw: request, request: single, done: make(chan batchedResult, 1)}
+
+	b.lock.Lock()
+	b.pending = append(b.pending, call)
+	if b.maxBatchSize > 0 && len(b.pending) >= b.maxBatchSize {
+		batch := b.take()
+		b.lock.Unlock()
+
+		go b.send(batch)
+	} else {
+		if len(b.pending) == 1 {
+			b.timer = time.AfterFunc(b.window, b.flush)
+		}
+		b.lock.Unlock()
+	}
+
+	select {
+	case result := <-call.done:
+		return result.response, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// take removes the pending calls, the lock must be held.
+func (b *autoBatcher) take() []*batchedCall {
+	batch := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	return batch
+}
+
+func (b *autoBatcher) flush() {
+	b.lock.Lock()
+	batch := b.take()
+	b.lock.Unlock()
+
+	if len(batch) > 0 {
+		b.send(batch)
+	}
+}
+
+func (b *autoBatcher) send(batch []*batchedCall) {
+	ctx, cancel := batchContext(batch)
+	defer cancel()
+
+	if len(batch) == 1 {
+		response, err := b.transport.RoundTrip(ctx, batch[0].raw)
+		batch[0].done <- batchedResult{response, err}
+		return
+	}
+
+	if tracer.Enabled() {
+		zlog.Debug("sending auto batch", zap.Int("size", len(batch)))
+	}
+
+	responses, err := b.roundTrip(ctx, batch)
+	for i, call := range batch {
+		if err != nil {
+			call.done <- batchedResult{err: err}
+			continue
+		}
+
+		if responses[i] == nil {
+			call.done <- batchedResult{err: fmt.Errorf("no response to request in json_rpc batch")}
+			continue
+		}
+
+		if originalID, found := call.request["id"]; found {
+			responses[i]["id"] = originalID
+		} else {
+			delete(responses[i], "id")
+		}
+
+		response, err := json.Marshal(responses[i])
+		call.done <- batchedResult{response, err}
+	}
+}
+
+// roundTrip sends the calls as one batch, identified by their position, and returns the response
+// of each call, `nil` for the ones the node did not answer.
+func (b *autoBatcher) roundTrip(ctx context.Context, batch []*batchedCall) ([]map[string]json.RawMessage, error) {
+	requests := make([]map[string]json.RawMessage, len(batch))
+	for i, call := range batch {
+		request := copyRawMap(call.request)
+		request["id"] = json.RawMessage(fmt.Sprintf(`"0x%x"`, i+1))
+		requests[i] = request
+	}
+
+	payload, err := json.Marshal(requests)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal json_rpc batch: %w", err)
+	}
+
+	response, err := b.transport.RoundTrip(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]map[string]json.RawMessage, len(batch))
+
+	response = bytes.TrimSpace(response)
+	if len(response) > 0 && response[0] == '{' {
+		// The node rejected the batch as a whole, like when it's too big, every call receives the error
+		var single map[string]json.RawMessage
+		if err := json.Unmarshal(response, &single); err != nil {
+			return nil, fmt.Errorf("invalid json_rpc response: %w", err)
+		}
+
+		for i := range out {
+			out[i] = copyRawMap(single)
+		}
+		return out, nil
+	}
+
+	var responses []map[string]json.RawMessage
+	if err := json.Unmarshal(response, &responses); err != nil {
+		return nil, fmt.Errorf("invalid json_rpc batch response: %w", err)
+	}
+
+	for _, single := range responses {
+		id, ok := parseRPCID(string(single["id"]))
+		if ok && id >= 1 && id <= len(out) && out[id-1] == nil {
+			out[id-1] = single
+		}
+	}
+
+	return out, nil
+}
+
+// batchContext returns a context canceled once every caller of the batch went away, the batch is
+// still useful as long as one of them waits for it.
+func batchContext(batch []*batchedCall) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for _, call := range batch {
+			select {
+			case <-call.ctx.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+
+	return ctx, cancel
+}
+
+func copyRawMap(in map[string]json.RawMessage) map[string]json.RawMessage {
+	out := make(map[string]json.RawMessage, len(in))
+	for key, value := range in {
+		out[key] = value
+	}
+
+	return out
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_AutoBatching(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_blockNumber": "0x10",
+		"eth_gasPrice":    "0x3b9aca00",
+		"eth_chainId":     &ErrResponse{Code: -32000, Message: "unavailable"},
+	})
+	defer closer()
+
+	tests := []struct {
+		name         string
+		maxBatchSize int
+		expectedSent []int
+	}{
+		{"window", 0, []int{9}},
+		{"max batch size", 4, []int{4, 4, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lock sync.Mutex
+			var sent []int
+			transport := newHTTPTransport(server.URL, http.DefaultClient)
+
+			client := NewClient(server.URL, WithAutoBatching(50*time.Millisecond, test.maxBatchSize), WithTransport(TransportFunc(func(ctx context.Context, request []byte) ([]byte, error) {
+				lock.Lock()
+				sent = append(sent, bytes.Count(request, []byte(`"method"`)))
+				lock.Unlock()
+
+				return transport.RoundTrip(ctx, request)
+			})))
+
+			ctx := context.Background()
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(3)
+				go func() {
+					defer wg.Done()
+					blockNum, err := client.LatestBlockNum(ctx)
+					assert.NoError(t, err)
+					assert.Equal(t, uint64(16), blockNum)
+				}()
+				go func() {
+					defer wg.Done()
+					gasPrice, err := client.GasPrice(ctx)
+					assert.NoError(t, err)
+					assert.Equal(t, int64(1000000000), gasPrice.Int64())
+				}()
+				go func() {
+					defer wg.Done()
+					_, err := client.DoRequest(ctx, "eth_chainId", nil)
+					assert.Equal(t, &ErrResponse{Code: -32000, Message: "unavailable"}, err)
+				}()
+			}
+			wg.Wait()
+
+			assert.ElementsMatch(t, test.expectedSent, sent)
+		})
+	}
+}
+
+func TestClient_AutoBatching_MissingResponse(t *testing.T) {
+	var calls int32
+	client := NewClient("", WithAutoBatching(20*time.Millisecond, 2), WithTransport(TransportFunc(func(ctx context.Context, request []byte) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return []byte(`[{"jsonrpc":"2.0","id":"0x2","result":"0x2a"}]`), nil
+	})))
+
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := client.DoRequest(context.Background(), "eth_blockNumber", nil)
+			results <- err
+		}()
+	}
+
+	var errs []string
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "sending request to json_rpc endpoint: no response to request in json_rpc batch", errs[0])
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -1,8 +1,200 @@
 package rpc
 
-import "context"
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
 
+	"go.uber.org/zap"
+)
+
+// Cache stores the responses of the requests the client's `CachePolicy` deems cacheable, keyed by
+// the request's method and parameters.
 type Cache interface {
-	Set(ctx context.Context, key string, response []byte)
+	// Set stores `response` under `key`, it should be evicted once `ttl` elapsed, `0` meaning the
+	// response never expires.
+	Set(ctx context.Context, key string, response []byte, ttl time.Duration)
 	Get(ctx context.Context, key string) (data []byte, found bool)
 }
+
+// CachePolicy decides if the response of a request can be cached and for how long, `ttl` is passed
+// to `Cache.Set`. It receives the request's parameters encoded in JSON.
+type CachePolicy func(method string, params []json.RawMessage) (ttl time.Duration, cacheable bool)
+
+// WithCachePolicy sets the policy deciding which requests are cached, defaults to `DefaultCachePolicy`.
+func WithCachePolicy(policy CachePolicy) Option {
+	return func(client *Client) {
+		client.cachePolicy = policy
+	}
+}
+
+// Index of the block parameter of the methods whose result only depends on it, the block is
+// optional for `eth_estimateGas`.
+var cacheableAtBlockMethods = map[string]int{
+	"eth_call":                                1,
+	"eth_estimateGas":                         1,
+	"eth_getBalance":                          1,
+	"eth_getCode":                             1,
+	"eth_getTransactionCount":                 1,
+	"eth_getStorageAt":                        2,
+	"eth_getProof":                            2,
+	"eth_feeHistory":                          1,
+	"eth_getBlockByNumber":                    0,
+	"eth_getBlockReceipts":                    0,
+	"eth_getBlockTransactionCountByNumber":    0,
+	"eth_getTransactionByBlockNumberAndIndex": 0,
+}
+
+// Methods whose result never changes once available, because they are keyed by a hash or
+// describe the chain itself.
+var cacheableMethods = map[string]bool{
+	"eth_chainId":                           true,
+	"net_version":                           true,
+	"eth_getBlockByHash":                    true,
+	"eth_getBlockTransactionCountByHash":    true,
+	"eth_getTransactionByBlockHashAndIndex": true,
+}
+
+// Methods whose result identifies the block the transaction was mined in, it changes once a
+// pending transaction is mined and again if a reorg removes its block.
+var cacheableMinedMethods = map[string]bool{
+	"eth_getTransactionByHash":  true,
+	"eth_getTransactionReceipt": true,
+}
+
+// DefaultCachePolicy caches, without expiration, the requests whose result cannot change: requests
+// pinned to a block number or hash, requests for blocks by hash and requests for the chain's
+// identifier. Requests at the `latest` or `pending` blocks, or not specifying a block, are never
+// cached, neither are logs requests not bounded by block numbers or hash.
+//
+// Transactions and receipts by hash are accepted too, but only responses of mined transactions
+// are stored and only when the client tracks block finality (see `WithCacheFinalityDepth`), so
+// they are evicted if a reorg removes their block. With a cache unable to evict them, they are only
+// stored once their block is final.
+func DefaultCachePolicy(method string, params []json.RawMessage) (ttl time.Duration, cacheable bool) {
+	if cacheableMethods[method] || cacheableMinedMethods[method] {
+		return 0, true
+	}
+
+	if method == "eth_getLogs" {
+		return 0, len(params) == 1 && isPinnedLogsFilter(params[0])
+	}
+
+	index, found := cacheableAtBlockMethods[method]
+	if !found || index >= len(params) {
+		return 0, false
+	}
+
+	return 0, isPinnedBlockParam(params[index])
+}
+
+// isPinnedBlockParam returns `true` for a block number, the `earliest` tag or an EIP-1898 block
+// reference by hash or number.
+func isPinnedBlockParam(param json.RawMessage) bool {
+	var tagOrNumber string
+	if err := json.Unmarshal(param, &tagOrNumber); err == nil {
+		return tagOrNumber == "earliest" || strings.HasPrefix(tagOrNumber, "0x")
+	}
+
+	var reference struct {
+		BlockHash   string `json:"blockHash"`
+		BlockNumber string `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(param, &reference); err != nil {
+		return false
+	}
+
+	return reference.BlockHash != "" || strings.HasPrefix(reference.BlockNumber, "0x")
+}
+
+func isPinnedLogsFilter(param json.RawMessage) bool {
+	var filter struct {
+		BlockHash string          `json:"blockHash"`
+		FromBlock json.RawMessage `json:"fromBlock"`
+		ToBlock   json.RawMessage `json:"toBlock"`
+	}
+	if err := json.Unmarshal(param, &filter); err != nil {
+		return false
+	}
+
+	if filter.BlockHash != "" {
+		return true
+	}
+
+	// A missing block defaults to `latest`
+	return filter.FromBlock != nil && filter.ToBlock != nil && isPinnedBlockParam(filter.FromBlock) && isPinnedBlockParam(filter.ToBlock)
+}
+
+type cacheEntry struct {
+	key       string
+	ttl       time.Duration
+	cacheable bool
+	// mined is set for requests whose response is only final once the transaction is mined in a
+	// block tracked for finality
+	mined bool
+}
+
+// cacheEntry returns the cache key of the request and the time its response should be kept, the
+// entry is not cacheable when the request must not be cached.
+func (c *Client) cacheEntry(ctx context.Context, logger *zap.Logger, req *RPCRequest) (out cacheEntry) {
+	if c.cache == nil {
+		return
+	}
+
+	encoded, err := MarshalJSONRPC(req.Params)
+	if err != nil {
+		return
+	}
+
+	var params []json.RawMessage
+	if err := json.Unmarshal(encoded, &params); err != nil {
+		return
+	}
+
+	policy := c.cachePolicy
+	if policy == nil {
+		policy = DefaultCachePolicy
+	}
+
+	ttl, cacheable := policy(req.Method, params)
+	if !cacheable {
+		return
+	}
+
+	key, err := cacheKey(req.Method, encoded)
+	if err != nil {
+		return
+	}
+
+	if c.finality != nil {
+		if number, ok := requestBlockNumber(req.Method, params); ok {
+			if key, err = c.finality.pinnedKey(ctx, key, number); err != nil {
+				logger.Info("unable to check block finality, request not cached", zap.Uint64("block_num", number), zap.Error(err))
+				return
+			}
+		}
+	}
+
+	return cacheEntry{key: key, ttl: ttl, cacheable: true, mined: cacheableMinedMethods[req.Method]}
+}
+
+// cacheKey is the canonical key of a request, the hash of its method and compacted parameters,
+// independent of the request's identifier.
+func cacheKey(method string, params []byte) (string, error) {
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, params); err != nil {
+		return "", fmt.Errorf("invalid params: %w", err)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(method))
+	hash.Write([]byte{0})
+	hash.Write(compacted.Bytes())
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// FileCache is a `Cache` storing each response in its own file under a directory, named after the
+// hash of its key, so it survives restarts and can be shared by processes. Files are written to a
+// temporary file first then renamed, readers never see a partially written response.
+//
+// Write and read failures are logged and treated like cache misses, the cache is never cleaned up
+// except for expired entries found on read and deleted entries.
+type FileCache struct {
+	dir string
+
+	hits      uint64
+	misses    uint64
+	sets      uint64
+	evictions uint64
+}
+
+// fileCacheHeaderSize is the size of the header of each file, the entry's expiration time as Unix
+// nanoseconds, `0` for entries that never expire.
+const fileCacheHeaderSize = 8
+
+// NewFileCache returns a cache storing its entries under `dir`, created if missing.
+func NewFileCache(dir string) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create cache directory: %w", err)
+	}
+
+	return &FileCache{dir: dir}, nil
+}
+
+func (c *FileCache) Set(ctx context.Context, key string, response []byte, ttl time.Duration) {
+	atomic.AddUint64(&c.sets, 1)
+
+	if err := c.write(key, response, ttl); err != nil {
+		zlog.Warn("unable to write cache entry", zap.String("key", key), zap.Error(err))
+	}
+}
+
+func (c *FileCache) write(key string, response []byte, ttl time.Duration) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	content := make([]byte, fileCacheHeaderSize+len(response))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(content, uint64(time.Now().Add(ttl).UnixNano()))
+	}
+	copy(content[fileCacheHeaderSize:], response)
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (c *FileCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	data, _, found := c.getWithTTL(ctx, key)
+	return data, found
+}
+
+func (c *FileCache) getWithTTL(ctx context.Context, key string) ([]byte, time.Duration, bool) {
+	path := c.path(key)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			zlog.Warn("unable to read cache entry", zap.String("key", key), zap.Error(err))
+		}
+
+		atomic.AddUint64(&c.misses, 1)
+		return nil, 0, false
+	}
+
+	if len(content) < fileCacheHeaderSize {
+		zlog.Warn("ignoring invalid cache entry", zap.String("path", path))
+		atomic.AddUint64(&c.misses, 1)
+		return nil, 0, false
+	}
+
+	var ttl time.Duration
+	if expiresAt := binary.BigEndian.Uint64(content); expiresAt != 0 {
+		if ttl = time.Until(time.Unix(0, int64(expiresAt))); ttl <= 0 {
+			os.Remove(path)
+			atomic.AddUint64(&c.evictions, 1)
+			atomic.AddUint64(&c.misses, 1)
+			return nil, 0, false
+		}
+	}
+
+	atomic.AddUint64(&c.hits, 1)
+	return content[fileCacheHeaderSize:], ttl, true
+}
+
+func (c *FileCache) Delete(ctx context.Context, key string) {
+	err := os.Remove(c.path(key))
+	if err == nil {
+		atomic.AddUint64(&c.evictions, 1)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		zlog.Warn("unable to delete cache entry", zap.String("key", key), zap.Error(err))
+	}
+}
+
+func (c *FileCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Sets:      atomic.LoadUint64(&c.sets),
+		Evictions: atomic.LoadUint64(&c.evictions),
+	}
+}
+
+// path returns the file of `key`, files are spread in sub-directories named after the first byte
+// of their hash to keep directories small.
+func (c *FileCache) path(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(hash[:])
+
+	return filepath.Join(c.dir, name[0:2], name)
+}
@@ -0,0 +1,161 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// CacheStats are the counters of a cache since its creation.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Sets   uint64
+	// Evictions counts the entries removed to make room for new ones, because they expired or were
+	// deleted.
+	Evictions uint64
+}
+
+// expiringCache is implemented by the caches able to tell how long an entry has left to live, used
+// by `TieredCache` to fill the upper tiers with the right TTL.
+type expiringCache interface {
+	getWithTTL(ctx context.Context, key string) (data []byte, ttl time.Duration, found bool)
+}
+
+// LRUCache is an in-memory `Cache` holding at most a given number of bytes, the least recently
+// used entries are evicted first when it's full. It's safe for concurrent use.
+type LRUCache struct {
+	maxBytes int64
+
+	lock    sync.Mutex
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+	stats   CacheStats
+}
+
+type lruEntry struct {
+	key       string
+	data      []byte
+	expiresAt time.Time
+}
+
+func (e *lruEntry) size() int64 {
+	return int64(len(e.key) + len(e.data))
+}
+
+// NewLRUCache returns a cache holding at most `maxBytes` bytes of keys and responses.
+func NewLRUCache(maxBytes int64) *LRUCache {
+	return &LRUCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (c *LRUCache) Set(ctx context.Context, key string, response []byte, ttl time.Duration) {
+	entry := &lruEntry{key: key, data: response}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.stats.Sets++
+	if element, found := c.entries[key]; found {
+		c.remove(element)
+	}
+
+	if entry.size() > c.maxBytes {
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	c.size += entry.size()
+
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	data, _, found := c.getWithTTL(ctx, key)
+	return data, found
+}
+
+func (c *LRUCache) getWithTTL(ctx context.Context, key string) ([]byte, time.Duration, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, found := c.entries[key]
+	if !found {
+		c.stats.Misses++
+		return nil, 0, false
+	}
+
+	entry := element.Value.(*lruEntry)
+
+	var ttl time.Duration
+	if !entry.expiresAt.IsZero() {
+		if ttl = time.Until(entry.expiresAt); ttl <= 0 {
+			c.remove(element)
+			c.stats.Evictions++
+			c.stats.Misses++
+			return nil, 0, false
+		}
+	}
+
+	c.order.MoveToFront(element)
+	c.stats.Hits++
+
+	return entry.data, ttl, true
+}
+
+func (c *LRUCache) Delete(ctx context.Context, key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, found := c.entries[key]; found {
+		c.remove(element)
+		c.stats.Evictions++
+	}
+}
+
+// Len returns the number of entries in the cache, expired ones included until they are evicted.
+func (c *LRUCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *LRUCache) Stats() CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.stats
+}
+
+// remove deletes the entry of `element`, the lock must be held.
+func (c *LRUCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*lruEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size()
+}
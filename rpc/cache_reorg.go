@@ -0,0 +1,359 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
+)
+
+// CacheDeleter is implemented by the caches able to delete an entry, required to evict the
+// responses of blocks removed from the canonical chain by a reorg.
+type CacheDeleter interface {
+	Delete(ctx context.Context, key string)
+}
+
+// WithCacheFinalityDepth protects the cache against reorgs: responses of requests pinned to a block
+// less than `depth` blocks behind the head are cached under the block's hash, and evicted when the
+// block is removed from the canonical chain. Eviction requires a cache implementing `CacheDeleter`,
+// other caches only stop serving the responses of requests pinned to a block number, and only store
+// transactions and receipts once their block is final.
+func WithCacheFinalityDepth(depth uint64) Option {
+	return func(client *Client) {
+		client.finality = newCacheFinality(depth, false)
+	}
+}
+
+// WithCacheFinalizedTag is `WithCacheFinalityDepth` with the blocks after the node's `finalized`
+// block considered as not final, instead of a fixed depth.
+func WithCacheFinalizedTag() Option {
+	return func(client *Client) {
+		client.finality = newCacheFinality(0, true)
+	}
+}
+
+// cacheFinality tracks the canonical hash of the blocks that are not final yet, and the cache
+// keys of the responses depending on them. The head is refreshed at most once per refresh
+// interval, walking back the parent hashes from the head to detect the blocks that changed.
+type cacheFinality struct {
+	// client performs the requests of the finality tracking, bypassing the cache
+	client          *Client
+	cache           Cache
+	depth           uint64
+	useFinalizedTag bool
+	refreshInterval time.Duration
+
+	refreshLock sync.Mutex
+	lastRefresh time.Time
+
+	lock sync.Mutex
+	// final is the highest final block number
+	final  uint64
+	hashes map[uint64]string
+	keys   map[uint64][]string
+}
+
+func newCacheFinality(depth uint64, useFinalizedTag bool) *cacheFinality {
+	return &cacheFinality{
+		depth:           depth,
+		useFinalizedTag: useFinalizedTag,
+		refreshInterval: time.Second,
+		hashes:          map[uint64]string{},
+		keys:            map[uint64][]string{},
+	}
+}
+
+// init binds the tracking to `client` once it's fully configured.
+func (f *cacheFinality) init(client *Client) {
+	uncached := *client
+	uncached.cache = nil
+	uncached.finality = nil
+
+	f.client = &uncached
+	f.cache = client.cache
+}
+
+// pinnedKey returns the cache key of a request pinned to block `number` whose canonical key is
+// `key`. Requests pinned to a final block keep their key, the others are keyed by the block's hash.
+func (f *cacheFinality) pinnedKey(ctx context.Context, key string, number uint64) (string, error) {
+	if err := f.refresh(ctx); err != nil {
+		return "", err
+	}
+
+	f.lock.Lock()
+	final := number <= f.final
+	hash, found := f.hashes[number]
+	f.lock.Unlock()
+
+	if final {
+		return key, nil
+	}
+
+	if !found {
+		block, err := f.client.GetBlockByNumber(ctx, number)
+		if err != nil {
+			return "", err
+		}
+		if block == nil {
+			return "", fmt.Errorf("block #%d not found", number)
+		}
+
+		hash = block.Hash.String()
+		f.observe(ctx, number, hash)
+	}
+
+	pinned, err := cacheKey(key, []byte(`"`+hash+`"`))
+	if err != nil {
+		return "", err
+	}
+
+	f.track(number, pinned)
+	return pinned, nil
+}
+
+// trackResult registers the key of a response identifying the block it comes from, like a
+// transaction receipt, so it's evicted if the block is removed from the canonical chain. It
+// returns `false` if the block is known to not be canonical anymore, if its finality cannot be
+// checked or if it's not final and the cache cannot evict the response, the response being cached
+// under a key that does not depend on the block.
+func (f *cacheFinality) trackResult(ctx context.Context, key string, raw string) bool {
+	result := gjson.Get(raw, "result")
+	blockNumber, blockHash := result.Get("blockNumber"), result.Get("blockHash")
+	if !blockNumber.Exists() || !blockHash.Exists() {
+		return true
+	}
+
+	number, ok := parseQuantity(blockNumber.String())
+	if !ok {
+		return true
+	}
+	hash := strings.ToLower(strings.TrimPrefix(blockHash.String(), "0x"))
+
+	// The final block must be known, otherwise blocks already final would be tracked forever
+	if err := f.refresh(ctx); err != nil {
+		zlog.Info("unable to check block finality, response not cached", zap.Uint64("block_num", number), zap.Error(err))
+		return false
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if number <= f.final {
+		return true
+	}
+
+	if _, ok := f.cache.(CacheDeleter); !ok {
+		return false
+	}
+
+	if canonical, found := f.hashes[number]; found && canonical != hash {
+		return false
+	}
+
+	f.hashes[number] = hash
+	f.keys[number] = append(f.keys[number], key)
+	return true
+}
+
+func (f *cacheFinality) track(number uint64, key string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.keys[number] = append(f.keys[number], key)
+}
+
+// refresh fetches the head and the final block then checks the tracked blocks, from the highest,
+// until finding one still canonical.
+func (f *cacheFinality) refresh(ctx context.Context) error {
+	f.refreshLock.Lock()
+	defer f.refreshLock.Unlock()
+
+	if time.Since(f.lastRefresh) < f.refreshInterval {
+		return nil
+	}
+
+	head, err := f.client.getBlock(ctx, "eth_getBlockByNumber", LatestBlock, nil)
+	if err != nil {
+		return err
+	}
+	if head == nil {
+		return fmt.Errorf("latest block not found")
+	}
+
+	final := uint64(0)
+	if f.useFinalizedTag {
+		finalized, err := f.client.getBlock(ctx, "eth_getBlockByNumber", FinalizedBlock, nil)
+		if err != nil {
+			return err
+		}
+		if finalized != nil {
+			final = uint64(finalized.Number)
+		}
+	} else if uint64(head.Number) > f.depth {
+		final = uint64(head.Number) - f.depth
+	}
+
+	f.lock.Lock()
+	f.final = final
+	for number := range f.hashes {
+		if number <= final {
+			delete(f.hashes, number)
+		}
+	}
+	for number := range f.keys {
+		if number <= final {
+			delete(f.keys, number)
+		}
+	}
+	f.lock.Unlock()
+
+	f.observe(ctx, uint64(head.Number), head.Hash.String())
+
+	f.lock.Lock()
+	numbers := make([]uint64, 0, len(f.hashes))
+	for number := range f.hashes {
+		if number < uint64(head.Number) {
+			numbers = append(numbers, number)
+		}
+	}
+	f.lock.Unlock()
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] > numbers[j] })
+
+	// Blocks between tracked ones may never have been observed, each tracked block is checked
+	// against the parent hash known from the block above it or, when there is a gap, against the
+	// canonical block fetched at its number. Once a tracked block is canonical, so are its ancestors.
+	parentNumber, parentHash := uint64(head.Number)-1, head.ParentHash.String()
+	for _, number := range numbers {
+		f.lock.Lock()
+		tracked, found := f.hashes[number]
+		f.lock.Unlock()
+
+		if !found {
+			continue
+		}
+
+		if number == parentNumber && tracked == parentHash {
+			break
+		}
+
+		block, err := f.client.GetBlockByNumber(ctx, number)
+		if err != nil {
+			return err
+		}
+		if block == nil || block.Hash.String() == tracked {
+			break
+		}
+
+		f.observe(ctx, number, block.Hash.String())
+		parentNumber, parentHash = number-1, block.ParentHash.String()
+	}
+
+	f.lastRefresh = time.Now()
+	return nil
+}
+
+// observe records the canonical hash of block `number`, evicting the responses depending on the
+// block previously known at that number.
+func (f *cacheFinality) observe(ctx context.Context, number uint64, hash string) {
+	f.lock.Lock()
+	previous, found := f.hashes[number]
+	f.hashes[number] = hash
+
+	var orphaned []string
+	if found && previous != hash {
+		orphaned = f.keys[number]
+		delete(f.keys, number)
+	}
+	f.lock.Unlock()
+
+	if !found || previous == hash {
+		return
+	}
+
+	zlog.Info("block removed from the canonical chain, evicting its cached responses", zap.Uint64("block_num", number), zap.String("orphaned_hash", previous), zap.String("canonical_hash", hash), zap.Int("entries", len(orphaned)))
+
+	deleter, ok := f.cache.(CacheDeleter)
+	if !ok {
+		return
+	}
+
+	for _, key := range orphaned {
+		deleter.Delete(ctx, key)
+	}
+}
+
+// requestBlockNumber returns the block number a request is pinned to, the end of the range for
+// `eth_getLogs`. Requests pinned to a block hash or a tag are not pinned to a number.
+func requestBlockNumber(method string, params []json.RawMessage) (number uint64, ok bool) {
+	if method == "eth_getLogs" {
+		if len(params) != 1 {
+			return 0, false
+		}
+
+		var filter struct {
+			ToBlock json.RawMessage `json:"toBlock"`
+		}
+		if err := json.Unmarshal(params[0], &filter); err != nil || filter.ToBlock == nil {
+			return 0, false
+		}
+
+		return blockParamNumber(filter.ToBlock)
+	}
+
+	index, found := cacheableAtBlockMethods[method]
+	if !found || index >= len(params) {
+		return 0, false
+	}
+
+	return blockParamNumber(params[index])
+}
+
+func blockParamNumber(param json.RawMessage) (uint64, bool) {
+	var number string
+	if err := json.Unmarshal(param, &number); err != nil {
+		var reference struct {
+			BlockNumber string `json:"blockNumber"`
+		}
+		if err := json.Unmarshal(param, &reference); err != nil {
+			return 0, false
+		}
+		number = reference.BlockNumber
+	}
+
+	return parseQuantity(number)
+}
+
+// parseQuantity parses a JSON-RPC quantity, a `0x` prefixed hexadecimal number.
+func parseQuantity(in string) (uint64, bool) {
+	if !strings.HasPrefix(in, "0x") {
+		return 0, false
+	}
+
+	var out eth.Uint64
+	if err := out.UnmarshalText([]byte(in)); err != nil {
+		return 0, false
+	}
+
+	return uint64(out), true
+}
@@ -0,0 +1,532 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultCachePolicy(t *testing.T) {
+	tests := []struct {
+		method            string
+		params            string
+		expectedCacheable bool
+	}{
+		{"eth_chainId", `[]`, true},
+		{"eth_blockNumber", `[]`, false},
+		{"eth_gasPrice", `[]`, false},
+		{"eth_getBlockByHash", `["0xaa",false]`, true},
+		{"eth_getTransactionReceipt", `["0xaa"]`, true},
+		{"eth_getBlockByNumber", `["0x10",false]`, true},
+		{"eth_getBlockByNumber", `["latest",false]`, false},
+		{"eth_getBlockByNumber", `["pending",false]`, false},
+		{"eth_getBlockByNumber", `["earliest",false]`, true},
+		{"eth_call", `[{"to":"0x01"},"0x10"]`, true},
+		{"eth_call", `[{"to":"0x01"},"latest"]`, false},
+		{"eth_call", `[{"to":"0x01"},{"blockHash":"0xaa"}]`, true},
+		{"eth_call", `[{"to":"0x01"},{"blockNumber":"0x10"}]`, true},
+		{"eth_call", `[{"to":"0x01"},{"blockNumber":"latest"}]`, false},
+		{"eth_estimateGas", `[{"to":"0x01"}]`, false},
+		{"eth_getStorageAt", `["0x01","0x0","0x10"]`, true},
+		{"eth_getStorageAt", `["0x01","0x0"]`, false},
+		{"eth_getLogs", `[{"fromBlock":"0x1","toBlock":"0x10"}]`, true},
+		{"eth_getLogs", `[{"fromBlock":"0x1"}]`, false},
+		{"eth_getLogs", `[{"fromBlock":"0x1","toBlock":"latest"}]`, false},
+		{"eth_getLogs", `[{"blockHash":"0xaa"}]`, true},
+		{"eth_sendRawTransaction", `["0x01"]`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+test.params, func(t *testing.T) {
+			var params []json.RawMessage
+			require.NoError(t, json.Unmarshal([]byte(test.params), &params))
+
+			ttl, cacheable := DefaultCachePolicy(test.method, params)
+			assert.Equal(t, test.expectedCacheable, cacheable)
+			assert.Equal(t, time.Duration(0), ttl)
+		})
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	key := func(method string, params string) string {
+		out, err := cacheKey(method, []byte(params))
+		require.NoError(t, err)
+		return out
+	}
+
+	assert.Equal(t, key("eth_getBalance", `["0x01","0x10"]`), key("eth_getBalance", ` [ "0x01", "0x10" ]`))
+	assert.NotEqual(t, key("eth_getBalance", `["0x01","0x10"]`), key("eth_getCode", `["0x01","0x10"]`))
+	assert.NotEqual(t, key("eth_getBalance", `["0x01","0x10"]`), key("eth_getBalance", `["0x01","0x11"]`))
+	assert.Len(t, key("eth_chainId", `null`), 64)
+}
+
+func TestClient_Cache(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_chainId":               "0x1",
+		"eth_getBalance":            "0x2a",
+		"eth_getTransactionReceipt": nil,
+		"eth_call":                  &ErrResponse{Code: 3, Message: "execution reverted"},
+	})
+	defer closer()
+
+	cache := &memoryTestCache{entries: map[string][]byte{}}
+	client := NewClient(server.URL, WithCache(cache))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		responses, err := client.DoRequests(ctx, []*RPCRequest{
+			{Method: "eth_getBalance", Params: []interface{}{testAccount, BlockNumber(16)}},
+			{Method: "eth_getBalance", Params: []interface{}{testAccount, LatestBlock}},
+			{Method: "eth_chainId"},
+			{Method: "eth_getTransactionReceipt", Params: []interface{}{testTrxHash}},
+			{Method: "eth_call", Params: []interface{}{CallParams{To: testAccount}, BlockNumber(16)}},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []int{1, 2, 3, 4, 5}, []int{responses[0].ID, responses[1].ID, responses[2].ID, responses[3].ID, responses[4].ID})
+		assert.Equal(t, "0x2a", responses[0].Content)
+		assert.Equal(t, "0x2a", responses[1].Content)
+		assert.Equal(t, "0x1", responses[2].Content)
+		assert.Equal(t, "", responses[3].Content)
+		assert.Equal(t, &ErrResponse{Code: 3, Message: "execution reverted"}, responses[4].Err)
+	}
+
+	chainID, err := client.DoRequest(ctx, "eth_chainId", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "0x1", chainID)
+
+	assert.Equal(t, 3, server.Count("eth_getBalance"))
+	assert.Equal(t, 1, server.Count("eth_chainId"))
+	assert.Equal(t, 2, server.Count("eth_getTransactionReceipt"))
+	assert.Equal(t, 1, server.Count("eth_call"))
+	assert.Len(t, cache.entries, 3)
+}
+
+func TestClient_CachePolicy(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_gasPrice": "0x3b9aca00"})
+	defer closer()
+
+	cache := &memoryTestCache{entries: map[string][]byte{}}
+	client := NewClient(server.URL, WithCache(cache), WithCachePolicy(func(method string, params []json.RawMessage) (time.Duration, bool) {
+		return 12 * time.Second, method == "eth_gasPrice"
+	}))
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GasPrice(context.Background())
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, server.Count("eth_gasPrice"))
+
+	require.Len(t, cache.ttls, 1)
+	for _, ttl := range cache.ttls {
+		assert.Equal(t, 12*time.Second, ttl)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(30)
+
+	cache.Set(ctx, "a", []byte("0123456789"), 0)
+	cache.Set(ctx, "b", []byte("0123456789"), 0)
+
+	_, found := cache.Get(ctx, "a")
+	assert.True(t, found)
+
+	// "b" is the least recently used entry
+	cache.Set(ctx, "c", []byte("0123456789"), 0)
+	_, found = cache.Get(ctx, "b")
+	assert.False(t, found)
+
+	data, found := cache.Get(ctx, "c")
+	assert.True(t, found)
+	assert.Equal(t, []byte("0123456789"), data)
+
+	// Entries bigger than the cache are not stored
+	cache.Set(ctx, "d", make([]byte, 30), 0)
+	_, found = cache.Get(ctx, "d")
+	assert.False(t, found)
+	assert.Equal(t, 2, cache.Len())
+
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 2, Sets: 4, Evictions: 1}, cache.Stats())
+}
+
+func TestLRUCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(1024)
+
+	cache.Set(ctx, "short", []byte("0x1"), time.Millisecond)
+	cache.Set(ctx, "long", []byte("0x2"), time.Hour)
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, found := cache.Get(ctx, "short")
+	assert.False(t, found)
+
+	_, ttl, found := cache.getWithTTL(ctx, "long")
+	assert.True(t, found)
+	assert.InDelta(t, float64(time.Hour), float64(ttl), float64(time.Minute))
+
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1, Sets: 2, Evictions: 1}, cache.Stats())
+}
+
+func TestFileCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cache, err := NewFileCache(dir)
+	require.NoError(t, err)
+
+	cache.Set(ctx, "block", []byte(`{"result":"0x1"}`), 0)
+	cache.Set(ctx, "expiring", []byte(`{"result":"0x2"}`), time.Millisecond)
+
+	// Entries survive the cache instance
+	cache, err = NewFileCache(dir)
+	require.NoError(t, err)
+
+	data, found := cache.Get(ctx, "block")
+	assert.True(t, found)
+	assert.Equal(t, []byte(`{"result":"0x1"}`), data)
+
+	time.Sleep(5 * time.Millisecond)
+	_, found = cache.Get(ctx, "expiring")
+	assert.False(t, found)
+
+	_, found = cache.Get(ctx, "missing")
+	assert.False(t, found)
+
+	// Only the remaining entry is left, without temporary files
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, cache.path("block"), files[0])
+
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2, Evictions: 1}, cache.Stats())
+}
+
+func TestTieredCache(t *testing.T) {
+	ctx := context.Background()
+
+	memory := NewLRUCache(1024)
+	disk, err := NewFileCache(t.TempDir())
+	require.NoError(t, err)
+
+	cache := NewTieredCache(memory, disk)
+	cache.Set(ctx, "a", []byte("0x1"), 0)
+
+	disk.Set(ctx, "b", []byte("0x2"), time.Hour)
+	_, found := memory.Get(ctx, "b")
+	assert.False(t, found)
+
+	data, found := cache.Get(ctx, "b")
+	assert.True(t, found)
+	assert.Equal(t, []byte("0x2"), data)
+
+	// "b" was promoted to the memory tier with its remaining TTL
+	data, ttl, found := memory.getWithTTL(ctx, "b")
+	assert.True(t, found)
+	assert.Equal(t, []byte("0x2"), data)
+	assert.InDelta(t, float64(time.Hour), float64(ttl), float64(time.Minute))
+
+	data, found = cache.Get(ctx, "a")
+	assert.True(t, found)
+	assert.Equal(t, []byte("0x1"), data)
+
+	_, found = cache.Get(ctx, "c")
+	assert.False(t, found)
+
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 1, Sets: 1}, cache.Stats())
+	assert.Equal(t, uint64(1), disk.Stats().Hits)
+}
+
+func TestClient_CacheReorg(t *testing.T) {
+	chain := newTestChain(10)
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_getBlockByNumber": chain.getBlockByNumber,
+		"eth_getBalance":       "0x2a",
+		"eth_getTransactionReceipt": func(params []interface{}) interface{} {
+			return map[string]interface{}{"blockNumber": "0x9", "blockHash": chain.hash(9), "status": "0x1"}
+		},
+	})
+	defer closer()
+
+	cache := NewLRUCache(1 << 20)
+	client := NewClient(server.URL, WithCache(cache), WithCacheFinalityDepth(3))
+	client.finality.refreshInterval = 0
+	ctx := context.Background()
+
+	request := func(method string, params ...interface{}) {
+		_, err := client.DoRequest(ctx, method, params)
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		request("eth_getBalance", testAccount, BlockNumber(9))
+		request("eth_getBalance", testAccount, BlockNumber(5))
+		request("eth_getTransactionReceipt", testTrxHash)
+	}
+
+	assert.Equal(t, 2, server.Count("eth_getBalance"))
+	assert.Equal(t, 1, server.Count("eth_getTransactionReceipt"))
+
+	// Blocks #9 and #10 are replaced and block #11 is appended
+	chain.reorg(9, 11)
+
+	request("eth_getBalance", testAccount, BlockNumber(9))
+	request("eth_getBalance", testAccount, BlockNumber(5))
+	request("eth_getTransactionReceipt", testTrxHash)
+
+	assert.Equal(t, 3, server.Count("eth_getBalance"))
+	assert.Equal(t, 2, server.Count("eth_getTransactionReceipt"))
+	assert.Equal(t, uint64(2), cache.Stats().Evictions)
+
+	// Responses of blocks that became final are served from the cache
+	request("eth_getBalance", testAccount, BlockNumber(9))
+	assert.Equal(t, 3, server.Count("eth_getBalance"))
+}
+
+func TestClient_CacheReorgBelowUntrackedBlocks(t *testing.T) {
+	chain := newTestChain(100)
+	canonical := chain.hash(98)
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_getBlockByNumber": chain.getBlockByNumber,
+		"eth_getBalance": func(params []interface{}) interface{} {
+			if chain.hash(98) == canonical {
+				return "0x1"
+			}
+			return "0x2"
+		},
+	})
+	defer closer()
+
+	client := NewClient(server.URL, WithCache(NewLRUCache(1<<20)), WithCacheFinalityDepth(10))
+	client.finality.refreshInterval = 0
+	ctx := context.Background()
+
+	balance := func() string {
+		out, err := client.DoRequest(ctx, "eth_getBalance", []interface{}{testAccount, BlockNumber(98)})
+		require.NoError(t, err)
+		return out
+	}
+
+	assert.Equal(t, "0x1", balance())
+
+	// Blocks #101 and #102 were never observed, the reorg starts below them
+	chain.reorg(97, 103)
+
+	assert.Equal(t, "0x2", balance())
+	assert.Equal(t, 2, server.Count("eth_getBalance"))
+}
+
+func TestClient_CacheFinalReceiptNotTracked(t *testing.T) {
+	chain := newTestChain(100)
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_getBlockByNumber": chain.getBlockByNumber,
+		"eth_getTransactionReceipt": func(params []interface{}) interface{} {
+			return map[string]interface{}{"blockNumber": "0xa", "blockHash": chain.hash(10), "status": "0x1"}
+		},
+	})
+	defer closer()
+
+	client := NewClient(server.URL, WithCache(NewLRUCache(1<<20)), WithCacheFinalityDepth(3))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := client.DoRequest(ctx, "eth_getTransactionReceipt", []interface{}{testTrxHash})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, server.Count("eth_getTransactionReceipt"))
+	assert.NotContains(t, client.finality.hashes, uint64(10))
+	assert.Empty(t, client.finality.keys)
+}
+
+func TestClient_CacheMinedTransactions(t *testing.T) {
+	chain := newTestChain(100)
+	var blockNumber interface{}
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_getBlockByNumber": chain.getBlockByNumber,
+		"eth_getTransactionByHash": func(params []interface{}) interface{} {
+			if blockNumber == nil {
+				return map[string]interface{}{"hash": testTrxHash, "blockNumber": nil, "blockHash": nil}
+			}
+			return map[string]interface{}{"hash": testTrxHash, "blockNumber": blockNumber, "blockHash": chain.hash(10)}
+		},
+	})
+	defer closer()
+
+	ctx := context.Background()
+	transaction := func(client *Client) *Transaction {
+		out, err := client.TransactionByHash(ctx, testTrxHash)
+		require.NoError(t, err)
+		return out
+	}
+
+	withFinality := NewClient(server.URL, WithCache(NewLRUCache(1<<20)), WithCacheFinalityDepth(3))
+	withoutFinality := NewClient(server.URL, WithCache(NewLRUCache(1<<20)))
+
+	// Pending transactions are never cached
+	assert.True(t, transaction(withFinality).IsPending())
+	blockNumber = "0xa"
+	assert.False(t, transaction(withFinality).IsPending())
+	assert.Equal(t, 2, server.Count("eth_getTransactionByHash"))
+
+	// Mined transactions are only cached when their block is tracked for reorgs
+	transaction(withFinality)
+	assert.Equal(t, 2, server.Count("eth_getTransactionByHash"))
+
+	transaction(withoutFinality)
+	transaction(withoutFinality)
+	assert.Equal(t, 4, server.Count("eth_getTransactionByHash"))
+}
+
+// keepingCache hides the `Delete` method of the cache it wraps.
+type keepingCache struct {
+	Cache
+}
+
+func TestClient_CacheMinedWithoutDeleter(t *testing.T) {
+	chain := newTestChain(100)
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_getBlockByNumber": chain.getBlockByNumber,
+		"eth_getTransactionReceipt": func(params []interface{}) interface{} {
+			number := map[string]uint64{testTrxHash.Pretty(): 99}[params[0].(string)]
+			if number == 0 {
+				number = 10
+			}
+			return map[string]interface{}{"blockNumber": fmt.Sprintf("0x%x", number), "blockHash": chain.hash(number), "status": "0x1"}
+		},
+	})
+	defer closer()
+
+	client := NewClient(server.URL, WithCache(keepingCache{NewLRUCache(1 << 20)}), WithCacheFinalityDepth(3))
+	ctx := context.Background()
+
+	receipt := func(hash string) {
+		_, err := client.DoRequest(ctx, "eth_getTransactionReceipt", []interface{}{hash})
+		require.NoError(t, err)
+	}
+
+	// The receipt's block is not final, the cache could not evict it after a reorg
+	receipt(testTrxHash.Pretty())
+	receipt(testTrxHash.Pretty())
+	assert.Equal(t, 2, server.Count("eth_getTransactionReceipt"))
+
+	finalTrxHash := "0x" + strings.Repeat("bb", 32)
+	receipt(finalTrxHash)
+	receipt(finalTrxHash)
+	assert.Equal(t, 3, server.Count("eth_getTransactionReceipt"))
+}
+
+type testChain struct {
+	lock  sync.Mutex
+	head  uint64
+	forks map[uint64]int
+}
+
+func newTestChain(head uint64) *testChain {
+	return &testChain{head: head, forks: map[uint64]int{}}
+}
+
+// reorg replaces the blocks from `from` and extends the chain up to `head`.
+func (c *testChain) reorg(from, head uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for number := from; number <= head; number++ {
+		c.forks[number]++
+	}
+	c.head = head
+}
+
+func (c *testChain) hash(number uint64) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.hashLocked(number)
+}
+
+func (c *testChain) hashLocked(number uint64) string {
+	return fmt.Sprintf("0x%02x%062x", c.forks[number], number)
+}
+
+func (c *testChain) getBlockByNumber(params []interface{}) interface{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	number := c.head
+	if params[0] != "latest" {
+		number = uint64(hexToTestUint64(params[0].(string)))
+	}
+
+	if number > c.head {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"number":     fmt.Sprintf("0x%x", number),
+		"hash":       c.hashLocked(number),
+		"parentHash": c.hashLocked(number - 1),
+	}
+}
+
+func hexToTestUint64(in string) uint64 {
+	out, ok := parseQuantity(in)
+	if !ok {
+		panic(fmt.Errorf("invalid quantity %q", in))
+	}
+	return out
+}
+
+func TestRequestBlockNumber(t *testing.T) {
+	tests := []struct {
+		method       string
+		params       string
+		expected     uint64
+		expectedPass bool
+	}{
+		{"eth_getBalance", `["0xab", "0x10"]`, 16, true},
+		{"eth_getStorageAt", `["0xab", "0x0", "0x11"]`, 17, true},
+		{"eth_call", `[{}, {"blockNumber": "0x12"}]`, 18, true},
+		{"eth_call", `[{}, {"blockHash": "0xaa"}]`, 0, false},
+		{"eth_getBalance", `["0xab", "latest"]`, 0, false},
+		{"eth_getLogs", `[{"fromBlock": "0x1", "toBlock": "0x13"}]`, 19, true},
+		{"eth_getLogs", `[{"blockHash": "0xaa"}]`, 0, false},
+		{"eth_getTransactionReceipt", `["0xaa"]`, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.params, func(t *testing.T) {
+			var params []json.RawMessage
+			require.NoError(t, json.Unmarshal([]byte(test.params), &params))
+
+			number, ok := requestBlockNumber(test.method, params)
+			assert.Equal(t, test.expectedPass, ok)
+			assert.Equal(t, test.expected, number)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// TieredCache chains caches from the fastest to the slowest, typically an `LRUCache` in front of a
+// `FileCache`. Responses are written to all tiers and read from the first tier having them, the
+// faster tiers are then filled with the response found in a slower one, with its remaining TTL.
+// Responses found in other `Cache` implementations, whose remaining TTL is unknown, are not copied
+// to the faster tiers.
+type TieredCache struct {
+	tiers []Cache
+
+	hits   uint64
+	misses uint64
+	sets   uint64
+}
+
+func NewTieredCache(tiers ...Cache) *TieredCache {
+	return &TieredCache{tiers: tiers}
+}
+
+func (c *TieredCache) Set(ctx context.Context, key string, response []byte, ttl time.Duration) {
+	atomic.AddUint64(&c.sets, 1)
+
+	for _, tier := range c.tiers {
+		tier.Set(ctx, key, response, ttl)
+	}
+}
+
+func (c *TieredCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	for i, tier := range c.tiers {
+		expiring, ok := tier.(expiringCache)
+		if !ok {
+			if data, found := tier.Get(ctx, key); found {
+				atomic.AddUint64(&c.hits, 1)
+				return data, true
+			}
+			continue
+		}
+
+		data, ttl, found := expiring.getWithTTL(ctx, key)
+		if !found {
+			continue
+		}
+
+		for _, upper := range c.tiers[:i] {
+			upper.Set(ctx, key, data, ttl)
+		}
+
+		atomic.AddUint64(&c.hits, 1)
+		return data, true
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	return nil, false
+}
+
+// Delete deletes the entry from the tiers implementing `CacheDeleter`.
+func (c *TieredCache) Delete(ctx context.Context, key string) {
+	for _, tier := range c.tiers {
+		if deleter, ok := tier.(CacheDeleter); ok {
+			deleter.Delete(ctx, key)
+		}
+	}
+}
+
+// Stats returns the counters of the cache as a whole, a hit being a response found in any tier.
+// Each tier has its own counters.
+func (c *TieredCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Sets:   atomic.LoadUint64(&c.sets),
+	}
+}
@@ -15,8 +15,17 @@
 package rpc
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/streamingfast/eth-go"
 )
 
 type ErrResponse struct {
@@ -94,3 +103,187 @@ func IsParityDeterministicError(err *ErrResponse) bool {
 func IsGanacheDeterministicError(err *ErrResponse) bool {
 	return err.Code == GANACHE_VM_EXECUTION_ERROR && strings.HasPrefix(err.Message, GANACHE_REVERT_MESSAGE)
 }
+
+// Transaction pool errors returned by `eth_sendRawTransaction` are not standardized either, the
+// messages below are the ones used by Geth (and most of its forks), Erigon, Nethermind and Besu.
+
+var NONCE_TOO_LOW_ERRORS = []string{
+	"nonce too low",
+	"oldnonce",
+	"transaction nonce is too low",
+}
+
+var REPLACEMENT_UNDERPRICED_ERRORS = []string{
+	"replacement transaction underpriced",
+	"replacement underpriced",
+	"replacement fee too low",
+}
+
+var ALREADY_KNOWN_ERRORS = []string{
+	"already known",
+	"known transaction",
+	"transaction already imported",
+}
+
+// IsNonceTooLowError returns `true` if the error received from the node indicates that the
+// transaction's nonce has already been used by a mined transaction.
+func IsNonceTooLowError(err error) bool {
+	return errorMessageContainsAny(err, NONCE_TOO_LOW_ERRORS)
+}
+
+// IsReplacementUnderpricedError returns `true` if the error received from the node indicates that
+// a transaction with the same nonce is already pending and that the new one does not pay enough
+// to replace it.
+func IsReplacementUnderpricedError(err error) bool {
+	return errorMessageContainsAny(err, REPLACEMENT_UNDERPRICED_ERRORS)
+}
+
+// IsAlreadyKnownError returns `true` if the error received from the node indicates that the exact
+// same transaction is already in its transaction pool.
+func IsAlreadyKnownError(err error) bool {
+	return errorMessageContainsAny(err, ALREADY_KNOWN_ERRORS)
+}
+
+func errorMessageContainsAny(err error, candidates []string) bool {
+	if err == nil {
+		return false
+	}
+
+	var msg string
+	var rpcErr *ErrResponse
+	if errors.As(err, &rpcErr) {
+		msg = strings.ToLower(rpcErr.Message)
+	} else {
+		msg = strings.ToLower(err.Error())
+	}
+
+	for _, candidate := range candidates {
+		if strings.Contains(msg, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPStatusError is returned when the node answered with an HTTP error status, it holds the
+// response's body which usually explains the error.
+type HTTPStatusError struct {
+	StatusCode int
+	Body       []byte
+	// RetryAfter is the delay requested by the node through the `Retry-After` header, 0 if absent
+	RetryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	body := strings.TrimSpace(string(e.Body))
+	if len(body) > 256 {
+		body = body[:256] + "..."
+	}
+
+	if body == "" {
+		return fmt.Sprintf("error in response: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("error in response: %d: %s", e.StatusCode, body)
+}
+
+// LIMIT_EXCEEDED_ERROR_CODE is the JSON-RPC error code (EIP-1474) used by nodes and providers
+// when the request was rate limited.
+const LIMIT_EXCEEDED_ERROR_CODE = -32005
+
+// Transient errors returned by nodes for requests that may succeed when retried, like requests
+// for a block the node serving them has not seen yet.
+var RETRYABLE_ERRORS = []string{
+	"header not found",
+	"rate limit",
+	"too many requests",
+	"limit exceeded",
+}
+
+// IsRetryableError returns `true` if a request that failed with `err` may succeed when sent again:
+// HTTP 429 and 5xx statuses, connection failures, transient JSON-RPC errors and requests left
+// unanswered in a batch. Deterministic errors, see `IsDeterministicError`, are never retryable.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var rpcErr *ErrResponse
+	if errors.As(err, &rpcErr) {
+		if IsDeterministicError(rpcErr) {
+			return false
+		}
+
+		return rpcErr.Code == LIMIT_EXCEEDED_ERROR_CODE || errorMessageContainsAny(rpcErr, RETRYABLE_ERRORS)
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	// Providers truncating batches usually do it under load
+	if errors.Is(err, ErrMissingResponse) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+var revertErrorSelector = []byte{0x08, 0xc3, 0x79, 0xa0} // Error(string)
+var revertPanicSelector = []byte{0x4e, 0x48, 0x7b, 0x71} // Panic(uint256)
+
+// RevertData returns the revert data carried by the error when the node sent it (Geth and
+// most nodes return it as the `data` field of the error of a reverted `eth_call`).
+func (e *ErrResponse) RevertData() (eth.Hex, bool) {
+	data, ok := e.Data.(string)
+	if !ok || !eth.Has0xPrefix(data) {
+		return nil, false
+	}
+
+	out, err := eth.NewHex(data)
+	if err != nil {
+		return nil, false
+	}
+
+	return out, true
+}
+
+// DecodeRevertReason decodes the revert data returned by a reverted call when it's a standard Solidity
+// `Error(string)` or `Panic(uint256)` error, `ok` is `false` if the data is not one of those (custom
+// errors for example).
+func DecodeRevertReason(data []byte) (reason string, ok bool) {
+	if len(data) < 4 {
+		return "", false
+	}
+
+	decoder := eth.NewDecoder(data[4:])
+	switch {
+	case bytes.Equal(data[0:4], revertErrorSelector):
+		if _, err := decoder.ReadBigInt(); err != nil {
+			return "", false
+		}
+
+		reason, err := decoder.ReadString()
+		if err != nil {
+			return "", false
+		}
+
+		return reason, true
+
+	case bytes.Equal(data[0:4], revertPanicSelector):
+		code, err := decoder.ReadBigInt()
+		if err != nil {
+			return "", false
+		}
+
+		return fmt.Sprintf("panic: 0x%s", code.Text(16)), true
+	}
+
+	return "", false
+}
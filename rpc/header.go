@@ -0,0 +1,183 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/eth-go/rlp"
+)
+
+// Header is the part of a block that is hashed to form the block's hash. Fields introduced by a
+// hard fork are optional, they are part of the encoding only when set, and the fields of a given
+// hard fork can only be set if the fields of all previous ones are.
+type Header struct {
+	ParentHash       eth.Hash
+	UnclesHash       eth.Hash
+	Miner            eth.Address
+	StateRoot        eth.Hash
+	TransactionsRoot eth.Hash
+	ReceiptsRoot     eth.Hash
+	LogsBloom        []byte
+	Difficulty       *big.Int
+	Number           uint64
+	GasLimit         uint64
+	GasUsed          uint64
+	Timestamp        uint64
+	ExtraData        []byte
+	MixHash          eth.Hash
+	Nonce            []byte
+
+	// BaseFeePerGas is set since the London hard fork.
+	BaseFeePerGas *big.Int
+	// WithdrawalsRoot is set since the Shanghai hard fork.
+	WithdrawalsRoot eth.Hash
+	// BlobGasUsed, ExcessBlobGas and ParentBeaconBlockRoot are set since the Cancun hard fork.
+	BlobGasUsed           *uint64
+	ExcessBlobGas         *uint64
+	ParentBeaconBlockRoot eth.Hash
+	// RequestsHash is set since the Prague hard fork.
+	RequestsHash eth.Hash
+}
+
+// Header extracts the block's header. The base fee is considered absent, like before the London
+// hard fork, when it's `0`.
+func (b *Block) Header() *Header {
+	header := &Header{
+		ParentHash:            b.ParentHash,
+		UnclesHash:            b.UnclesSHA3,
+		Miner:                 b.Miner,
+		StateRoot:             b.StateRoot,
+		TransactionsRoot:      b.TransactionsRoot,
+		ReceiptsRoot:          b.ReceiptsRoot,
+		LogsBloom:             b.LogsBloom,
+		Difficulty:            b.Difficulty.Int(),
+		Number:                uint64(b.Number),
+		GasLimit:              uint64(b.GasLimit),
+		GasUsed:               uint64(b.GasUsed),
+		Timestamp:             uint64(time.Time(b.Timestamp).Unix()),
+		ExtraData:             b.ExtraData,
+		MixHash:               b.MixHash,
+		Nonce:                 b.Nonce,
+		WithdrawalsRoot:       b.WithdrawalsRoot,
+		ParentBeaconBlockRoot: b.ParentBeaconBlockRoot,
+		RequestsHash:          b.RequestsHash,
+	}
+
+	if b.BaseFeePerGas != 0 {
+		header.BaseFeePerGas = new(big.Int).SetUint64(uint64(b.BaseFeePerGas))
+	}
+
+	if b.BlobGasUsed != nil {
+		value := uint64(*b.BlobGasUsed)
+		header.BlobGasUsed = &value
+	}
+
+	if b.ExcessBlobGas != nil {
+		value := uint64(*b.ExcessBlobGas)
+		header.ExcessBlobGas = &value
+	}
+
+	return header
+}
+
+// RLP returns the RLP encoding of the header, the fields of each hard fork are appended after
+// the ones of the previous hard fork.
+func (h *Header) RLP() ([]byte, error) {
+	difficulty := h.Difficulty
+	if difficulty == nil {
+		difficulty = new(big.Int)
+	}
+
+	fields := []interface{}{
+		[]byte(h.ParentHash),
+		[]byte(h.UnclesHash),
+		[]byte(h.Miner),
+		[]byte(h.StateRoot),
+		[]byte(h.TransactionsRoot),
+		[]byte(h.ReceiptsRoot),
+		h.LogsBloom,
+		difficulty,
+		h.Number,
+		h.GasLimit,
+		h.GasUsed,
+		h.Timestamp,
+		h.ExtraData,
+		[]byte(h.MixHash),
+		h.Nonce,
+	}
+
+	hasCancunFields := h.BlobGasUsed != nil || h.ExcessBlobGas != nil || h.ParentBeaconBlockRoot != nil
+	hasShanghaiFields := h.WithdrawalsRoot != nil
+	hasLondonFields := h.BaseFeePerGas != nil
+
+	switch {
+	case h.RequestsHash != nil && !hasCancunFields:
+		return nil, fmt.Errorf("header has Prague fields but is missing Cancun ones")
+	case hasCancunFields && (h.BlobGasUsed == nil || h.ExcessBlobGas == nil || h.ParentBeaconBlockRoot == nil):
+		return nil, fmt.Errorf("header has only some of the Cancun fields")
+	case hasCancunFields && !hasShanghaiFields:
+		return nil, fmt.Errorf("header has Cancun fields but is missing Shanghai ones")
+	case hasShanghaiFields && !hasLondonFields:
+		return nil, fmt.Errorf("header has Shanghai fields but is missing London ones")
+	}
+
+	if hasLondonFields {
+		fields = append(fields, h.BaseFeePerGas)
+	}
+
+	if hasShanghaiFields {
+		fields = append(fields, []byte(h.WithdrawalsRoot))
+	}
+
+	if hasCancunFields {
+		fields = append(fields, *h.BlobGasUsed, *h.ExcessBlobGas, []byte(h.ParentBeaconBlockRoot))
+	}
+
+	if h.RequestsHash != nil {
+		fields = append(fields, []byte(h.RequestsHash))
+	}
+
+	return rlp.Encode(fields)
+}
+
+// Hash computes the header's hash, the Keccak-256 hash of its RLP encoding.
+func (h *Header) Hash() (eth.Hash, error) {
+	encoded, err := h.RLP()
+	if err != nil {
+		return nil, fmt.Errorf("rlp encode header: %w", err)
+	}
+
+	return eth.Keccak256(encoded), nil
+}
+
+// VerifyHash recomputes the block's hash from its header fields and returns an error if it does
+// not match `Block.Hash`, which means the node returned inconsistent data.
+func (b *Block) VerifyHash() error {
+	hash, err := b.Header().Hash()
+	if err != nil {
+		return fmt.Errorf("block #%d: %w", uint64(b.Number), err)
+	}
+
+	if !bytes.Equal(hash, b.Hash) {
+		return fmt.Errorf("block #%d: computed hash %s does not match block hash %s", uint64(b.Number), hash.Pretty(), b.Hash.Pretty())
+	}
+
+	return nil
+}
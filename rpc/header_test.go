@@ -0,0 +1,61 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The fixtures are real headers, one per header layout: mainnet's genesis (Frontier), Sepolia block
+// 175881 (London), mainnet blocks 18189758 (Shanghai) and 19431837 (Cancun) and block 141654 of a
+// Pectra devnet (Prague).
+func TestBlock_VerifyHash(t *testing.T) {
+	for _, fork := range []string{"frontier", "london", "shanghai", "cancun", "prague"} {
+		t.Run(fork, func(t *testing.T) {
+			block := readTestBlock(t, "testdata/block_header_"+fork+".json")
+			require.NoError(t, block.VerifyHash())
+
+			block.GasUsed++
+			assert.Error(t, block.VerifyHash())
+		})
+	}
+}
+
+func TestHeader_RLP_MissingForkFields(t *testing.T) {
+	block := readTestBlock(t, "testdata/block_header_prague.json")
+	block.WithdrawalsRoot = nil
+
+	_, err := block.Header().RLP()
+	assert.EqualError(t, err, "header has Cancun fields but is missing Shanghai ones")
+}
+
+func readTestBlock(t *testing.T, filename string) *Block {
+	t.Helper()
+
+	content, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+
+	block := &Block{}
+	require.NoError(t, json.Unmarshal(content, block))
+	require.NotEqual(t, eth.Hash(nil), block.Hash)
+
+	return block
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ipcMaxIdleConns is the number of idle connections kept open to the node for future requests
+const ipcMaxIdleConns = 4
+
+// IPCTransport talks to a node through its IPC endpoint, a Unix domain socket like `geth.ipc`. The
+// node exchanges JSON values written back to back, without any delimiter, so responses are framed
+// by decoding exactly one JSON value. Concurrent requests are sent on different connections.
+type IPCTransport struct {
+	Path string
+
+	lock sync.Mutex
+	idle []*ipcConn
+}
+
+type ipcConn struct {
+	net.Conn
+	decoder *json.Decoder
+}
+
+func NewIPCTransport(path string) *IPCTransport {
+	return &IPCTransport{Path: path}
+}
+
+func (t *IPCTransport) RoundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	conn, err := t.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := conn.roundTrip(ctx, request)
+	if err != nil || ctx.Err() != nil {
+		// The connection's stream state is unknown after a failure and it might have been closed
+		// by the context's cancellation, it can't be reused
+		conn.Close()
+		return response, err
+	}
+
+	t.release(conn)
+	return response, nil
+}
+
+// Close closes the idle connections, connections in use are closed once their request completes.
+func (t *IPCTransport) Close() error {
+	t.lock.Lock()
+	idle := t.idle
+	t.idle = nil
+	t.lock.Unlock()
+
+	for _, conn := range idle {
+		conn.Close()
+	}
+	return nil
+}
+
+func (t *IPCTransport) conn(ctx context.Context) (*ipcConn, error) {
+	t.lock.Lock()
+	if count := len(t.idle); count > 0 {
+		conn := t.idle[count-1]
+		t.idle = t.idle[:count-1]
+		t.lock.Unlock()
+
+		return conn, nil
+	}
+	t.lock.Unlock()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", t.Path)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", t.Path, err)
+	}
+
+	return &ipcConn{Conn: conn, decoder: json.NewDecoder(conn)}, nil
+}
+
+func (t *IPCTransport) release(conn *ipcConn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if len(t.idle) >= ipcMaxIdleConns {
+		conn.Close()
+		return
+	}
+
+	t.idle = append(t.idle, conn)
+}
+
+func (c *ipcConn) roundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	} else {
+		c.SetDeadline(time.Time{})
+	}
+
+	// Closing the connection is the only way to unblock it when the context is canceled
+	done, stopped := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-done:
+		}
+	}()
+
+	if _, err := c.Write(request); err != nil {
+		return nil, c.error(ctx, fmt.Errorf("write request: %w", err))
+	}
+
+	var response json.RawMessage
+	if err := c.decoder.Decode(&response); err != nil {
+		return nil, c.error(ctx, fmt.Errorf("read response: %w", err))
+	}
+
+	return response, nil
+}
+
+func (c *ipcConn) error(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
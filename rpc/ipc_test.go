@@ -0,0 +1,183 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPCClient(t *testing.T) {
+	path, requests := mockIPCNode(t)
+
+	client := NewClient(path)
+	ctx := context.Background()
+
+	blockNum, err := client.LatestBlockNum(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0x10), blockNum)
+
+	responses, err := client.DoRequests(ctx, []*RPCRequest{
+		{Method: "eth_blockNumber", Params: []interface{}{}},
+		{Method: "eth_chainId", Params: []interface{}{}},
+	})
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	assert.Equal(t, "0x10", responses[0].Content)
+	assert.Equal(t, "0x1", responses[1].Content)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			out, err := client.DoRequest(ctx, "eth_chainId", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "0x1", out)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 12, requests())
+}
+
+func TestIPCClient_Cache(t *testing.T) {
+	path, requests := mockIPCNode(t)
+
+	client := NewClient(path, WithCache(&memoryTestCache{entries: map[string][]byte{}}))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		out, err := client.DoRequest(ctx, "eth_chainId", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "0x1", out)
+	}
+
+	assert.Equal(t, 1, requests())
+}
+
+func TestIPCTransport_Unreachable(t *testing.T) {
+	_, err := NewIPCTransport(filepath.Join(t.TempDir(), "missing.ipc")).RoundTrip(context.Background(), []byte(`{}`))
+	assert.Error(t, err)
+}
+
+type memoryTestCache struct {
+	lock    sync.Mutex
+	entries map[string][]byte
+	ttls    map[string]time.Duration
+}
+
+func (c *memoryTestCache) Set(ctx context.Context, key string, response []byte, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[key] = response
+	if c.ttls == nil {
+		c.ttls = map[string]time.Duration{}
+	}
+	c.ttls[key] = ttl
+}
+
+func (c *memoryTestCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	data, found := c.entries[key]
+	return data, found
+}
+
+// mockIPCNode serves `eth_blockNumber` and `eth_chainId` on a Unix socket, writing responses back
+// to back without delimiters and split in two writes like a node could. It returns the socket's path
+// and a function returning the number of payloads received.
+func mockIPCNode(t *testing.T) (path string, requests func() int) {
+	dir, err := ioutil.TempDir("", "ipc")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path = filepath.Join(dir, "node.ipc")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	var lock sync.Mutex
+	var count int
+
+	respond := func(request map[string]interface{}) interface{} {
+		results := map[string]string{"eth_blockNumber": "0x10", "eth_chainId": "0x1"}
+		return map[string]interface{}{"jsonrpc": "2.0", "id": request["id"], "result": results[request["method"].(string)]}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				decoder := json.NewDecoder(conn)
+				for {
+					var payload json.RawMessage
+					if err := decoder.Decode(&payload); err != nil {
+						return
+					}
+
+					lock.Lock()
+					count++
+					lock.Unlock()
+
+					var response interface{}
+					if payload[0] == '[' {
+						var batch []map[string]interface{}
+						json.Unmarshal(payload, &batch)
+
+						var responses []interface{}
+						for _, request := range batch {
+							responses = append(responses, respond(request))
+						}
+						response = responses
+					} else {
+						var request map[string]interface{}
+						json.Unmarshal(payload, &request)
+						response = respond(request)
+					}
+
+					out, _ := json.Marshal(response)
+					conn.Write(out[:len(out)/2])
+					if _, err := conn.Write(out[len(out)/2:]); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return path, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return count
+	}
+}
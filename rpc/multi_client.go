@@ -0,0 +1,441 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type SelectionStrategy uint8
+
+const (
+	// SelectRoundRobin sends requests to each healthy endpoint in turn.
+	SelectRoundRobin SelectionStrategy = iota
+	// SelectWeighted sends requests to healthy endpoints randomly, proportionally to their weight.
+	SelectWeighted
+	// SelectLowestLatency sends requests to the healthy endpoint that answered the fastest recently.
+	SelectLowestLatency
+)
+
+func (s SelectionStrategy) String() string {
+	switch s {
+	case SelectRoundRobin:
+		return "RoundRobin"
+	case SelectWeighted:
+		return "Weighted"
+	case SelectLowestLatency:
+		return "LowestLatency"
+	default:
+		return "Unknown"
+	}
+}
+
+// MultiClientEndpoint is one of the endpoints used by a `MultiClient`.
+type MultiClientEndpoint struct {
+	// Client reaches the endpoint, create it with `NewClient` and the options specific to the endpoint.
+	// Its transport, rate limiter, auto batching and retry policy (for transport errors) are used,
+	// caching and retries of JSON-RPC errors are done on top of the endpoints, see `WithMultiClientOptions`.
+	Client *Client
+	// Weight is the share of requests sent to the endpoint with `SelectWeighted`, `0` is treated like `1`.
+	Weight int
+}
+
+// EndpointStatus is the state of a `MultiClient` endpoint as of its last health check and requests.
+type EndpointStatus struct {
+	URL     string
+	Healthy bool
+	// Head is the latest block number reported by the endpoint on its last health check.
+	Head uint64
+	// Latency is the moving average of the endpoint's response time.
+	Latency time.Duration
+	// LastError is the error of the last failed health check or request, `nil` once healthy again.
+	LastError error
+}
+
+type MultiClientOption func(*MultiClient)
+
+// WithSelectionStrategy sets how the endpoint receiving a request is selected, defaults to `SelectRoundRobin`.
+func WithSelectionStrategy(strategy SelectionStrategy) MultiClientOption {
+	return func(c *MultiClient) {
+		c.transport.strategy = strategy
+	}
+}
+
+// WithHealthCheckInterval enables the periodic health checks of the endpoints, see `MultiClient.CheckHealth`.
+func WithHealthCheckInterval(interval time.Duration) MultiClientOption {
+	return func(c *MultiClient) {
+		c.healthCheckInterval = interval
+	}
+}
+
+// WithEjectionCooldown sets for how long an endpoint is ejected after a request to it failed,
+// defaults to 30 seconds.
+func WithEjectionCooldown(cooldown time.Duration) MultiClientOption {
+	return func(c *MultiClient) {
+		c.transport.ejectionCooldown = cooldown
+	}
+}
+
+// WithMaxBlockLag sets by how many blocks an endpoint's head can be behind the highest head of all
+// endpoints before the endpoint is ejected, defaults to 5.
+func WithMaxBlockLag(blocks uint64) MultiClientOption {
+	return func(c *MultiClient) {
+		c.maxBlockLag = blocks
+	}
+}
+
+// WithMultiClientOptions sets options of the client performing the requests on top of the
+// endpoints, like `WithCache` or `WithRetryPolicy`.
+func WithMultiClientOptions(opts ...Option) MultiClientOption {
+	return func(c *MultiClient) {
+		c.clientOptions = append(c.clientOptions, opts...)
+	}
+}
+
+// MultiClient spreads requests over multiple endpoints, typically different providers, and fails
+// over to the next endpoint when one fails at the transport level (connection errors, HTTP error
+// statuses), JSON-RPC errors are returned as is. It has the same methods as `Client`, except for
+// subscriptions which require a single streaming endpoint.
+//
+// An endpoint whose request failed is ejected for a cooldown (see `WithEjectionCooldown`) or until a
+// later request to it succeeds. Endpoints are also checked periodically when `WithHealthCheckInterval`
+// is used, an endpoint that fails its check, is syncing or lags behind the highest head of all
+// endpoints is ejected until a later check succeeds. Ejected endpoints are only used when no
+// healthy one is left.
+type MultiClient struct {
+	*Client
+
+	transport           *multiTransport
+	clientOptions       []Option
+	healthCheckInterval time.Duration
+	maxBlockLag         uint64
+
+	closeOnce sync.Once
+	closing   chan struct{}
+}
+
+func NewMultiClient(endpoints []*MultiClientEndpoint, opts ...MultiClientOption) *MultiClient {
+	transport := &multiTransport{ejectionCooldown: 30 * time.Second}
+	for _, endpoint := range endpoints {
+		weight := endpoint.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+
+		transport.endpoints = append(transport.endpoints, &multiEndpoint{client: endpoint.Client, weight: weight, healthy: true})
+	}
+
+	c := &MultiClient{
+		transport:   transport,
+		maxBlockLag: 5,
+		closing:     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.Client = NewClient("", append([]Option{WithTransport(transport)}, c.clientOptions...)...)
+
+	if c.healthCheckInterval > 0 {
+		go c.checkHealthPeriodically()
+	}
+
+	return c
+}
+
+// Endpoints returns the current status of each endpoint, in the order they were given.
+func (c *MultiClient) Endpoints() []EndpointStatus {
+	out := make([]EndpointStatus, len(c.transport.endpoints))
+	for i, endpoint := range c.transport.endpoints {
+		out[i] = endpoint.status()
+	}
+
+	return out
+}
+
+// CheckHealth checks all endpoints concurrently, an endpoint is healthy if it answers `eth_syncing`
+// with `false` and its `eth_blockNumber` is at most the maximum lag behind the highest one.
+func (c *MultiClient) CheckHealth(ctx context.Context) {
+	heads := make([]uint64, len(c.transport.endpoints))
+	errs := make([]error, len(c.transport.endpoints))
+
+	var wg sync.WaitGroup
+	for i, endpoint := range c.transport.endpoints {
+		wg.Add(1)
+		go func(i int, endpoint *multiEndpoint) {
+			defer wg.Done()
+			heads[i], errs[i] = endpoint.check(ctx)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	var highest uint64
+	for i := range heads {
+		if errs[i] == nil && heads[i] > highest {
+			highest = heads[i]
+		}
+	}
+
+	for i, endpoint := range c.transport.endpoints {
+		err := errs[i]
+		if err == nil && heads[i]+c.maxBlockLag < highest {
+			err = fmt.Errorf("lagging %d blocks behind highest head #%d", highest-heads[i], highest)
+		}
+
+		endpoint.setHealth(heads[i], err)
+	}
+}
+
+// Close stops the health checks and closes the endpoints' clients.
+func (c *MultiClient) Close() error {
+	c.closeOnce.Do(func() { close(c.closing) })
+
+	var errs []error
+	for _, endpoint := range c.transport.endpoints {
+		if err := endpoint.client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func (c *MultiClient) checkHealthPeriodically() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), c.healthCheckInterval)
+		c.CheckHealth(ctx)
+		cancel()
+
+		select {
+		case <-c.closing:
+			return
+		case <-time.After(c.healthCheckInterval):
+		}
+	}
+}
+
+type multiEndpoint struct {
+	client *Client
+	weight int
+
+	lock sync.Mutex
+	// healthy is the result of the last health check
+	healthy bool
+	// ejectedUntil is set when a request failed, the endpoint is not used before unless no other is left
+	ejectedUntil time.Time
+	head         uint64
+	latency      time.Duration
+	lastError    error
+}
+
+func (e *multiEndpoint) status() EndpointStatus {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return EndpointStatus{URL: e.client.URL, Healthy: e.isHealthyLocked(), Head: e.head, Latency: e.latency, LastError: e.lastError}
+}
+
+func (e *multiEndpoint) check(ctx context.Context) (head uint64, err error) {
+	start := time.Now()
+	syncing, err := e.client.Syncing(ctx)
+	if err == nil {
+		return 0, fmt.Errorf("syncing, at block #%d of #%d", syncing.CurrentBlockNum, syncing.HighestBlockNum)
+	}
+	if !errors.Is(err, ErrFalseResp) {
+		return 0, err
+	}
+	e.observeLatency(time.Since(start))
+
+	return e.client.LatestBlockNum(ctx)
+}
+
+func (e *multiEndpoint) setHealth(head uint64, err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.healthy != (err == nil) {
+		zlog.Info("endpoint health changed", zap.String("url", e.client.URL), zap.Bool("healthy", err == nil), zap.Error(err))
+	}
+
+	e.healthy = err == nil
+	e.lastError = err
+	if head > 0 {
+		e.head = head
+	}
+}
+
+func (e *multiEndpoint) failed(err error, cooldown time.Duration) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.isHealthyLocked() {
+		zlog.Info("endpoint ejected after request failure", zap.String("url", e.client.URL), zap.Duration("cooldown", cooldown), zap.Error(err))
+	}
+
+	e.ejectedUntil = time.Now().Add(cooldown)
+	e.lastError = err
+}
+
+// succeeded ends the ejection following a failed request, the endpoint answers again.
+func (e *multiEndpoint) succeeded(latency time.Duration) {
+	e.observeLatency(latency)
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if !e.ejectedUntil.IsZero() {
+		e.ejectedUntil = time.Time{}
+		if e.healthy {
+			e.lastError = nil
+		}
+	}
+}
+
+// observeLatency updates the exponential moving average of the endpoint's latency.
+func (e *multiEndpoint) observeLatency(latency time.Duration) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.latency == 0 {
+		e.latency = latency
+		return
+	}
+
+	e.latency = (4*e.latency + latency) / 5
+}
+
+func (e *multiEndpoint) isHealthy() bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.isHealthyLocked()
+}
+
+func (e *multiEndpoint) isHealthyLocked() bool {
+	return e.healthy && !time.Now().Before(e.ejectedUntil)
+}
+
+func (e *multiEndpoint) currentLatency() time.Duration {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.latency
+}
+
+type multiTransport struct {
+	endpoints        []*multiEndpoint
+	strategy         SelectionStrategy
+	ejectionCooldown time.Duration
+	next             uint64
+}
+
+func (t *multiTransport) RoundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	var errs []string
+	var lastErr error
+	var lastURL string
+	for _, endpoint := range t.candidates() {
+		start := time.Now()
+		response, err := endpoint.client.sendRaw(ctx, request)
+		if err == nil {
+			endpoint.succeeded(time.Since(start))
+			return response, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		endpoint.failed(err, t.ejectionCooldown)
+		if lastErr != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s; ", lastURL, lastErr))
+		}
+		lastErr, lastURL = err, endpoint.client.URL
+	}
+
+	if lastErr == nil {
+		return nil, fmt.Errorf("no endpoint configured")
+	}
+
+	// Only the last error is wrapped, the others are kept in the message
+	return nil, fmt.Errorf("all endpoints failed: %s%s: %w", strings.Join(errs, ""), lastURL, lastErr)
+}
+
+// candidates returns the endpoints in the order they should be tried, healthy ones first following
+// the selection strategy then ejected ones as a last resort.
+func (t *multiTransport) candidates() []*multiEndpoint {
+	var healthy, ejected []*multiEndpoint
+	for _, endpoint := range t.endpoints {
+		if endpoint.isHealthy() {
+			healthy = append(healthy, endpoint)
+		} else {
+			ejected = append(ejected, endpoint)
+		}
+	}
+
+	if len(healthy) > 1 {
+		switch t.strategy {
+		case SelectRoundRobin:
+			offset := int(atomic.AddUint64(&t.next, 1)-1) % len(healthy)
+			healthy = append(healthy[offset:], healthy[:offset]...)
+		case SelectWeighted:
+			healthy = weightedOrder(healthy)
+		case SelectLowestLatency:
+			sort.SliceStable(healthy, func(i, j int) bool {
+				return healthy[i].currentLatency() < healthy[j].currentLatency()
+			})
+		}
+	}
+
+	return append(healthy, ejected...)
+}
+
+// weightedOrder draws the endpoints randomly one after the other, proportionally to their weight.
+func weightedOrder(endpoints []*multiEndpoint) []*multiEndpoint {
+	remaining := append([]*multiEndpoint(nil), endpoints...)
+	out := make([]*multiEndpoint, 0, len(endpoints))
+
+	for len(remaining) > 0 {
+		total := 0
+		for _, endpoint := range remaining {
+			total += endpoint.weight
+		}
+
+		draw := rand.Intn(total)
+		for i, endpoint := range remaining {
+			if draw < endpoint.weight {
+				out = append(out, endpoint)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+			draw -= endpoint.weight
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,233 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiClient_RoundRobin(t *testing.T) {
+	servers, endpoints := mockMultiClientEndpoints(t, "0x20", "0x20", "0x20")
+	client := NewMultiClient(endpoints)
+	defer client.Close()
+
+	for i := 0; i < 6; i++ {
+		out, err := client.DoRequest(context.Background(), "eth_chainId", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "0x1", out)
+	}
+
+	for _, server := range servers {
+		assert.Equal(t, 2, server.Count("eth_chainId"))
+	}
+}
+
+func TestMultiClient_Failover(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	servers, endpoints := mockMultiClientEndpoints(t, "0x20")
+	endpoints = append([]*MultiClientEndpoint{{Client: NewClient(failing.URL)}}, endpoints...)
+
+	client := NewMultiClient(endpoints)
+	defer client.Close()
+
+	for i := 0; i < 4; i++ {
+		blockNum, err := client.LatestBlockNum(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0x20), blockNum)
+	}
+
+	assert.Equal(t, 4, servers[0].Count("eth_blockNumber"))
+
+	statuses := client.Endpoints()
+	assert.False(t, statuses[0].Healthy)
+	assert.Equal(t, &HTTPStatusError{StatusCode: 503, Body: []byte{}}, statuses[0].LastError)
+	assert.True(t, statuses[1].Healthy)
+}
+
+func TestMultiClient_AllFailed(t *testing.T) {
+	badGateway := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer badGateway.Close()
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	client := NewMultiClient([]*MultiClientEndpoint{{Client: NewClient(badGateway.URL)}, {Client: NewClient(unavailable.URL)}})
+	defer client.Close()
+
+	_, err := client.LatestBlockNum(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), badGateway.URL+": error in response: 502")
+	assert.Contains(t, err.Error(), unavailable.URL+": error in response: 503")
+
+	var statusErr *HTTPStatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+	assert.True(t, IsRetryableError(err))
+}
+
+func TestMultiClient_EjectionCooldown(t *testing.T) {
+	var failures int32 = 1
+	flaky := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x20"}`))
+	}))
+	defer flaky.Close()
+
+	servers, endpoints := mockMultiClientEndpoints(t, "0x20")
+	endpoints = append([]*MultiClientEndpoint{{Client: NewClient(flaky.URL)}}, endpoints...)
+
+	client := NewMultiClient(endpoints, WithEjectionCooldown(50*time.Millisecond))
+	defer client.Close()
+
+	_, err := client.LatestBlockNum(context.Background())
+	require.NoError(t, err)
+	assert.False(t, client.Endpoints()[0].Healthy)
+
+	_, err = client.LatestBlockNum(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, servers[0].Count("eth_blockNumber"))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, client.Endpoints()[0].Healthy)
+
+	for i := 0; i < 2; i++ {
+		_, err = client.LatestBlockNum(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, servers[0].Count("eth_blockNumber"))
+	assert.True(t, client.Endpoints()[0].Healthy)
+	assert.NoError(t, client.Endpoints()[0].LastError)
+}
+
+func TestMultiClient_EndpointRetryPolicy(t *testing.T) {
+	var requests int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x20"}`))
+	}))
+	defer flaky.Close()
+
+	servers, endpoints := mockMultiClientEndpoints(t, "0x20")
+	endpoints = append([]*MultiClientEndpoint{{Client: NewClient(flaky.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}))}}, endpoints...)
+
+	client := NewMultiClient(endpoints)
+	defer client.Close()
+
+	blockNum, err := client.LatestBlockNum(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0x20), blockNum)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Equal(t, 0, servers[0].Count("eth_blockNumber"))
+	assert.True(t, client.Endpoints()[0].Healthy)
+}
+
+func TestMultiClient_CheckHealth(t *testing.T) {
+	servers, endpoints := mockMultiClientEndpoints(t, "0x20", "0x1e", "0x10")
+
+	syncing, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_blockNumber": "0x20",
+		"eth_syncing":     map[string]interface{}{"startingBlock": "0x0", "currentBlock": "0x20", "highestBlock": "0x40"},
+		"eth_chainId":     "0x1",
+	})
+	defer closer()
+
+	servers = append(servers, syncing)
+	endpoints = append(endpoints, &MultiClientEndpoint{Client: NewClient(syncing.URL)})
+
+	client := NewMultiClient(endpoints, WithMaxBlockLag(5))
+	defer client.Close()
+
+	client.CheckHealth(context.Background())
+
+	var healthy []bool
+	var heads []uint64
+	for _, status := range client.Endpoints() {
+		healthy = append(healthy, status.Healthy)
+		heads = append(heads, status.Head)
+	}
+
+	assert.Equal(t, []bool{true, true, false, false}, healthy)
+	assert.Equal(t, []uint64{0x20, 0x1e, 0x10, 0}, heads)
+
+	// Ejected endpoints receive no requests while healthy ones remain
+	for i := 0; i < 4; i++ {
+		_, err := client.DoRequest(context.Background(), "eth_chainId", nil)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []int{2, 2, 0, 0}, []int{servers[0].Count("eth_chainId"), servers[1].Count("eth_chainId"), servers[2].Count("eth_chainId"), servers[3].Count("eth_chainId")})
+}
+
+func TestMultiClient_Selection(t *testing.T) {
+	first := &multiEndpoint{client: NewClient("first"), weight: 9, healthy: true}
+	second := &multiEndpoint{client: NewClient("second"), weight: 1, healthy: true}
+	ejected := &multiEndpoint{client: NewClient("ejected"), weight: 1}
+
+	first.observeLatency(30 * time.Millisecond)
+	second.observeLatency(10 * time.Millisecond)
+	ejected.observeLatency(time.Millisecond)
+
+	transport := &multiTransport{endpoints: []*multiEndpoint{first, second, ejected}, strategy: SelectLowestLatency}
+	assert.Equal(t, []*multiEndpoint{second, first, ejected}, transport.candidates())
+
+	transport.strategy = SelectWeighted
+	picks := map[*multiEndpoint]int{}
+	for i := 0; i < 500; i++ {
+		candidates := transport.candidates()
+		require.Len(t, candidates, 3)
+		assert.Equal(t, ejected, candidates[2])
+		picks[candidates[0]]++
+	}
+	assert.Greater(t, picks[first], 3*picks[second])
+}
+
+func mockMultiClientEndpoints(t *testing.T, heads ...string) (servers []*mockJSONRPCMethodsServer, endpoints []*MultiClientEndpoint) {
+	for _, head := range heads {
+		server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+			"eth_blockNumber": head,
+			"eth_syncing":     false,
+			"eth_chainId":     "0x1",
+		})
+		t.Cleanup(closer)
+
+		servers = append(servers, server)
+		endpoints = append(endpoints, &MultiClientEndpoint{Client: NewClient(server.URL)})
+	}
+
+	return
+}
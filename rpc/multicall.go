@@ -0,0 +1,425 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/streamingfast/eth-go"
+	"go.uber.org/zap"
+)
+
+// Multicall3Address is the address of the Multicall3 contract, deployed at the same address on
+// most EVM chains, see https://github.com/mds1/multicall.
+var Multicall3Address = eth.MustNewAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// aggregate3Selector is the method ID of `aggregate3((address,bool,bytes)[])`.
+var aggregate3Selector = eth.Keccak256([]byte("aggregate3((address,bool,bytes)[])"))[0:4]
+
+// Errors returned by nodes and providers for `eth_call` requests that need too much gas or have
+// too much calldata, a multicall failing with one of them is split in smaller ones.
+var MULTICALL_LIMIT_ERRORS = []string{
+	"out of gas",
+	"gas required exceeds",
+	"exceeds block gas limit",
+	"too large",
+	"oversized",
+}
+
+// RequireSuccess makes the whole multicall containing the call fail when the call fails, by
+// default a failed call only fails its own result.
+func RequireSuccess() ETHCallOption {
+	return func(c *ETHCall) {
+		c.requireSuccess = true
+	}
+}
+
+type MulticallOption func(*multicall)
+
+// WithMulticallAddress sets the address of the Multicall3 contract, defaults to `Multicall3Address`.
+func WithMulticallAddress(address eth.Address) MulticallOption {
+	return func(m *multicall) {
+		m.address = address
+	}
+}
+
+// WithMaxCalldataSize sets the maximum size in bytes of the calldata of one multicall, calls are
+// split in multiple multicalls above it, defaults to 64 KiB.
+func WithMaxCalldataSize(size int) MulticallOption {
+	return func(m *multicall) {
+		m.maxCalldataSize = size
+	}
+}
+
+// WithMulticallGasLimit sets the gas limit of each multicall, defaults to the node's limit for
+// `eth_call`.
+func WithMulticallGasLimit(gasLimit uint64) MulticallOption {
+	return func(m *multicall) {
+		m.gasLimit = gasLimit
+	}
+}
+
+type multicall struct {
+	client          *Client
+	address         eth.Address
+	maxCalldataSize int
+	gasLimit        uint64
+}
+
+// Multicall performs `calls` through the Multicall3 contract's `aggregate3` method, packing many
+// calls in a single `eth_call`. Calls are grouped by the block they are performed at and split in
+// multiple multicalls when their calldata exceeds the maximum size, or when the node rejects a
+// multicall because it needs too much gas or is too big.
+//
+// The responses are in the order of `calls` and behave like the ones of `DoRequests` for the same
+// calls: each one can be decoded through its call's `ResponseDecoder` and a failed call has an
+// `*ErrResponse` like the node's for a reverted `eth_call`, with the revert data. The calls are
+// performed by the Multicall3 contract, `msg.sender` is the contract and only the target and
+// calldata of the calls are used.
+//
+// An error is returned when a multicall could not be performed at all, a multicall rejected by the
+// node fails the results of all its calls with the node's error instead.
+func (c *Client) Multicall(ctx context.Context, calls []*ETHCall, opts ...MulticallOption) ([]*RPCResponse, error) {
+	m := &multicall{
+		client:          c,
+		address:         Multicall3Address,
+		maxCalldataSize: 64 * 1024,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	chunks, err := m.chunks(calls)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*RPCResponse, len(calls))
+	for i, call := range calls {
+		out[i] = &RPCResponse{ID: i + 1, decoder: call.responseDecoder}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(chunks))
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk *multicallChunk) {
+			defer wg.Done()
+			errs[i] = m.perform(ctx, chunk, out)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+type multicallChunk struct {
+	atExpr interface{}
+	// indexes are the positions of the chunk's calls in the calls given to `Multicall`
+	indexes  []int
+	calldata [][]byte
+	calls    []*ETHCall
+}
+
+// chunks groups the calls by block, in the order of their first call, then splits each group in
+// chunks not exceeding the maximum calldata size.
+func (m *multicall) chunks(calls []*ETHCall) ([]*multicallChunk, error) {
+	var blocks []string
+	groups := map[string][]int{}
+	for i, call := range calls {
+		block, err := MarshalJSONRPC(call.atExpr)
+		if err != nil {
+			return nil, fmt.Errorf("call %d: invalid block: %w", i, err)
+		}
+
+		key := string(block)
+		if _, found := groups[key]; !found {
+			blocks = append(blocks, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	var out []*multicallChunk
+	for _, block := range blocks {
+		var current *multicallChunk
+		var size int
+		for _, index := range groups[block] {
+			calldata, err := multicallCalldata(calls[index].params.Data)
+			if err != nil {
+				return nil, fmt.Errorf("call %d: %w", index, err)
+			}
+
+			callSize := aggregate3CallSize(calldata)
+			if current == nil || (len(current.indexes) > 0 && size+callSize > m.maxCalldataSize) {
+				current = &multicallChunk{atExpr: calls[index].atExpr}
+				size = 4 + 2*32
+				out = append(out, current)
+			}
+
+			current.indexes = append(current.indexes, index)
+			current.calldata = append(current.calldata, calldata)
+			current.calls = append(current.calls, calls[index])
+			size += callSize
+		}
+	}
+
+	return out, nil
+}
+
+// perform sends the chunk's multicall and fills the responses of its calls in `out`, splitting the
+// chunk in two when the node rejects it for exceeding its limits.
+func (m *multicall) perform(ctx context.Context, chunk *multicallChunk, out []*RPCResponse) error {
+	params := CallParams{
+		To:       m.address,
+		GasLimit: m.gasLimit,
+		Data:     encodeAggregate3(chunk.calls, chunk.calldata),
+	}
+
+	result, err := m.client.DoRequest(ctx, "eth_call", []interface{}{params, chunk.atExpr})
+	if err != nil {
+		if len(chunk.indexes) > 1 && isMulticallLimitError(err) {
+			zlog.Debug("splitting multicall exceeding the node's limits", zap.Int("calls", len(chunk.indexes)), zap.Error(err))
+
+			half := len(chunk.indexes) / 2
+			for _, part := range []*multicallChunk{
+				{atExpr: chunk.atExpr, indexes: chunk.indexes[:half], calldata: chunk.calldata[:half], calls: chunk.calls[:half]},
+				{atExpr: chunk.atExpr, indexes: chunk.indexes[half:], calldata: chunk.calldata[half:], calls: chunk.calls[half:]},
+			} {
+				if err := m.perform(ctx, part, out); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		var rpcErr *ErrResponse
+		if !errors.As(err, &rpcErr) {
+			return fmt.Errorf("multicall: %w", err)
+		}
+
+		for _, index := range chunk.indexes {
+			out[index].Err = rpcErr
+		}
+		return nil
+	}
+
+	data, err := eth.NewHex(result)
+	if err != nil {
+		return fmt.Errorf("multicall: invalid result: %w", err)
+	}
+
+	results, err := decodeAggregate3Results(data)
+	if err != nil {
+		return fmt.Errorf("multicall: %w", err)
+	}
+
+	if len(results) != len(chunk.indexes) {
+		return fmt.Errorf("multicall: received %d results for %d calls", len(results), len(chunk.indexes))
+	}
+
+	for i, index := range chunk.indexes {
+		if results[i].success {
+			out[index].Content = eth.Hex(results[i].returnData).Pretty()
+		} else {
+			out[index].Err = multicallRevertError(results[i].returnData)
+		}
+	}
+
+	return nil
+}
+
+// multicallRevertError turns the data returned by a failed call into the error returned by Geth
+// for the same reverted `eth_call`.
+func multicallRevertError(data []byte) *ErrResponse {
+	err := &ErrResponse{Code: 3, Message: "execution reverted", Data: eth.Hex(data).Pretty()}
+	if reason, ok := DecodeRevertReason(data); ok {
+		err.Message += ": " + reason
+	}
+
+	return err
+}
+
+func isMulticallLimitError(err error) bool {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusRequestEntityTooLarge
+	}
+
+	var rpcErr *ErrResponse
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+
+	msg := strings.ToLower(rpcErr.Message)
+	for _, candidate := range MULTICALL_LIMIT_ERRORS {
+		if strings.Contains(msg, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func multicallCalldata(data interface{}) ([]byte, error) {
+	switch v := data.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case eth.Hex:
+		return v, nil
+	case *eth.MethodCall:
+		return v.Encode()
+	default:
+		return nil, fmt.Errorf("unsupported call data type %T", data)
+	}
+}
+
+// aggregate3CallSize is the size of a `(address,bool,bytes)` call in the `aggregate3` calldata,
+// its offset included.
+func aggregate3CallSize(calldata []byte) int {
+	return 32 + 4*32 + abiPaddedLength(len(calldata))
+}
+
+func encodeAggregate3(calls []*ETHCall, calldata [][]byte) []byte {
+	out := append([]byte{}, aggregate3Selector...)
+	out = append(out, abiWord(32)...)
+	out = append(out, abiWord(uint64(len(calls)))...)
+
+	// Offsets of the dynamic tuples are relative to the start of the array's content
+	offset := uint64(32 * len(calls))
+	for _, data := range calldata {
+		out = append(out, abiWord(offset)...)
+		offset += uint64(4*32 + abiPaddedLength(len(data)))
+	}
+
+	for i, call := range calls {
+		target := make([]byte, 32)
+		copy(target[12:], call.params.To)
+		out = append(out, target...)
+
+		allowFailure := uint64(1)
+		if call.requireSuccess {
+			allowFailure = 0
+		}
+		out = append(out, abiWord(allowFailure)...)
+		out = append(out, abiWord(3*32)...)
+		out = append(out, abiWord(uint64(len(calldata[i])))...)
+		out = append(out, calldata[i]...)
+		out = append(out, make([]byte, abiPaddedLength(len(calldata[i]))-len(calldata[i]))...)
+	}
+
+	return out
+}
+
+type aggregate3Result struct {
+	success    bool
+	returnData []byte
+}
+
+// decodeAggregate3Results decodes the `(bool,bytes)[]` returned by `aggregate3`.
+func decodeAggregate3Results(data []byte) ([]aggregate3Result, error) {
+	arrayOffset, err := abiReadWord(data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := abiReadWord(data, arrayOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	content := arrayOffset + 32
+	if count > uint64(len(data))/32 {
+		return nil, fmt.Errorf("invalid results count %d", count)
+	}
+
+	out := make([]aggregate3Result, count)
+	for i := uint64(0); i < count; i++ {
+		tupleOffset, err := abiReadWord(data, content+32*i)
+		if err != nil {
+			return nil, err
+		}
+		tuple := content + tupleOffset
+		if tuple < content {
+			return nil, fmt.Errorf("result %d: tuple offset %d out of bounds", i, tupleOffset)
+		}
+
+		success, err := abiReadWord(data, tuple)
+		if err != nil {
+			return nil, err
+		}
+
+		bytesOffset, err := abiReadWord(data, tuple+32)
+		if err != nil {
+			return nil, err
+		}
+
+		if tuple+bytesOffset < tuple {
+			return nil, fmt.Errorf("result %d: return data offset %d out of bounds", i, bytesOffset)
+		}
+
+		length, err := abiReadWord(data, tuple+bytesOffset)
+		if err != nil {
+			return nil, err
+		}
+
+		start := tuple + bytesOffset + 32
+		if start+length < start || start+length > uint64(len(data)) {
+			return nil, fmt.Errorf("result %d: return data out of bounds", i)
+		}
+
+		out[i] = aggregate3Result{success: success == 1, returnData: data[start : start+length]}
+	}
+
+	return out, nil
+}
+
+func abiWord(value uint64) []byte {
+	out := make([]byte, 32)
+	binary.BigEndian.PutUint64(out[24:], value)
+	return out
+}
+
+func abiReadWord(data []byte, offset uint64) (uint64, error) {
+	if offset+32 < offset || offset+32 > uint64(len(data)) {
+		return 0, fmt.Errorf("offset %d out of bounds", offset)
+	}
+
+	word := data[offset : offset+32]
+	for _, b := range word[:24] {
+		if b != 0 {
+			return 0, fmt.Errorf("value at offset %d overflows uint64", offset)
+		}
+	}
+
+	return binary.BigEndian.Uint64(word[24:]), nil
+}
+
+func abiPaddedLength(length int) int {
+	return (length + 31) / 32 * 32
+}
@@ -0,0 +1,239 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testTokenA = eth.MustNewAddress("0x5a0b54d5dc17e0aadc383d2db43b0a0d3e029c4c")
+	testTokenB = eth.MustNewAddress("0x6b175474e89094c44da98b954eedeac495271d0f")
+
+	decimalsMethod = eth.MustNewMethodDef("decimals() (uint8)")
+	// revertData is `Error("not supported")`
+	revertData = eth.MustNewHex("0x08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000d6e6f7420737570706f72746564000000000000000000000000000000000000")
+)
+
+func TestAggregate3Selector(t *testing.T) {
+	assert.Equal(t, "82ad56cb", eth.Hex(aggregate3Selector).String())
+}
+
+func TestEncodeAggregate3(t *testing.T) {
+	calls := []*ETHCall{
+		NewETHCall(testTokenA, decimalsMethod),
+		NewETHCall(testTokenB, decimalsMethod, RequireSuccess()),
+	}
+	calldata := [][]byte{decimalsMethod.NewCall().MustEncode(), bytes.Repeat([]byte{0xff}, 33)}
+
+	encoded := encodeAggregate3(calls, calldata)
+	assert.Len(t, encoded, 4+2*32+aggregate3CallSize(calldata[0])+aggregate3CallSize(calldata[1]))
+
+	decoded := decodeTestAggregate3Calls(t, encoded)
+	require.Len(t, decoded, 2)
+	assert.Equal(t, testAggregate3Call{testTokenA, true, calldata[0]}, decoded[0])
+	assert.Equal(t, testAggregate3Call{testTokenB, false, calldata[1]}, decoded[1])
+}
+
+func TestDecodeAggregate3Results(t *testing.T) {
+	results := []aggregate3Result{{true, []byte{0x01, 0x02}}, {false, revertData}, {true, nil}}
+
+	decoded, err := decodeAggregate3Results(encodeTestAggregate3Results(results))
+	require.NoError(t, err)
+	assert.Equal(t, results[0], decoded[0])
+	assert.Equal(t, results[1], decoded[1])
+	assert.True(t, decoded[2].success)
+	assert.Len(t, decoded[2].returnData, 0)
+
+	_, err = decodeAggregate3Results([]byte{0x00})
+	assert.Error(t, err)
+
+	words := func(values ...uint64) (out []byte) {
+		for _, value := range values {
+			out = append(out, abiWord(value)...)
+		}
+		return
+	}
+
+	// Offsets wrapping around to earlier words of the encoding
+	_, err = decodeAggregate3Results(words(32, 1, math.MaxUint64-31, 1, 64, 0))
+	assert.EqualError(t, err, "result 0: tuple offset 18446744073709551584 out of bounds")
+
+	_, err = decodeAggregate3Results(words(32, 1, 32, 1, math.MaxUint64-31, 0))
+	assert.EqualError(t, err, "result 0: return data offset 18446744073709551584 out of bounds")
+}
+
+func TestClient_Multicall(t *testing.T) {
+	var calls []int
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_call": mockMulticall(t, &calls, 0),
+	})
+	defer closer()
+
+	client := NewClient(server.URL)
+	responses, err := client.Multicall(context.Background(), []*ETHCall{
+		NewETHCall(testTokenA, decimalsMethod),
+		NewETHCall(testTokenB, decimalsMethod),
+		NewETHCall(testTokenA, decimalsMethod, AtBlockNum(10)),
+	})
+	require.NoError(t, err)
+	require.Len(t, responses, 3)
+
+	assert.ElementsMatch(t, []int{2, 1}, calls)
+
+	decoded, err := responses[0].Decode()
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{uint8(18)}, decoded)
+
+	assert.Equal(t, &ErrResponse{Code: 3, Message: "execution reverted: not supported", Data: revertData.Pretty()}, responses[1].Err)
+	assert.True(t, responses[1].Deterministic())
+
+	assert.NoError(t, responses[2].Err)
+	assert.Equal(t, 3, responses[2].ID)
+}
+
+func TestClient_Multicall_Split(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxCallsByGas int
+		opts          []MulticallOption
+		expectedCalls []int
+	}{
+		{"single multicall", 0, nil, []int{5}},
+		{"calldata size", 0, []MulticallOption{WithMaxCalldataSize(4 + 2*32 + 2*aggregate3CallSize(make([]byte, 4)))}, []int{2, 2, 1}},
+		{"gas limit", 2, nil, []int{5, 2, 3, 1, 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls []int
+			server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+				"eth_call": mockMulticall(t, &calls, test.maxCallsByGas),
+			})
+			defer closer()
+
+			ethCalls := make([]*ETHCall, 5)
+			for i := range ethCalls {
+				ethCalls[i] = NewETHCall(testTokenA, decimalsMethod)
+			}
+
+			client := NewClient(server.URL)
+			responses, err := client.Multicall(context.Background(), ethCalls, test.opts...)
+			require.NoError(t, err)
+
+			for _, response := range responses {
+				assert.NoError(t, response.Err)
+				assert.Equal(t, "0x"+string(bytes.Repeat([]byte{'0'}, 62))+"12", response.Content)
+			}
+
+			assert.ElementsMatch(t, test.expectedCalls, calls)
+		})
+	}
+}
+
+// mockMulticall answers `aggregate3` calls, `testTokenA` returns 18 decimals and `testTokenB`
+// reverts. The number of calls of each multicall received is appended to `calls`, multicalls with
+// more than `maxCallsByGas` calls fail with an out of gas error when it's not 0.
+func mockMulticall(t *testing.T, calls *[]int, maxCallsByGas int) func(params []interface{}) interface{} {
+	var lock sync.Mutex
+	return func(params []interface{}) interface{} {
+		call := params[0].(map[string]interface{})
+		require.Equal(t, Multicall3Address.Pretty(), call["to"])
+
+		decoded := decodeTestAggregate3Calls(t, eth.MustNewHex(call["data"].(string)))
+		lock.Lock()
+		*calls = append(*calls, len(decoded))
+		lock.Unlock()
+
+		if maxCallsByGas > 0 && len(decoded) > maxCallsByGas {
+			return &ErrResponse{Code: -32000, Message: "out of gas"}
+		}
+
+		results := make([]aggregate3Result, len(decoded))
+		for i, call := range decoded {
+			if bytes.Equal(call.target, testTokenB) {
+				results[i] = aggregate3Result{false, revertData}
+			} else {
+				results[i] = aggregate3Result{true, abiWord(18)}
+			}
+		}
+
+		return eth.Hex(encodeTestAggregate3Results(results)).Pretty()
+	}
+}
+
+type testAggregate3Call struct {
+	target       eth.Address
+	allowFailure bool
+	calldata     []byte
+}
+
+func decodeTestAggregate3Calls(t *testing.T, data []byte) (out []testAggregate3Call) {
+	require.Equal(t, aggregate3Selector, data[0:4])
+	data = data[4:]
+
+	read := func(offset uint64) uint64 {
+		word, err := abiReadWord(data, offset)
+		require.NoError(t, err)
+		return word
+	}
+
+	content := read(0) + 32
+	for i := uint64(0); i < read(content-32); i++ {
+		tuple := content + read(content+32*i)
+		calldata := tuple + read(tuple+64)
+
+		out = append(out, testAggregate3Call{
+			target:       eth.Address(data[tuple+12 : tuple+32]),
+			allowFailure: read(tuple+32) == 1,
+			calldata:     data[calldata+32 : calldata+32+read(calldata)],
+		})
+	}
+
+	return
+}
+
+func encodeTestAggregate3Results(results []aggregate3Result) []byte {
+	out := append(abiWord(32), abiWord(uint64(len(results)))...)
+
+	offset := uint64(32 * len(results))
+	for _, result := range results {
+		out = append(out, abiWord(offset)...)
+		offset += uint64(3*32 + abiPaddedLength(len(result.returnData)))
+	}
+
+	for _, result := range results {
+		success := uint64(0)
+		if result.success {
+			success = 1
+		}
+
+		out = append(out, abiWord(success)...)
+		out = append(out, abiWord(64)...)
+		out = append(out, abiWord(uint64(len(result.returnData)))...)
+		out = append(out, result.returnData...)
+		out = append(out, make([]byte, abiPaddedLength(len(result.returnData))-len(result.returnData))...)
+	}
+
+	return out
+}
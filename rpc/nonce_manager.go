@@ -0,0 +1,243 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/logging"
+	"go.uber.org/zap"
+)
+
+// NonceStore persists the next nonce to use for each account so that a NonceManager can
+// resume after a restart without re-using nonces of transactions still in flight.
+type NonceStore interface {
+	LoadNonce(ctx context.Context, account eth.Address) (nonce uint64, found bool, err error)
+	StoreNonce(ctx context.Context, account eth.Address, nonce uint64) error
+}
+
+type NonceManagerOption func(*NonceManager)
+
+// WithNonceStore persists the next nonce of each account in `store`.
+func WithNonceStore(store NonceStore) NonceManagerOption {
+	return func(m *NonceManager) {
+		m.store = store
+	}
+}
+
+// NonceManager tracks locally the next nonce to use for each account it manages, enabling
+// sending many transactions concurrently from a single account without querying the node
+// for each of them. It's safe for concurrent use.
+//
+// The first reservation of an account synchronizes it from `eth_getTransactionCount` at the
+// "pending" block (and from the NonceStore if any, the highest of the two wins). Nonces of
+// transactions that could not be sent must be given back through Release (or HandleSendError)
+// so they are re-used by the next reservations, avoiding nonce gaps.
+type NonceManager struct {
+	client *Client
+	store  NonceStore
+
+	lock     sync.Mutex
+	accounts map[string]*accountNonces
+}
+
+type accountNonces struct {
+	lock     sync.Mutex
+	synced   bool
+	next     uint64
+	released []uint64
+}
+
+func NewNonceManager(client *Client, opts ...NonceManagerOption) *NonceManager {
+	m := &NonceManager{
+		client:   client,
+		accounts: map[string]*accountNonces{},
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+func (m *NonceManager) account(address eth.Address) *accountNonces {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := address.String()
+	account, found := m.accounts[key]
+	if !found {
+		account = &accountNonces{}
+		m.accounts[key] = account
+	}
+
+	return account
+}
+
+// Reserve returns the next nonce to use for `address`, the nonce is considered used until
+// it's given back through Release.
+func (m *NonceManager) Reserve(ctx context.Context, address eth.Address) (uint64, error) {
+	account := m.account(address)
+
+	account.lock.Lock()
+	defer account.lock.Unlock()
+
+	if !account.synced {
+		if err := m.sync(ctx, address, account, true); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(account.released) > 0 {
+		nonce := account.released[0]
+		account.released = account.released[1:]
+		return nonce, nil
+	}
+
+	nonce := account.next
+	account.next++
+
+	if err := m.persist(ctx, address, account); err != nil {
+		account.next--
+		return 0, err
+	}
+
+	return nonce, nil
+}
+
+// Release gives back a reserved `nonce` that was not used by a transaction accepted by the
+// node, it's going to be re-used by a subsequent reservation.
+func (m *NonceManager) Release(ctx context.Context, address eth.Address, nonce uint64) {
+	account := m.account(address)
+
+	account.lock.Lock()
+	defer account.lock.Unlock()
+
+	if !account.synced || nonce >= account.next {
+		return
+	}
+
+	if nonce == account.next-1 {
+		account.next--
+		if err := m.persist(ctx, address, account); err != nil {
+			logging.Logger(ctx, zlog).Warn("unable to persist released nonce", zap.Stringer("account", address), zap.Uint64("nonce", nonce), zap.Error(err))
+		}
+		return
+	}
+
+	for _, released := range account.released {
+		if released == nonce {
+			return
+		}
+	}
+
+	account.released = append(account.released, nonce)
+	sort.Slice(account.released, func(i, j int) bool { return account.released[i] < account.released[j] })
+}
+
+// Resync forgets the locally tracked state of `address` and synchronizes it back from the
+// node's pending transaction count.
+func (m *NonceManager) Resync(ctx context.Context, address eth.Address) error {
+	account := m.account(address)
+
+	account.lock.Lock()
+	defer account.lock.Unlock()
+
+	return m.sync(ctx, address, account, false)
+}
+
+// HandleSendError must be called when sending a transaction using a reserved `nonce` failed
+// with `sendErr`, it returns the error to report, `nil` when the transaction must be considered
+// as sent:
+//   - The node already knows the transaction, it is in its pool, the nonce stays used and `nil`
+//     is returned.
+//   - The nonce is already used (nonce too low or replacement underpriced), the account is
+//     resynchronized from the node.
+//   - The node rejected the transaction with a JSON-RPC error, the nonce is released.
+//   - Any other error, like a timeout or a dropped connection, leaves unknown whether the node
+//     accepted the transaction, the account is resynchronized from the node's pending count
+//     instead of reusing the nonce.
+func (m *NonceManager) HandleSendError(ctx context.Context, address eth.Address, nonce uint64, sendErr error) error {
+	logger := logging.Logger(ctx, zlog)
+
+	if IsAlreadyKnownError(sendErr) {
+		logger.Debug("transaction already known by the node, considering it sent", zap.Stringer("account", address), zap.Uint64("nonce", nonce))
+		return nil
+	}
+
+	var rpcErr *ErrResponse
+	rejected := errors.As(sendErr, &rpcErr)
+
+	if !rejected || IsNonceTooLowError(sendErr) || IsReplacementUnderpricedError(sendErr) {
+		logger.Info("nonce possibly used, resynchronizing account nonce",
+			zap.Stringer("account", address),
+			zap.Uint64("nonce", nonce),
+			zap.Error(sendErr),
+		)
+
+		if err := m.Resync(ctx, address); err != nil {
+			return fmt.Errorf("%w (resync failed: %s)", sendErr, err)
+		}
+
+		return sendErr
+	}
+
+	m.Release(ctx, address, nonce)
+	return sendErr
+}
+
+func (m *NonceManager) sync(ctx context.Context, address eth.Address, account *accountNonces, useStore bool) error {
+	nonce, err := m.client.PendingNonce(ctx, address)
+	if err != nil {
+		return fmt.Errorf("sync nonce of %s: %w", address.Pretty(), err)
+	}
+
+	if useStore && m.store != nil {
+		stored, found, err := m.store.LoadNonce(ctx, address)
+		if err != nil {
+			return fmt.Errorf("load nonce of %s: %w", address.Pretty(), err)
+		}
+
+		if found && stored > nonce {
+			nonce = stored
+		}
+	}
+
+	zlog.Debug("synchronized account nonce", zap.Stringer("account", address), zap.Uint64("nonce", nonce), zap.Uint64("previous_nonce", account.next))
+
+	account.synced = true
+	account.next = nonce
+	account.released = nil
+
+	return m.persist(ctx, address, account)
+}
+
+func (m *NonceManager) persist(ctx context.Context, address eth.Address, account *accountNonces) error {
+	if m.store == nil {
+		return nil
+	}
+
+	if err := m.store.StoreNonce(ctx, address, account.next); err != nil {
+		return fmt.Errorf("store nonce of %s: %w", address.Pretty(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testAccount = eth.MustNewAddress("0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f")
+
+func TestNonceManager_ReserveConcurrently(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_getTransactionCount": "0xa"})
+	defer closer()
+
+	manager := NewNonceManager(NewClient(server.URL))
+
+	var lock sync.Mutex
+	var nonces []uint64
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			nonce, err := manager.Reserve(context.Background(), testAccount)
+			require.NoError(t, err)
+
+			lock.Lock()
+			nonces = append(nonces, nonce)
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+	for i, nonce := range nonces {
+		assert.Equal(t, uint64(10+i), nonce)
+	}
+
+	assert.Equal(t, 1, server.Count("eth_getTransactionCount"))
+	assert.Equal(t, []interface{}{"0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f", "pending"}, server.Params(t, "eth_getTransactionCount"))
+}
+
+func TestNonceManager_Release(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_getTransactionCount": "0x0"})
+	defer closer()
+
+	ctx := context.Background()
+	manager := NewNonceManager(NewClient(server.URL))
+
+	reserve := func() uint64 {
+		nonce, err := manager.Reserve(ctx, testAccount)
+		require.NoError(t, err)
+		return nonce
+	}
+
+	assert.Equal(t, uint64(0), reserve())
+	assert.Equal(t, uint64(1), reserve())
+	assert.Equal(t, uint64(2), reserve())
+	assert.Equal(t, uint64(3), reserve())
+
+	// Last one released is simply given back
+	manager.Release(ctx, testAccount, 3)
+	assert.Equal(t, uint64(3), reserve())
+
+	// Gaps are filled first, lowest first
+	manager.Release(ctx, testAccount, 2)
+	manager.Release(ctx, testAccount, 1)
+	assert.Equal(t, uint64(1), reserve())
+	assert.Equal(t, uint64(2), reserve())
+	assert.Equal(t, uint64(4), reserve())
+}
+
+func TestNonceManager_HandleSendError(t *testing.T) {
+	pendingNonce := "0x0"
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_getTransactionCount": func(params []interface{}) interface{} { return pendingNonce },
+	})
+	defer closer()
+
+	ctx := context.Background()
+	manager := NewNonceManager(NewClient(server.URL))
+
+	reserve := func() uint64 {
+		nonce, err := manager.Reserve(ctx, testAccount)
+		require.NoError(t, err)
+		return nonce
+	}
+
+	nonce := reserve()
+	assert.Equal(t, uint64(0), nonce)
+
+	// Rejected by the node, the nonce is given back
+	sendErr := &ErrResponse{Code: -32000, Message: "insufficient funds for gas * price + value"}
+	assert.Equal(t, sendErr, manager.HandleSendError(ctx, testAccount, nonce, sendErr))
+	nonce = reserve()
+	assert.Equal(t, uint64(0), nonce, "nonce should have been released")
+
+	// Already in the node's pool, the transaction is considered sent
+	assert.NoError(t, manager.HandleSendError(ctx, testAccount, nonce, &ErrResponse{Code: -32000, Message: "already known"}))
+	assert.Equal(t, uint64(1), reserve(), "nonce should still be used")
+	assert.Equal(t, 1, server.Count("eth_getTransactionCount"))
+
+	// The node may have accepted the transaction before the connection dropped
+	pendingNonce = "0x2"
+	transportErr := errors.New("unexpected EOF")
+	assert.Equal(t, transportErr, manager.HandleSendError(ctx, testAccount, 1, transportErr))
+	assert.Equal(t, uint64(2), reserve(), "account should have been resynchronized")
+	assert.Equal(t, 2, server.Count("eth_getTransactionCount"))
+
+	// Another process used nonces 2 to 4 in the meantime
+	pendingNonce = "0x5"
+	sendErr = &ErrResponse{Code: -32000, Message: "nonce too low"}
+	assert.Equal(t, sendErr, manager.HandleSendError(ctx, testAccount, 2, sendErr))
+	assert.Equal(t, uint64(5), reserve(), "account should have been resynchronized")
+	assert.Equal(t, 3, server.Count("eth_getTransactionCount"))
+}
+
+func TestNonceManager_Store(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_getTransactionCount": "0x2"})
+	defer closer()
+
+	ctx := context.Background()
+	store := &memoryNonceStore{nonces: map[string]uint64{testAccount.String(): 7}}
+	manager := NewNonceManager(NewClient(server.URL), WithNonceStore(store))
+
+	nonce, err := manager.Reserve(ctx, testAccount)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(7), nonce)
+	assert.Equal(t, uint64(8), store.nonces[testAccount.String()])
+}
+
+type memoryNonceStore struct {
+	nonces map[string]uint64
+}
+
+func (s *memoryNonceStore) LoadNonce(ctx context.Context, account eth.Address) (uint64, bool, error) {
+	nonce, found := s.nonces[account.String()]
+	return nonce, found, nil
+}
+
+func (s *memoryNonceStore) StoreNonce(ctx context.Context, account eth.Address, nonce uint64) error {
+	s.nonces[account.String()] = nonce
+	return nil
+}
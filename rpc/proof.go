@@ -0,0 +1,236 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/eth-go/rlp"
+	"github.com/streamingfast/eth-go/trie"
+)
+
+// EmptyCodeHash is the code hash of accounts without code, the Keccak-256 hash of nothing.
+var EmptyCodeHash = eth.MustNewHash("0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470")
+
+// AccountProof is the result of `eth_getProof`, the state of an account along with the Merkle
+// proofs of it and of the requested storage slots.
+type AccountProof struct {
+	Address eth.Address `json:"address"`
+	// AccountProof are the RLP encoded state trie nodes on the path from the state root to the account.
+	AccountProof []eth.Hex    `json:"accountProof"`
+	Balance      *eth.Uint256 `json:"balance"`
+	CodeHash     eth.Hash     `json:"codeHash"`
+	Nonce        eth.Uint64   `json:"nonce"`
+	// StorageHash is the root of the account's storage trie.
+	StorageHash  eth.Hash        `json:"storageHash"`
+	StorageProof []*StorageProof `json:"storageProof"`
+}
+
+type StorageProof struct {
+	// Key is the storage slot, nodes might return it without its leading zeroes.
+	Key   *eth.Uint256 `json:"key"`
+	Value *eth.Uint256 `json:"value"`
+	// Proof are the RLP encoded storage trie nodes on the path from the storage root to the slot.
+	Proof []eth.Hex `json:"proof"`
+}
+
+// GetProof fetches the account `address` along with the proofs of its state and of the storage
+// slots `storageKeys` at block `blockAt`.
+//
+// The response is rejected when it's not about `address` or its storage proofs are not exactly the
+// ones of `storageKeys`, in order. The proofs are only as trustworthy as the state root they are
+// verified against with `AccountProof.Verify`, the block it comes from should itself be verified,
+// see `Block.VerifyHash`.
+func (c *Client) GetProof(ctx context.Context, address eth.Address, storageKeys []eth.Hash, blockAt *BlockRef) (*AccountProof, error) {
+	if storageKeys == nil {
+		storageKeys = []eth.Hash{}
+	}
+
+	resp, err := c.DoRequest(ctx, "eth_getProof", []interface{}{address, storageKeys, blockAt})
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform eth_getProof request: %w", err)
+	}
+
+	var out *AccountProof
+	if err := json.Unmarshal([]byte(resp), &out); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	if out == nil {
+		return nil, fmt.Errorf("empty eth_getProof response")
+	}
+
+	if err := out.checkRequested(address, storageKeys); err != nil {
+		return nil, fmt.Errorf("invalid eth_getProof response: %w", err)
+	}
+
+	return out, nil
+}
+
+// checkRequested ensures the proof is the one of `address` and of its `storageKeys` slots, in order,
+// an endpoint could otherwise answer with valid proofs of another account or slots.
+func (p *AccountProof) checkRequested(address eth.Address, storageKeys []eth.Hash) error {
+	if !bytes.Equal(p.Address, address) {
+		return fmt.Errorf("proof of account %s instead of %s", p.Address.Pretty(), address.Pretty())
+	}
+
+	if len(p.StorageProof) != len(storageKeys) {
+		return fmt.Errorf("%d storage proofs for %d storage keys", len(p.StorageProof), len(storageKeys))
+	}
+
+	for i, storageKey := range storageKeys {
+		proof := p.StorageProof[i]
+		if proof == nil || proof.Key == nil {
+			return fmt.Errorf("storage proof #%d without key", i)
+		}
+
+		if proof.Key.Int().Cmp(new(big.Int).SetBytes(storageKey)) != 0 {
+			key := proof.Key.Bytes32()
+			return fmt.Errorf("storage proof #%d of slot %s instead of %s", i, eth.Hash(key[:]).Pretty(), storageKey.Pretty())
+		}
+	}
+
+	return nil
+}
+
+// Verify checks the account proof against the state root `stateRoot`, then each storage proof
+// against the account's storage root. An error is returned if any proof is invalid or if the
+// proven values do not match the ones of the response.
+func (p *AccountProof) Verify(stateRoot eth.Hash) error {
+	if err := p.VerifyAccount(stateRoot); err != nil {
+		return err
+	}
+
+	for _, storageProof := range p.StorageProof {
+		if err := storageProof.Verify(p.StorageHash); err != nil {
+			return fmt.Errorf("account %s: %w", p.Address.Pretty(), err)
+		}
+	}
+
+	return nil
+}
+
+// VerifyAccount checks the account proof against the state root `stateRoot` and that the proven
+// nonce, balance, storage root and code hash match the ones of the response. A proof of absence
+// is accepted when the response describes an empty account.
+func (p *AccountProof) VerifyAccount(stateRoot eth.Hash) error {
+	encoded, err := trie.VerifyProof(stateRoot, eth.Keccak256(p.Address), hexesToBytes(p.AccountProof))
+	if err != nil {
+		return fmt.Errorf("account %s: %w", p.Address.Pretty(), err)
+	}
+
+	if encoded == nil {
+		if p.Nonce != 0 || (p.Balance != nil && !p.Balance.IsZero()) || !isEmptyOrZero(p.CodeHash, EmptyCodeHash) || !isEmptyOrZero(p.StorageHash, trie.EmptyRoot) {
+			return fmt.Errorf("account %s: proof shows the account does not exist but response has a non-empty account", p.Address.Pretty())
+		}
+
+		return nil
+	}
+
+	fields, err := splitStrings(encoded, 4)
+	if err != nil {
+		return fmt.Errorf("account %s: decode proven account: %w", p.Address.Pretty(), err)
+	}
+
+	mismatch := func(field string, proven, actual interface{}) error {
+		return fmt.Errorf("account %s: proven %s %v does not match response %s %v", p.Address.Pretty(), field, proven, field, actual)
+	}
+
+	if nonce := new(big.Int).SetBytes(fields[0]); !nonce.IsUint64() || nonce.Uint64() != uint64(p.Nonce) {
+		return mismatch("nonce", nonce, uint64(p.Nonce))
+	}
+
+	if balance := new(big.Int).SetBytes(fields[1]); p.Balance == nil || balance.Cmp(p.Balance.Int()) != 0 {
+		return mismatch("balance", balance, p.Balance)
+	}
+
+	if !bytes.Equal(fields[2], p.StorageHash) {
+		return mismatch("storage hash", eth.Hash(fields[2]).Pretty(), p.StorageHash.Pretty())
+	}
+
+	if !bytes.Equal(fields[3], p.CodeHash) {
+		return mismatch("code hash", eth.Hash(fields[3]).Pretty(), p.CodeHash.Pretty())
+	}
+
+	return nil
+}
+
+// Verify checks the storage proof against the account's storage root `storageRoot` and that the
+// proven value matches the one of the response, a proof of absence matches a zero value.
+func (p *StorageProof) Verify(storageRoot eth.Hash) error {
+	if p.Key == nil {
+		return fmt.Errorf("storage proof without key")
+	}
+
+	key := p.Key.Bytes32()
+	encoded, err := trie.VerifyProof(storageRoot, eth.Keccak256(key[:]), hexesToBytes(p.Proof))
+	if err != nil {
+		return fmt.Errorf("storage slot %s: %w", eth.Hash(key[:]).Pretty(), err)
+	}
+
+	value := new(big.Int)
+	if encoded != nil {
+		content, _, err := rlp.SplitString(encoded)
+		if err != nil {
+			return fmt.Errorf("storage slot %s: decode proven value: %w", eth.Hash(key[:]).Pretty(), err)
+		}
+		value.SetBytes(content)
+	}
+
+	if p.Value == nil || value.Cmp(p.Value.Int()) != 0 {
+		return fmt.Errorf("storage slot %s: proven value %s does not match response value %s", eth.Hash(key[:]).Pretty(), value, p.Value)
+	}
+
+	return nil
+}
+
+func splitStrings(encoded []byte, count int) ([][]byte, error) {
+	elements, _, err := rlp.SplitList(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(elements) != count {
+		return nil, fmt.Errorf("expected %d elements, got %d", count, len(elements))
+	}
+
+	out := make([][]byte, count)
+	for i, element := range elements {
+		if out[i], _, err = rlp.SplitString(element); err != nil {
+			return nil, fmt.Errorf("element #%d: %w", i, err)
+		}
+	}
+
+	return out, nil
+}
+
+func hexesToBytes(in []eth.Hex) [][]byte {
+	out := make([][]byte, len(in))
+	for i, value := range in {
+		out[i] = value
+	}
+	return out
+}
+
+// isEmptyOrZero returns `true` if `hash` is either `empty` or made of zeroes only, nodes do not
+// agree on which one to return for the code hash and storage hash of non-existent accounts.
+func isEmptyOrZero(hash eth.Hash, empty eth.Hash) bool {
+	return bytes.Equal(hash, empty) || len(bytes.Trim(hash, "\x00")) == 0
+}
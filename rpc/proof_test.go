@@ -0,0 +1,176 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The fixtures are proofs against real state roots: account_proof.json is the deposit contract in
+// Hoodi's genesis state and account_proof_missing.json an account absent from mainnet's genesis state.
+func TestClient_GetProof(t *testing.T) {
+	stateRoot, proof := readTestAccountProof(t, "testdata/account_proof.json")
+
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_getProof": proof})
+	defer closer()
+
+	slots := []eth.Hash{
+		eth.MustNewHash("0x0000000000000000000000000000000000000000000000000000000000000022"),
+		eth.MustNewHash("0x0000000000000000000000000000000000000000000000000000000000000001"),
+	}
+
+	actual, err := NewClient(server.URL).GetProof(context.Background(), eth.MustNewAddress("0x00000000219ab540356cBB839Cbe05303d7705Fa"), slots, BlockNumber(0))
+	require.NoError(t, err)
+
+	assert.Equal(t, []interface{}{
+		"0x00000000219ab540356cbb839cbe05303d7705fa",
+		[]interface{}{slots[0].Pretty(), slots[1].Pretty()},
+		"0x0",
+	}, server.Params(t, "eth_getProof"))
+
+	assert.Equal(t, eth.MustNewHash("0x6c029a231254fadb724d63be769f75eedd66362df034a3e663252b49d062a666"), actual.CodeHash)
+	require.Len(t, actual.StorageProof, 2)
+	// The deposit contract stores the zero hashes of its Merkle tree, keccak256 of two zero hashes in slot 0x22
+	value := actual.StorageProof[0].Value.Bytes32()
+	assert.Equal(t, eth.MustNewHash("0xf5a5fd42d16a20302798ef6ed309979b43003d2320d9f0e8ea9831a92759fb4b"), eth.Hash(value[:]))
+	assert.Equal(t, "0", actual.StorageProof[1].Value.String())
+
+	require.NoError(t, actual.Verify(stateRoot))
+}
+
+func TestClient_GetProof_Mismatch(t *testing.T) {
+	_, proof := readTestAccountProof(t, "testdata/account_proof.json")
+
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_getProof": proof})
+	defer closer()
+
+	slot34 := eth.MustNewHash("0x0000000000000000000000000000000000000000000000000000000000000022")
+	slot1 := eth.MustNewHash("0x0000000000000000000000000000000000000000000000000000000000000001")
+	account := eth.MustNewAddress("0x00000000219ab540356cBB839Cbe05303d7705Fa")
+
+	tests := []struct {
+		name        string
+		address     eth.Address
+		storageKeys []eth.Hash
+		expectError string
+	}{
+		{
+			"swapped address", eth.MustNewAddress("0x00000000000000000000000000000000deadbeef"), []eth.Hash{slot34, slot1},
+			"invalid eth_getProof response: proof of account 0x00000000219ab540356cbb839cbe05303d7705fa instead of 0x00000000000000000000000000000000deadbeef",
+		},
+		{
+			"swapped slot", account, []eth.Hash{slot34, eth.MustNewHash("0x0000000000000000000000000000000000000000000000000000000000000023")},
+			"invalid eth_getProof response: storage proof #1 of slot 0x0000000000000000000000000000000000000000000000000000000000000001 instead of 0x0000000000000000000000000000000000000000000000000000000000000023",
+		},
+		{
+			"reordered slots", account, []eth.Hash{slot1, slot34},
+			"invalid eth_getProof response: storage proof #0 of slot 0x0000000000000000000000000000000000000000000000000000000000000022 instead of 0x0000000000000000000000000000000000000000000000000000000000000001",
+		},
+		{
+			"missing slot", account, []eth.Hash{slot34},
+			"invalid eth_getProof response: 2 storage proofs for 1 storage keys",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewClient(server.URL).GetProof(context.Background(), test.address, test.storageKeys, BlockNumber(0))
+			assert.EqualError(t, err, test.expectError)
+		})
+	}
+}
+
+func TestAccountProof_Verify(t *testing.T) {
+	tests := []struct {
+		name        string
+		filename    string
+		tamper      func(proof *AccountProof, stateRoot *eth.Hash)
+		expectError string
+	}{
+		{"valid", "testdata/account_proof.json", nil, ""},
+		{"valid absence", "testdata/account_proof_missing.json", nil, ""},
+		{
+			"wrong state root", "testdata/account_proof.json",
+			func(proof *AccountProof, stateRoot *eth.Hash) { *stateRoot = testTrxHash },
+			"account 0x00000000219ab540356cbb839cbe05303d7705fa: node 0x8e4d4b2d4c8bdc0f0d8ab2e1f1fc51bfa8a85d7bb5f0ce0c9ac4c3b9d9c2d2f1 at depth 0 is missing: invalid proof",
+		},
+		{
+			"wrong balance", "testdata/account_proof.json",
+			func(proof *AccountProof, stateRoot *eth.Hash) { proof.Balance = eth.NewUint256FromUint64(1) },
+			"account 0x00000000219ab540356cbb839cbe05303d7705fa: proven balance 0 does not match response balance 1",
+		},
+		{
+			"wrong storage value", "testdata/account_proof.json",
+			func(proof *AccountProof, stateRoot *eth.Hash) {
+				proof.StorageProof[0].Value = eth.NewUint256FromUint64(1)
+			},
+			"account 0x00000000219ab540356cbb839cbe05303d7705fa: storage slot 0x0000000000000000000000000000000000000000000000000000000000000022: proven value 111109925611824843164212799849330761292948257037696933205019304127221294824267 does not match response value 1",
+		},
+		{
+			"non-zero absent storage value", "testdata/account_proof.json",
+			func(proof *AccountProof, stateRoot *eth.Hash) {
+				proof.StorageProof[1].Value = eth.NewUint256FromUint64(1)
+			},
+			"account 0x00000000219ab540356cbb839cbe05303d7705fa: storage slot 0x0000000000000000000000000000000000000000000000000000000000000001: proven value 0 does not match response value 1",
+		},
+		{
+			"non-empty absent account", "testdata/account_proof_missing.json",
+			func(proof *AccountProof, stateRoot *eth.Hash) { proof.Nonce = 1 },
+			"account 0x00000000000000000000000000000000deadbeef: proof shows the account does not exist but response has a non-empty account",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stateRoot, raw := readTestAccountProof(t, test.filename)
+
+			var proof *AccountProof
+			require.NoError(t, json.Unmarshal(raw, &proof))
+
+			if test.tamper != nil {
+				test.tamper(proof, &stateRoot)
+			}
+
+			err := proof.Verify(stateRoot)
+			if test.expectError == "" {
+				require.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.expectError)
+			}
+		})
+	}
+}
+
+func readTestAccountProof(t *testing.T, filename string) (stateRoot eth.Hash, proof json.RawMessage) {
+	t.Helper()
+
+	content, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+
+	var fixture struct {
+		StateRoot eth.Hash        `json:"stateRoot"`
+		Proof     json.RawMessage `json:"proof"`
+	}
+	require.NoError(t, json.Unmarshal(content, &fixture))
+
+	return fixture.StateRoot, fixture.Proof
+}
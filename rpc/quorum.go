@@ -0,0 +1,164 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuorumResponse is the response of one endpoint to a quorum request.
+type QuorumResponse struct {
+	URL string
+	// Response is the endpoint's JSON-RPC response payload, `nil` when `Err` is set.
+	Response []byte
+	// Err is set when the request failed at the transport level.
+	Err error
+}
+
+// QuorumError is returned when not enough endpoints agreed on the results of a quorum request, it
+// holds the responses of all the endpoints queried.
+type QuorumError struct {
+	Required  int
+	Responses []*QuorumResponse
+}
+
+func (e *QuorumError) Error() string {
+	groups := map[string]int{}
+	for _, response := range e.Responses {
+		if response.Err == nil {
+			groups[quorumKey(response.Response)]++
+		}
+	}
+
+	agreeing := 0
+	for _, count := range groups {
+		if count > agreeing {
+			agreeing = count
+		}
+	}
+
+	details := make([]string, len(e.Responses))
+	for i, response := range e.Responses {
+		if response.Err != nil {
+			details[i] = fmt.Sprintf("%s: %s", response.URL, response.Err)
+		} else {
+			details[i] = fmt.Sprintf("%s: %s", response.URL, response.Response)
+		}
+	}
+
+	return fmt.Sprintf("quorum not reached, %d of the %d required endpoints agree: %s", agreeing, e.Required, strings.Join(details, "; "))
+}
+
+// Quorum returns a client sending each request to `endpoints` endpoints, healthy ones first, and
+// returning once `agree` of them responded with byte-for-byte identical results (JSON-RPC errors
+// included). A `*QuorumError` is returned when all endpoints responded without enough agreeing.
+//
+// Use it for settlement-critical reads, like balances or `eth_call` at a specific block, to be
+// protected against a single misbehaving provider. Reads of moving targets, like the latest block,
+// legitimately disagree while endpoints are not at the same head.
+func (c *MultiClient) Quorum(endpoints, agree int, opts ...Option) *Client {
+	transport := &quorumTransport{multi: c.transport, endpoints: endpoints, agree: agree}
+
+	return NewClient("", append([]Option{WithTransport(transport)}, opts...)...)
+}
+
+type quorumTransport struct {
+	multi     *multiTransport
+	endpoints int
+	agree     int
+}
+
+func (t *quorumTransport) RoundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	candidates := t.multi.candidates()
+	if len(candidates) > t.endpoints {
+		candidates = candidates[:t.endpoints]
+	}
+
+	if t.agree < 1 || t.agree > len(candidates) {
+		return nil, fmt.Errorf("quorum of %d endpoints cannot be reached with %d endpoints", t.agree, len(candidates))
+	}
+
+	// Endpoints still running when the quorum is reached are abandoned
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type indexedResponse struct {
+		index    int
+		response *QuorumResponse
+	}
+
+	received := make(chan indexedResponse, len(candidates))
+	for i, endpoint := range candidates {
+		go func(i int, endpoint *multiEndpoint) {
+			start := time.Now()
+			response, err := endpoint.client.sendRaw(ctx, request)
+			switch {
+			case err == nil:
+				endpoint.succeeded(time.Since(start))
+			case ctx.Err() == nil:
+				// Abandoned endpoints did not fail, their request was canceled
+				endpoint.failed(err, t.multi.ejectionCooldown)
+			}
+
+			received <- indexedResponse{i, &QuorumResponse{URL: endpoint.client.URL, Response: response, Err: err}}
+		}(i, endpoint)
+	}
+
+	responses := make([]*QuorumResponse, len(candidates))
+	groups := map[string]int{}
+	for range candidates {
+		in := <-received
+		responses[in.index] = in.response
+
+		if in.response.Err != nil {
+			continue
+		}
+
+		key := quorumKey(in.response.Response)
+		groups[key]++
+		if groups[key] >= t.agree {
+			return in.response.Response, nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, &QuorumError{Required: t.agree, Responses: responses}
+}
+
+// quorumKey identifies the results of a response payload, independently of its formatting and
+// identifiers, each result's content or error in identifier order.
+func quorumKey(response []byte) string {
+	results, err := parseRPCResults(zlog, response)
+	if err != nil {
+		// Unparsable responses can only agree with identical ones
+		return string(response)
+	}
+
+	keys := make([]string, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			keys[i] = "error:" + result.Err.Error()
+		} else {
+			keys[i] = "result:" + result.Content
+		}
+	}
+
+	return strings.Join(keys, "\n")
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiClient_Quorum(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	tests := []struct {
+		name          string
+		balances      []interface{}
+		down          bool
+		endpoints     int
+		agree         int
+		expected      string
+		expectedError bool
+	}{
+		{"all agree", []interface{}{"0x10", "0x10", "0x10"}, false, 3, 3, "0x10", false},
+		{"majority agrees", []interface{}{"0x10", "0x11", "0x10"}, false, 3, 2, "0x10", false},
+		{"same errors agree", []interface{}{&ErrResponse{Code: -32000, Message: "missing trie node"}, &ErrResponse{Code: -32000, Message: "missing trie node"}}, false, 2, 2, "", true},
+		{"endpoint down", []interface{}{"0x10", "0x10"}, true, 3, 2, "0x10", false},
+		{"disagreement", []interface{}{"0x10", "0x11", "0x12"}, false, 3, 2, "", true},
+		{"not enough endpoints queried", []interface{}{"0x10", "0x10", "0x10"}, false, 1, 2, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var endpoints []*MultiClientEndpoint
+			for _, balance := range test.balances {
+				server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_getBalance": balance})
+				defer closer()
+
+				endpoints = append(endpoints, &MultiClientEndpoint{Client: NewClient(server.URL)})
+			}
+			if test.down {
+				endpoints = append([]*MultiClientEndpoint{{Client: NewClient(down.URL)}}, endpoints...)
+			}
+
+			client := NewMultiClient(endpoints)
+			defer client.Close()
+
+			out, err := client.Quorum(test.endpoints, test.agree).DoRequest(context.Background(), "eth_getBalance", []interface{}{testAccount, "0x10"})
+			if test.expectedError {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, test.expected, out)
+			}
+		})
+	}
+}
+
+func TestMultiClient_Quorum_Error(t *testing.T) {
+	var endpoints []*MultiClientEndpoint
+	var urls []string
+	for _, balance := range []string{"0x10", "0x11", "0x10"} {
+		server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_getBalance": balance})
+		defer closer()
+
+		urls = append(urls, server.URL)
+		endpoints = append(endpoints, &MultiClientEndpoint{Client: NewClient(server.URL)})
+	}
+
+	client := NewMultiClient(endpoints)
+	defer client.Close()
+
+	_, err := client.Quorum(3, 3).GetBalance(context.Background(), testAccount)
+
+	var quorumErr *QuorumError
+	require.True(t, errors.As(err, &quorumErr), "unexpected error %s", err)
+	assert.Equal(t, 3, quorumErr.Required)
+	require.Len(t, quorumErr.Responses, 3)
+	for i, response := range quorumErr.Responses {
+		assert.Equal(t, urls[i], response.URL)
+		assert.NoError(t, response.Err)
+	}
+
+	assert.Contains(t, err.Error(), "quorum not reached, 2 of the 3 required endpoints agree")
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":"0x1","result":"0x11"}`, string(quorumErr.Responses[1].Response))
+
+	balance, err := client.Quorum(3, 2).GetBalance(context.Background(), testAccount)
+	require.NoError(t, err)
+	assert.Equal(t, &eth.TokenAmount{Amount: big.NewInt(0x10), Token: eth.ETHToken}, balance)
+}
+
+func TestMultiClient_Quorum_Health(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	endpoints := []*MultiClientEndpoint{{Client: NewClient(down.URL)}}
+	for i := 0; i < 2; i++ {
+		server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_getBalance": "0x10"})
+		defer closer()
+
+		endpoints = append(endpoints, &MultiClientEndpoint{Client: NewClient(server.URL)})
+	}
+
+	client := NewMultiClient(endpoints)
+	defer client.Close()
+
+	_, err := client.Quorum(3, 3).GetBalance(context.Background(), testAccount)
+	require.Error(t, err)
+
+	statuses := client.Endpoints()
+	assert.False(t, statuses[0].Healthy)
+	assert.Equal(t, &HTTPStatusError{StatusCode: 502, Body: []byte{}}, statuses[0].LastError)
+	for _, status := range statuses[1:] {
+		assert.True(t, status.Healthy)
+		assert.NotZero(t, status.Latency)
+	}
+}
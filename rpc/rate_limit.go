@@ -0,0 +1,217 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned by clients using a non-blocking `RateLimiter` when the request's cost
+// exceeds the available budget.
+var ErrRateLimited = errors.New("client-side rate limit exceeded")
+
+type RateLimiterOption func(*RateLimiter)
+
+// WithMethodCost sets the cost of each `method` request, providers usually bill heavy methods like
+// `eth_getLogs` many more compute units than light ones like `eth_blockNumber`.
+func WithMethodCost(method string, cost float64) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.costs[method] = cost
+	}
+}
+
+// WithDefaultMethodCost sets the cost of methods without a specific cost, defaults to 1.
+func WithDefaultMethodCost(cost float64) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.defaultCost = cost
+	}
+}
+
+// WithNonBlocking makes clients fail with `ErrRateLimited` instead of waiting for the budget to
+// refill.
+func WithNonBlocking() RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.nonBlocking = true
+	}
+}
+
+// RateLimiterStats holds the counters of a `RateLimiter` since its creation.
+type RateLimiterStats struct {
+	// Acquired is the number of acquisitions that went through, after waiting or not.
+	Acquired uint64
+	// Waited is the number of acquisitions that had to wait for the budget to refill.
+	Waited uint64
+	// Rejected is the number of acquisitions that failed, because non-blocking or canceled while waiting.
+	Rejected  uint64
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// RateLimiter is a token bucket refilled at `rate` tokens per second up to `burst` tokens, each
+// request consuming tokens according to its method's cost. It's safe for concurrent use and can
+// be shared by multiple clients to enforce a budget common to all of them.
+//
+// A request costing more than the available tokens (even more than `burst`) goes through once it
+// has waited for the missing tokens, requests following it wait for the debt to be refilled.
+type RateLimiter struct {
+	rate        float64
+	burst       float64
+	costs       map[string]float64
+	defaultCost float64
+	nonBlocking bool
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+	stats  RateLimiterStats
+}
+
+// NewRateLimiter returns a full `RateLimiter`, it panics if `rate` or `burst` is not positive.
+func NewRateLimiter(rate float64, burst int, opts ...RateLimiterOption) *RateLimiter {
+	if rate <= 0 || burst <= 0 {
+		panic(fmt.Errorf("invalid rate limiter, rate and burst must be positive, got %v and %d", rate, burst))
+	}
+
+	l := &RateLimiter{
+		rate:        rate,
+		burst:       float64(burst),
+		costs:       map[string]float64{},
+		defaultCost: 1,
+		tokens:      float64(burst),
+		last:        time.Now(),
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// WithRateLimiter makes the client acquire the cost of its requests from `limiter` before sending
+// them, batches costing the sum of their requests' costs. Responses served from the cache are free.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(client *Client) {
+		client.rateLimiter = limiter
+	}
+}
+
+// Cost returns the total cost of requests for `methods`.
+func (l *RateLimiter) Cost(methods ...string) (out float64) {
+	for _, method := range methods {
+		if cost, found := l.costs[method]; found {
+			out += cost
+		} else {
+			out += l.defaultCost
+		}
+	}
+	return
+}
+
+// Wait consumes `cost` tokens, waiting until they are available or `ctx` is done.
+func (l *RateLimiter) Wait(ctx context.Context, cost float64) error {
+	if l.rate <= 0 || l.burst <= 0 {
+		return fmt.Errorf("invalid rate limiter, rate and burst must be positive, got %v and %v", l.rate, l.burst)
+	}
+
+	l.lock.Lock()
+	l.refill()
+
+	l.tokens -= cost
+	if l.tokens >= 0 {
+		l.stats.Acquired++
+		l.lock.Unlock()
+		return nil
+	}
+
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.lock.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		l.lock.Lock()
+		l.tokens += cost
+		l.stats.Rejected++
+		l.lock.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	l.lock.Lock()
+	l.stats.Acquired++
+	l.stats.Waited++
+	l.stats.TotalWait += wait
+	if wait > l.stats.MaxWait {
+		l.stats.MaxWait = wait
+	}
+	l.lock.Unlock()
+
+	return nil
+}
+
+// TryAcquire consumes `cost` tokens if they are available right away and returns `true`, otherwise
+// it returns `false` without consuming anything. A cost higher than `burst` is only acquired when
+// the bucket is full.
+func (l *RateLimiter) TryAcquire(cost float64) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.refill()
+	if l.tokens >= cost || (cost > l.burst && l.tokens >= l.burst) {
+		l.tokens -= cost
+		l.stats.Acquired++
+		return true
+	}
+
+	l.stats.Rejected++
+	return false
+}
+
+func (l *RateLimiter) Stats() RateLimiterStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.stats
+}
+
+// acquire consumes the cost of requests for `methods` the way configured for clients.
+func (l *RateLimiter) acquire(ctx context.Context, methods []string) error {
+	cost := l.Cost(methods...)
+	if !l.nonBlocking {
+		return l.Wait(ctx, cost)
+	}
+
+	if !l.TryAcquire(cost) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// refill adds the tokens accumulated since the last refill, the lock must be held.
+func (l *RateLimiter) refill() {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
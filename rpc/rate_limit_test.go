@@ -0,0 +1,99 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_Cost(t *testing.T) {
+	limiter := NewRateLimiter(10, 10, WithMethodCost("eth_getLogs", 75), WithMethodCost("eth_blockNumber", 10), WithDefaultMethodCost(20))
+
+	assert.Equal(t, float64(75), limiter.Cost("eth_getLogs"))
+	assert.Equal(t, float64(105), limiter.Cost("eth_getLogs", "eth_blockNumber", "eth_call"))
+	assert.Equal(t, float64(0), limiter.Cost())
+}
+
+func TestRateLimiter_Invalid(t *testing.T) {
+	assert.Panics(t, func() { NewRateLimiter(0, 10) })
+	assert.Panics(t, func() { NewRateLimiter(-1, 10) })
+	assert.Panics(t, func() { NewRateLimiter(10, 0) })
+	assert.Panics(t, func() { NewRateLimiter(10, -1) })
+
+	err := (&RateLimiter{}).Wait(context.Background(), 1)
+	assert.EqualError(t, err, "invalid rate limiter, rate and burst must be positive, got 0 and 0")
+}
+
+func TestRateLimiter_TryAcquire(t *testing.T) {
+	limiter := NewRateLimiter(0.001, 2)
+
+	assert.True(t, limiter.TryAcquire(1))
+	assert.True(t, limiter.TryAcquire(1))
+	assert.False(t, limiter.TryAcquire(1))
+
+	stats := limiter.Stats()
+	assert.Equal(t, uint64(2), stats.Acquired)
+	assert.Equal(t, uint64(1), stats.Rejected)
+
+	// A cost above the burst is acquired only from a full bucket
+	assert.True(t, NewRateLimiter(0.001, 2).TryAcquire(5))
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	limiter := NewRateLimiter(100, 1)
+	ctx := context.Background()
+
+	start := time.Now()
+	require.NoError(t, limiter.Wait(ctx, 1))
+	require.NoError(t, limiter.Wait(ctx, 1))
+	require.NoError(t, limiter.Wait(ctx, 2))
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(25*time.Millisecond))
+
+	stats := limiter.Stats()
+	assert.Equal(t, uint64(3), stats.Acquired)
+	assert.Equal(t, uint64(2), stats.Waited)
+	assert.Greater(t, int64(stats.TotalWait), int64(25*time.Millisecond))
+	assert.Greater(t, int64(stats.MaxWait), int64(15*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, limiter.Wait(ctx, 100))
+	assert.Equal(t, uint64(1), limiter.Stats().Rejected)
+}
+
+func TestClient_RateLimiter(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_blockNumber": "0x10", "eth_getLogs": []interface{}{}})
+	defer closer()
+
+	limiter := NewRateLimiter(0.001, 10, WithMethodCost("eth_getLogs", 8), WithNonBlocking())
+	client := NewClient(server.URL, WithRateLimiter(limiter))
+	ctx := context.Background()
+
+	_, err := client.DoRequest(ctx, "eth_getLogs", []interface{}{map[string]interface{}{}})
+	require.NoError(t, err)
+
+	_, err = client.DoRequests(ctx, []*RPCRequest{{Method: "eth_blockNumber"}, {Method: "eth_blockNumber"}})
+	require.NoError(t, err)
+
+	_, err = client.LatestBlockNum(ctx)
+	assert.True(t, errors.Is(err, ErrRateLimited), "unexpected error %s", err)
+	assert.Equal(t, 2, server.Count("eth_blockNumber"))
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/eth-go/rlp"
+	"github.com/streamingfast/eth-go/trie"
+)
+
+// Bloom computes the logs bloom of the receipt from its logs.
+func (r *TransactionReceipt) Bloom() (out eth.Bloom) {
+	for _, log := range r.Logs {
+		out.Add(log.Address)
+		for _, topic := range log.Topics {
+			out.Add(topic)
+		}
+	}
+	return
+}
+
+// RLP returns the consensus encoding of the receipt, the one committed to by the receipts root
+// of blocks. Typed receipts (EIP-2718) are prefixed by their type, receipts mined before the
+// Byzantium hard fork hold the intermediate state root instead of the status.
+func (r *TransactionReceipt) RLP() ([]byte, error) {
+	var statusOrRoot []byte
+	switch {
+	case r.Status != nil && *r.Status == 1:
+		statusOrRoot = []byte{0x01}
+	case r.Status != nil:
+		statusOrRoot = []byte{}
+	case r.Root != nil:
+		statusOrRoot = r.Root
+	default:
+		return nil, fmt.Errorf("receipt has neither status nor root")
+	}
+
+	logs := make([]interface{}, len(r.Logs))
+	for i, log := range r.Logs {
+		topics := make([]interface{}, len(log.Topics))
+		for j, topic := range log.Topics {
+			topics[j] = []byte(topic)
+		}
+
+		logs[i] = []interface{}{[]byte(log.Address), topics, []byte(log.Data)}
+	}
+
+	bloom := r.Bloom()
+	encoded, err := rlp.Encode([]interface{}{statusOrRoot, uint64(r.CumulativeGasUsed), bloom[:], logs})
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Type == 0 {
+		return encoded, nil
+	}
+
+	return append([]byte{byte(r.Type)}, encoded...), nil
+}
+
+// ComputeReceiptsRoot computes the receipts root of a block from all its receipts, in block order.
+func ComputeReceiptsRoot(receipts []*TransactionReceipt) (eth.Hash, error) {
+	values := make([][]byte, len(receipts))
+	for i, receipt := range receipts {
+		encoded, err := receipt.RLP()
+		if err != nil {
+			return nil, fmt.Errorf("encode receipt #%d: %w", i, err)
+		}
+
+		values[i] = encoded
+	}
+
+	return trie.DeriveListRoot(values)
+}
+
+// ComputeLogsBloom computes the logs bloom of a block from all its receipts.
+func ComputeLogsBloom(receipts []*TransactionReceipt) (out eth.Bloom) {
+	for _, receipt := range receipts {
+		out.Merge(receipt.Bloom())
+	}
+	return
+}
+
+// Bloom returns the block's logs bloom, use it to skip blocks that can't contain the logs of an
+// address or topic before fetching them.
+func (b *Block) Bloom() (eth.Bloom, error) {
+	return eth.NewBloom(b.LogsBloom)
+}
+
+// VerifyReceipts checks that `receipts`, all the block's receipts in block order, match the
+// block's receipts root and logs bloom.
+func (b *Block) VerifyReceipts(receipts []*TransactionReceipt) error {
+	root, err := ComputeReceiptsRoot(receipts)
+	if err != nil {
+		return fmt.Errorf("block #%d: %w", uint64(b.Number), err)
+	}
+
+	if !bytes.Equal(root, b.ReceiptsRoot) {
+		return fmt.Errorf("block #%d: computed receipts root %s does not match block receipts root %s", uint64(b.Number), root.Pretty(), b.ReceiptsRoot.Pretty())
+	}
+
+	bloom := ComputeLogsBloom(receipts)
+	if !bytes.Equal(bloom[:], b.LogsBloom) {
+		return fmt.Errorf("block #%d: computed logs bloom does not match block logs bloom", uint64(b.Number))
+	}
+
+	return nil
+}
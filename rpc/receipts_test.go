@@ -0,0 +1,74 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testBlockReceipts struct {
+	ReceiptsRoot eth.Hash              `json:"receiptsRoot"`
+	LogsBloom    eth.Hex               `json:"logsBloom"`
+	Receipts     []*TransactionReceipt `json:"receipts"`
+}
+
+// The fixture holds the receipts of Sepolia block 175881, three failed contract creations.
+func TestComputeReceiptsRoot(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/receipts.json")
+	require.NoError(t, err)
+
+	var fixture testBlockReceipts
+	require.NoError(t, json.Unmarshal(content, &fixture))
+
+	root, err := ComputeReceiptsRoot(fixture.Receipts)
+	require.NoError(t, err)
+	assert.Equal(t, fixture.ReceiptsRoot, root)
+
+	for i, receipt := range fixture.Receipts {
+		bloom := receipt.Bloom()
+		assert.Equal(t, []byte(receipt.LogsBloom), bloom.Bytes(), "receipt #%d", i)
+	}
+
+	bloom := ComputeLogsBloom(fixture.Receipts)
+	assert.Equal(t, []byte(fixture.LogsBloom), bloom.Bytes())
+
+	block := &Block{Number: 1, ReceiptsRoot: fixture.ReceiptsRoot, LogsBloom: fixture.LogsBloom}
+	require.NoError(t, block.VerifyReceipts(fixture.Receipts))
+	assert.Error(t, block.VerifyReceipts(fixture.Receipts[1:]))
+
+	blockBloom, err := block.Bloom()
+	require.NoError(t, err)
+	assert.Equal(t, bloom.Bytes(), blockBloom.Bytes())
+}
+
+func TestComputeReceiptsRoot_PreByzantium(t *testing.T) {
+	receipts := []*TransactionReceipt{{
+		Root:              eth.MustNewHash("0x00000000000000000000000000000000000000000000000000000000000000aa"),
+		CumulativeGasUsed: 21000,
+	}}
+
+	root, err := ComputeReceiptsRoot(receipts)
+	require.NoError(t, err)
+	assert.Equal(t, eth.MustNewHash("0x13dd6b7b559cc4311120427003b0368d70dd0e0c1c327370050193747c5c3d9e"), root)
+
+	_, err = ComputeReceiptsRoot([]*TransactionReceipt{{CumulativeGasUsed: 21000}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,326 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/logging"
+	"go.uber.org/zap"
+)
+
+// Replacing a pending transaction requires the new one to pay more than the pending one, nodes
+// reject replacements that do not increase fees by a minimum percentage. Geth requires 10% on
+// the gas price (both the fee cap and the tip for EIP-1559 transactions), we use 12.5% for
+// EIP-1559 transactions, which also covers the maximum base fee increase between two blocks.
+const (
+	// LegacyReplacementBumpBps is the minimum gas price bump, in basis points, of a legacy replacement transaction.
+	LegacyReplacementBumpBps uint64 = 1000
+	// DynamicFeeReplacementBumpBps is the minimum fee cap and tip bump, in basis points, of an EIP-1559 replacement transaction.
+	DynamicFeeReplacementBumpBps uint64 = 1250
+)
+
+// cancelGasLimit is the gas used by a plain value transfer to an externally owned account.
+const cancelGasLimit = 21000
+
+var bps = big.NewInt(10000)
+
+// BumpFee returns `fee` increased by `bumpBps` basis points (1% is 100 basis points), rounded up.
+func BumpFee(fee *big.Int, bumpBps uint64) *big.Int {
+	out := new(big.Int).Mul(fee, new(big.Int).SetUint64(10000+bumpBps))
+	out.Add(out, new(big.Int).Sub(bps, big.NewInt(1)))
+
+	return out.Div(out, bps)
+}
+
+// SpeedUp builds and signs a replacement for the `pending` transaction sending the same value and data
+// with the same nonce, paying at least the minimum fee bump over the pending transaction, or the current
+// network fees if higher.
+func (b *TransactionBuilder) SpeedUp(ctx context.Context, pending *Transaction) (signed []byte, filled *TransactionRequest, err error) {
+	req := &TransactionRequest{
+		Value:    pending.Value.Int(),
+		Data:     pending.Input,
+		GasLimit: uint64(pending.Gas),
+	}
+	if pending.To != nil {
+		req.To = *pending.To
+	}
+
+	return b.replace(ctx, pending, req)
+}
+
+// Cancel builds and signs a replacement for the `pending` transaction that sends nothing to the sender
+// itself with the same nonce, paying at least the minimum fee bump over the pending transaction, or the
+// current network fees if higher.
+func (b *TransactionBuilder) Cancel(ctx context.Context, pending *Transaction) (signed []byte, filled *TransactionRequest, err error) {
+	return b.replace(ctx, pending, &TransactionRequest{
+		To:       pending.From,
+		Value:    new(big.Int),
+		GasLimit: cancelGasLimit,
+	})
+}
+
+func (b *TransactionBuilder) replace(ctx context.Context, pending *Transaction, req *TransactionRequest) (signed []byte, filled *TransactionRequest, err error) {
+	if !pending.IsPending() {
+		return nil, nil, fmt.Errorf("transaction %s is already mined", pending.Hash.Pretty())
+	}
+
+	if !bytes.Equal(pending.From, b.from) {
+		return nil, nil, fmt.Errorf("transaction %s is sent by %s, not by the builder's account %s", pending.Hash.Pretty(), pending.From.Pretty(), b.from.Pretty())
+	}
+
+	nonce := uint64(pending.Nonce)
+	req.Nonce = &nonce
+	if pending.ChainID != nil {
+		req.ChainID = new(big.Int).SetUint64(uint64(*pending.ChainID))
+	}
+
+	filled, err = b.Fill(ctx, req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fill replacement transaction: %w", err)
+	}
+
+	// A legacy transaction pays its gas price both as fee cap and as tip
+	pendingFeeCap, pendingTip := pending.GasPrice.Int(), pending.GasPrice.Int()
+	if pending.MaxFeePerGas != nil && pending.MaxPriorityFeePerGas != nil {
+		pendingFeeCap, pendingTip = pending.MaxFeePerGas.Int(), pending.MaxPriorityFeePerGas.Int()
+	}
+
+	if pendingFeeCap == nil || pendingTip == nil {
+		return nil, nil, fmt.Errorf("transaction %s has no fees information", pending.Hash.Pretty())
+	}
+
+	if filled.IsDynamicFee() {
+		filled.MaxFeePerGas = maxBigInt(filled.MaxFeePerGas, BumpFee(pendingFeeCap, DynamicFeeReplacementBumpBps))
+		filled.MaxPriorityFeePerGas = maxBigInt(filled.MaxPriorityFeePerGas, BumpFee(pendingTip, DynamicFeeReplacementBumpBps))
+	} else {
+		filled.GasPrice = maxBigInt(filled.GasPrice, BumpFee(pendingFeeCap, LegacyReplacementBumpBps))
+	}
+
+	signed, filled, err = b.Sign(ctx, filled)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return signed, filled, nil
+}
+
+func maxBigInt(left, right *big.Int) *big.Int {
+	if left.Cmp(right) >= 0 {
+		return left
+	}
+	return right
+}
+
+// GasEscalatorPolicy controls how a GasEscalator increases the fees of a transaction until it's mined.
+type GasEscalatorPolicy struct {
+	// Interval is the time waited for the transaction to be mined before its fees are bumped and
+	// the transaction is rebroadcasted.
+	Interval time.Duration
+	// BumpBps is the fee increase, in basis points, applied at each step. Values below the minimum
+	// accepted by nodes for a replacement are raised to the minimum.
+	BumpBps uint64
+	// MaxFeePerGas is the fee cap, the fees are never bumped above it (the gas price for legacy
+	// transactions, the max fee per gas for EIP-1559 ones). Once the fees can't be bumped anymore
+	// and the transaction is still not mined after another interval, `Send` gives up with a
+	// `*FeeCapReachedError`. No limit when `nil`.
+	MaxFeePerGas *big.Int
+	// Confirmations is the number of confirmations to wait for once the transaction is mined, see
+	// `Client.WaitMined`.
+	Confirmations uint64
+}
+
+// GasEscalator sends a transaction and rebroadcasts it with increasing fees, following its policy,
+// until one of the broadcasted versions gets mined.
+type GasEscalator struct {
+	builder *TransactionBuilder
+	policy  GasEscalatorPolicy
+}
+
+// FeeCapReachedError is returned by `GasEscalator.Send` when the fees reached the policy's cap and
+// none of the broadcasted versions of the transaction got mined after another interval. The versions
+// remain in the node's pool and one of them may still get mined, they all share the same nonce.
+type FeeCapReachedError struct {
+	Nonce uint64
+	// Hashes are the hashes of all broadcasted versions of the transaction, by increasing fees
+	Hashes []eth.Hash
+}
+
+func (e *FeeCapReachedError) Error() string {
+	return fmt.Sprintf("fee cap reached without transaction with nonce %d mined, %d versions broadcasted", e.Nonce, len(e.Hashes))
+}
+
+func NewGasEscalator(builder *TransactionBuilder, policy GasEscalatorPolicy) *GasEscalator {
+	return &GasEscalator{builder: builder, policy: policy}
+}
+
+// Send fills, signs and sends `req` then escalates its fees until one of the broadcasted versions of
+// the transaction is mined, returning the mined transaction. All versions share the same nonce, so
+// at most one of them can ever be mined. A `*FeeCapReachedError` is returned when the fees can't be
+// escalated anymore and none of the versions got mined.
+func (e *GasEscalator) Send(ctx context.Context, req *TransactionRequest) (*MinedTransaction, error) {
+	logger := logging.Logger(ctx, zlog)
+	client := e.builder.client
+
+	signed, filled, err := e.builder.Sign(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := client.SendRawTransaction(ctx, signed); err != nil {
+		if e.builder.nonceReserved(req) {
+			err = e.builder.nonceManager.HandleSendError(ctx, e.builder.from, *filled.Nonce, err)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("send transaction: %w", err)
+		}
+	}
+
+	hashes := []eth.Hash{eth.Keccak256(signed)}
+	for {
+		mined, err := e.waitAny(ctx, hashes)
+		if err != nil {
+			return nil, err
+		}
+
+		if mined != nil {
+			return mined, nil
+		}
+
+		escalated := e.escalate(filled)
+		if sameFees(escalated, filled) {
+			return nil, &FeeCapReachedError{Nonce: *filled.Nonce, Hashes: hashes}
+		}
+
+		signed, filled, err = e.builder.Sign(ctx, escalated)
+		if err != nil {
+			return nil, fmt.Errorf("sign escalated transaction: %w", err)
+		}
+
+		hash := eth.Hash(eth.Keccak256(signed))
+		logger.Info("escalating transaction fees",
+			zap.Stringer("trx_hash", hash),
+			zap.Uint64("nonce", *filled.Nonce),
+			zap.Stringer("gas_price", filled.GasPrice),
+			zap.Stringer("max_fee_per_gas", filled.MaxFeePerGas),
+			zap.Stringer("max_priority_fee_per_gas", filled.MaxPriorityFeePerGas),
+		)
+
+		if _, err := client.SendRawTransaction(ctx, signed); err != nil {
+			// Being told our nonce is used means one of our transactions was mined, being told the transaction
+			// is already known or underpriced means the last bump, up to the fee cap, was too small for the
+			// node, all are fine while escalating.
+			if !IsNonceTooLowError(err) && !IsAlreadyKnownError(err) && !IsReplacementUnderpricedError(err) {
+				return nil, fmt.Errorf("send escalated transaction: %w", err)
+			}
+
+			logger.Debug("escalated transaction not accepted", zap.Stringer("trx_hash", hash), zap.Error(err))
+		}
+
+		hashes = append(hashes, hash)
+	}
+}
+
+// waitAny waits for at most the policy's interval for one of the transactions to be mined, it returns
+// `nil, nil` if none of them was mined in time.
+func (e *GasEscalator) waitAny(ctx context.Context, hashes []eth.Hash) (*MinedTransaction, error) {
+	client := e.builder.client
+	deadline := time.After(e.policy.Interval)
+	pollInterval := e.policy.Interval / 5
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+
+	for {
+		for _, hash := range hashes {
+			receipt, err := client.TransactionReceipt(ctx, hash)
+			if err != nil {
+				return nil, err
+			}
+
+			if receipt == nil {
+				continue
+			}
+
+			mined, err := client.WaitMined(ctx, hash, e.policy.Confirmations, WithPollInterval(pollInterval, e.policy.Interval))
+			if err != nil {
+				return nil, err
+			}
+
+			// While waiting for confirmations, the transaction might have been reorged out and replaced by another
+			// of our versions, in which case we keep going
+			if mined.Status != TransactionStatusReplaced && mined.Status != TransactionStatusDropped {
+				return mined, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			return nil, nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (e *GasEscalator) escalate(req *TransactionRequest) *TransactionRequest {
+	out := *req
+
+	if out.IsDynamicFee() {
+		out.MaxFeePerGas = e.bump(out.MaxFeePerGas, DynamicFeeReplacementBumpBps)
+		out.MaxPriorityFeePerGas = BumpFee(out.MaxPriorityFeePerGas, e.bumpBps(DynamicFeeReplacementBumpBps))
+		if out.MaxPriorityFeePerGas.Cmp(out.MaxFeePerGas) > 0 {
+			out.MaxPriorityFeePerGas = out.MaxFeePerGas
+		}
+	} else {
+		out.GasPrice = e.bump(out.GasPrice, LegacyReplacementBumpBps)
+	}
+
+	return &out
+}
+
+func sameFees(left, right *TransactionRequest) bool {
+	if left.IsDynamicFee() {
+		return left.MaxFeePerGas.Cmp(right.MaxFeePerGas) == 0 && left.MaxPriorityFeePerGas.Cmp(right.MaxPriorityFeePerGas) == 0
+	}
+	return left.GasPrice.Cmp(right.GasPrice) == 0
+}
+
+func (e *GasEscalator) bump(fee *big.Int, minimumBps uint64) *big.Int {
+	if e.policy.MaxFeePerGas != nil && fee.Cmp(e.policy.MaxFeePerGas) >= 0 {
+		return fee
+	}
+
+	bumped := BumpFee(fee, e.bumpBps(minimumBps))
+	if e.policy.MaxFeePerGas != nil && bumped.Cmp(e.policy.MaxFeePerGas) > 0 {
+		return new(big.Int).Set(e.policy.MaxFeePerGas)
+	}
+
+	return bumped
+}
+
+func (e *GasEscalator) bumpBps(minimumBps uint64) uint64 {
+	if e.policy.BumpBps < minimumBps {
+		return minimumBps
+	}
+	return e.policy.BumpBps
+}
@@ -0,0 +1,200 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBumpFee(t *testing.T) {
+	tests := []struct {
+		name     string
+		fee      int64
+		bumpBps  uint64
+		expected int64
+	}{
+		{"10%", 1000, 1000, 1100},
+		{"12.5%", 1000, 1250, 1125},
+		{"rounded up", 1001, 1000, 1102},
+		{"zero", 0, 1000, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, big.NewInt(test.expected).String(), BumpFee(big.NewInt(test.fee), test.bumpBps).String())
+		})
+	}
+}
+
+func TestTransactionBuilder_Replace(t *testing.T) {
+	to := eth.MustNewAddress("0x3535353535353535353535353535353535353535")
+	pendingLegacy := &Transaction{Hash: testTrxHash, From: testAccount, To: &to, Nonce: 7, Gas: 50000, Value: eth.NewUint256FromUint64(10), Input: eth.MustNewHex("0x01"), GasPrice: eth.NewUint256FromUint64(1000000000)}
+	pendingDynamic := &Transaction{Hash: testTrxHash, From: testAccount, To: &to, Nonce: 7, Gas: 50000, Value: eth.NewUint256FromUint64(10), Input: eth.MustNewHex("0x01"), MaxFeePerGas: eth.NewUint256FromUint64(3000000000), MaxPriorityFeePerGas: eth.NewUint256FromUint64(1000000000)}
+
+	legacyMarket := map[string]interface{}{"eth_chainId": "0x1", "eth_gasPrice": "0x3b9aca00"}
+	dynamicMarket := map[string]interface{}{
+		"eth_chainId": "0x1",
+		"eth_feeHistory": map[string]interface{}{
+			"oldestBlock":   "0x10",
+			"baseFeePerGas": []string{"0x3b9aca00", "0x3b9aca00"},
+			"gasUsedRatio":  []float64{0.5},
+			"reward":        [][]string{{"0x3b9aca00"}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		results  map[string]interface{}
+		opts     []TransactionBuilderOption
+		replace  func(b *TransactionBuilder) ([]byte, *TransactionRequest, error)
+		expected *TransactionRequest
+	}{
+		{
+			name:    "speed up legacy",
+			results: legacyMarket,
+			opts:    []TransactionBuilderOption{WithLegacyTransactions()},
+			replace: func(b *TransactionBuilder) ([]byte, *TransactionRequest, error) {
+				return b.SpeedUp(context.Background(), pendingLegacy)
+			},
+			expected: &TransactionRequest{To: to, Value: big.NewInt(10), Data: eth.MustNewHex("0x01"), Nonce: uint64Ptr(7), ChainID: big.NewInt(1), GasLimit: 50000, GasPrice: big.NewInt(1100000000)},
+		},
+		{
+			name:    "speed up dynamic fee",
+			results: dynamicMarket,
+			replace: func(b *TransactionBuilder) ([]byte, *TransactionRequest, error) {
+				return b.SpeedUp(context.Background(), pendingDynamic)
+			},
+			expected: &TransactionRequest{To: to, Value: big.NewInt(10), Data: eth.MustNewHex("0x01"), Nonce: uint64Ptr(7), ChainID: big.NewInt(1), GasLimit: 50000, MaxFeePerGas: big.NewInt(3375000000), MaxPriorityFeePerGas: big.NewInt(1125000000)},
+		},
+		{
+			name:    "cancel legacy with dynamic fee",
+			results: dynamicMarket,
+			replace: func(b *TransactionBuilder) ([]byte, *TransactionRequest, error) {
+				return b.Cancel(context.Background(), pendingLegacy)
+			},
+			expected: &TransactionRequest{To: testAccount, Value: big.NewInt(0), Nonce: uint64Ptr(7), ChainID: big.NewInt(1), GasLimit: 21000, MaxFeePerGas: big.NewInt(3000000000), MaxPriorityFeePerGas: big.NewInt(1125000000)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, closer := mockJSONRPCMethods(t, test.results)
+			defer closer()
+
+			builder := NewTransactionBuilder(NewClient(server.URL), testSigner(t, 1), testAccount, test.opts...)
+			signed, actual, err := test.replace(builder)
+			require.NoError(t, err)
+
+			assert.NotEmpty(t, signed)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestTransactionBuilder_ReplaceOtherSender(t *testing.T) {
+	other := eth.MustNewAddress("0x3535353535353535353535353535353535353535")
+	pending := &Transaction{Hash: testTrxHash, From: other, To: &testAccount, Nonce: 7, Gas: 21000, Value: eth.NewUint256FromUint64(10), GasPrice: eth.NewUint256FromUint64(1000000000)}
+
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_chainId": "0x1", "eth_gasPrice": "0x3b9aca00"})
+	defer closer()
+
+	builder := NewTransactionBuilder(NewClient(server.URL), testSigner(t, 1), testAccount, WithLegacyTransactions())
+
+	_, _, err := builder.SpeedUp(context.Background(), pending)
+	assert.EqualError(t, err, fmt.Sprintf("transaction %s is sent by %s, not by the builder's account %s", testTrxHash.Pretty(), other.Pretty(), testAccount.Pretty()))
+
+	_, _, err = builder.Cancel(context.Background(), pending)
+	assert.Error(t, err)
+	assert.Equal(t, 0, server.Count("eth_gasPrice"))
+}
+
+func TestGasEscalator_Send(t *testing.T) {
+	var escalatedHash string
+
+	var server *mockJSONRPCMethodsServer
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_chainId": "0x1",
+		"eth_sendRawTransaction": func(params []interface{}) interface{} {
+			signed := eth.MustNewHex(params[0].(string))
+			hash := eth.Hash(eth.Keccak256(signed)).Pretty()
+			if server.Count("eth_sendRawTransaction") == 2 {
+				escalatedHash = hash
+			}
+			return hash
+		},
+		"eth_getTransactionReceipt": func(params []interface{}) interface{} {
+			if escalatedHash == "" || params[0] != escalatedHash {
+				return nil
+			}
+			return map[string]interface{}{"transactionHash": escalatedHash, "blockHash": "0xaa", "blockNumber": "0x64", "status": "0x1"}
+		},
+		"eth_blockNumber":      "0x64",
+		"eth_getBlockByNumber": map[string]interface{}{"hash": "0xaa"},
+	})
+	defer closer()
+
+	builder := NewTransactionBuilder(NewClient(server.URL), testSigner(t, 1), testAccount, WithLegacyTransactions())
+	escalator := NewGasEscalator(builder, GasEscalatorPolicy{Interval: 20 * time.Millisecond, BumpBps: 500, MaxFeePerGas: big.NewInt(1050)})
+
+	mined, err := escalator.Send(context.Background(), &TransactionRequest{To: testAccount, Nonce: uint64Ptr(1), GasLimit: 21000, GasPrice: big.NewInt(1000)})
+	require.NoError(t, err)
+
+	assert.Equal(t, TransactionStatusSucceeded, mined.Status)
+	assert.Equal(t, eth.MustNewHash(escalatedHash), mined.Receipt.TransactionHash)
+	assert.Equal(t, 2, server.Count("eth_sendRawTransaction"))
+	assert.Equal(t, []interface{}{"0x" + eth.Hex(mustSign(t, builder, 1050)).String()}, server.Params(t, "eth_sendRawTransaction"))
+}
+
+func TestGasEscalator_SendFeeCapReached(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_chainId": "0x1",
+		"eth_sendRawTransaction": func(params []interface{}) interface{} {
+			return eth.Hash(eth.Keccak256(eth.MustNewHex(params[0].(string)))).Pretty()
+		},
+		"eth_getTransactionReceipt": nil,
+	})
+	defer closer()
+
+	builder := NewTransactionBuilder(NewClient(server.URL), testSigner(t, 1), testAccount, WithLegacyTransactions())
+	escalator := NewGasEscalator(builder, GasEscalatorPolicy{Interval: 20 * time.Millisecond, BumpBps: 500, MaxFeePerGas: big.NewInt(1050)})
+
+	_, err := escalator.Send(context.Background(), &TransactionRequest{To: testAccount, Nonce: uint64Ptr(1), GasLimit: 21000, GasPrice: big.NewInt(1000)})
+
+	var capErr *FeeCapReachedError
+	require.True(t, errors.As(err, &capErr))
+	assert.Equal(t, &FeeCapReachedError{Nonce: 1, Hashes: []eth.Hash{
+		eth.Keccak256(mustSign(t, builder, 1000)),
+		eth.Keccak256(mustSign(t, builder, 1050)),
+	}}, capErr)
+	assert.Equal(t, 2, server.Count("eth_sendRawTransaction"))
+}
+
+func mustSign(t *testing.T, builder *TransactionBuilder, gasPrice int64) []byte {
+	t.Helper()
+
+	signed, err := builder.signer.SignTransaction(1, testAccount, big.NewInt(0), 21000, big.NewInt(gasPrice), nil)
+	require.NoError(t, err)
+
+	return signed
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetryPolicy controls how requests failing with a retryable error (see `IsRetryableError`) are
+// sent again, waiting an exponentially increasing delay between attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one, `1` or less disables retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, it doubles after each retry up to `MaxBackoff`.
+	InitialBackoff time.Duration
+	// MaxBackoff is the longest delay between two attempts, a request failing with a `Retry-After` delay
+	// longer than it is not retried.
+	MaxBackoff time.Duration
+	// Jitter is the fraction, between 0 and 1, of each delay randomly removed from it, so that clients
+	// that failed together don't retry together.
+	Jitter float64
+}
+
+// DefaultRetryPolicy retries up to 4 times, waiting from 250ms up to 10s.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Jitter:         0.5,
+}
+
+// WithRetryPolicy enables retries of the client's requests, by default a request is attempted once.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(client *Client) {
+		client.retryPolicy = policy
+	}
+}
+
+// delay returns the delay to wait before the retry number `retry` (starting at 1) of a request that
+// failed with `err`, the node's `Retry-After` delay is honored when longer. It returns `false` when
+// the node asks to wait longer than `MaxBackoff`, the request must not be retried then.
+func (p RetryPolicy) delay(retry int, err error) (time.Duration, bool) {
+	backoff := p.InitialBackoff
+	for i := 1; i < retry && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		backoff -= time.Duration(rand.Float64() * p.Jitter * float64(backoff))
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > backoff {
+		if p.MaxBackoff > 0 && statusErr.RetryAfter > p.MaxBackoff {
+			return 0, false
+		}
+		return statusErr.RetryAfter, true
+	}
+
+	return backoff, true
+}
+
+// withRetries calls `attempt` until it succeeds, fails with an error that is not retryable or the
+// policy's attempts are exhausted, the last attempt's error is returned.
+func (c *Client) withRetries(ctx context.Context, logger *zap.Logger, attempt func() error) error {
+	for i := 1; ; i++ {
+		err := attempt()
+		if err == nil || i >= c.retryPolicy.MaxAttempts || ctx.Err() != nil || !IsRetryableError(err) {
+			return err
+		}
+
+		delay, ok := c.retryPolicy.delay(i, err)
+		if !ok {
+			logger.Debug("not retrying json_rpc request, node asked to wait longer than max backoff", zap.Int("attempt", i), zap.Error(err))
+			return err
+		}
+
+		logger.Debug("retrying json_rpc request", zap.Int("attempt", i), zap.Duration("delay", delay), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestClient_Retry_HTTPStatus(t *testing.T) {
+	tests := []struct {
+		name             string
+		statuses         []int
+		expectedAttempts int32
+		expectedErr      error
+	}{
+		{"succeeds after transient errors", []int{503, 429, 200}, 3, nil},
+		{"gives up after max attempts", []int{500, 502, 503, 200}, 3, &HTTPStatusError{StatusCode: 503, Body: []byte("overloaded")}},
+		{"does not retry client errors", []int{401, 200}, 1, &HTTPStatusError{StatusCode: 401, Body: []byte("overloaded")}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				status := test.statuses[atomic.AddInt32(&attempts, 1)-1]
+				if status != 200 {
+					rw.WriteHeader(status)
+					rw.Write([]byte("overloaded"))
+					return
+				}
+
+				rw.Write([]byte(`{"jsonrpc":"2.0","id":"0x1","result":"0x10"}`))
+			}))
+			defer server.Close()
+
+			out, err := NewClient(server.URL, WithRetryPolicy(testRetryPolicy)).DoRequest(context.Background(), "eth_blockNumber", nil)
+			if test.expectedErr == nil {
+				require.NoError(t, err)
+				assert.Equal(t, "0x10", out)
+			} else {
+				var statusErr *HTTPStatusError
+				require.True(t, errors.As(err, &statusErr))
+				assert.Equal(t, test.expectedErr, statusErr)
+			}
+
+			assert.Equal(t, test.expectedAttempts, atomic.LoadInt32(&attempts))
+		})
+	}
+}
+
+func TestClient_Retry_RetryAfterAboveMaxBackoff(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		rw.Header().Set("Retry-After", "60")
+		rw.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, WithRetryPolicy(testRetryPolicy)).DoRequest(context.Background(), "eth_blockNumber", nil)
+
+	var statusErr *HTTPStatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, &HTTPStatusError{StatusCode: 429, Body: []byte{}, RetryAfter: time.Minute}, statusErr)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestClient_Retry_RPCError(t *testing.T) {
+	tests := []struct {
+		name             string
+		err              *ErrResponse
+		expectedAttempts int
+	}{
+		{"rate limited", &ErrResponse{Code: -32005, Message: "daily request count exceeded"}, 3},
+		{"header not found", &ErrResponse{Code: -32000, Message: "header not found"}, 3},
+		{"deterministic", &ErrResponse{Code: -32005, Message: "execution reverted"}, 1},
+		{"invalid params", &ErrResponse{Code: -32602, Message: "invalid argument 0"}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_call": test.err})
+			defer closer()
+
+			_, err := NewClient(server.URL, WithRetryPolicy(testRetryPolicy)).DoRequest(context.Background(), "eth_call", nil)
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.expectedAttempts, server.Count("eth_call"))
+		})
+	}
+}
+
+func TestClient_Retry_Batch(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_blockNumber": "0x10",
+		"eth_call": func(params []interface{}) interface{} {
+			return &ErrResponse{Code: -32005, Message: "rate limited"}
+		},
+	})
+	defer closer()
+
+	results, err := NewClient(server.URL, WithRetryPolicy(testRetryPolicy)).DoRequests(context.Background(), []*RPCRequest{
+		{Method: "eth_blockNumber", Params: []interface{}{}},
+		{Method: "eth_call", Params: []interface{}{}},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "0x10", results[0].Content)
+	assert.Equal(t, &ErrResponse{Code: -32005, Message: "rate limited"}, results[1].Err)
+	assert.Equal(t, 3, server.Count("eth_blockNumber"))
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	assertDelay := func(expected time.Duration, retry int, err error) {
+		t.Helper()
+
+		delay, ok := policy.delay(retry, err)
+		require.True(t, ok)
+		assert.Equal(t, expected, delay)
+	}
+
+	assertDelay(100*time.Millisecond, 1, nil)
+	assertDelay(400*time.Millisecond, 3, nil)
+	assertDelay(time.Second, 10, nil)
+	assertDelay(500*time.Millisecond, 1, fmt.Errorf("sending: %w", &HTTPStatusError{StatusCode: 429, RetryAfter: 500 * time.Millisecond}))
+
+	_, ok := policy.delay(1, fmt.Errorf("sending: %w", &HTTPStatusError{StatusCode: 429, RetryAfter: 5 * time.Second}))
+	assert.False(t, ok)
+
+	policy.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		delay, _ := policy.delay(2, nil)
+		assert.True(t, delay > 100*time.Millisecond && delay <= 200*time.Millisecond, "delay %s", delay)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+
+	delay := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, delay > 50*time.Second && delay <= time.Minute, "delay %s", delay)
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"too many requests", &HTTPStatusError{StatusCode: 429}, true},
+		{"bad gateway", fmt.Errorf("sending request: %w", &HTTPStatusError{StatusCode: 502}), true},
+		{"not found", &HTTPStatusError{StatusCode: 404}, false},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"limit exceeded code", &ErrResponse{Code: -32005, Message: "slow down"}, true},
+		{"header not found", &ErrResponse{Code: -32000, Message: "header not found"}, true},
+		{"deterministic", &ErrResponse{Code: -32000, Message: "execution reverted: header not found"}, false},
+		{"other rpc error", &ErrResponse{Code: -32000, Message: "nonce too low"}, false},
+		{"other error", errors.New("invalid json"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, IsRetryableError(test.err))
+		})
+	}
+}
@@ -17,13 +17,10 @@ package rpc
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math/big"
 	"net/http"
 	"sort"
@@ -38,6 +35,14 @@ import (
 
 var ErrFalseResp = errors.New("false response")
 
+// ErrMissingResponse is the error of the response of a batched request the node did not answer,
+// usually because the provider truncated the batch.
+var ErrMissingResponse = errors.New("no response received for request")
+
+// ErrDuplicateResponse is the error of the response of a batched request the node answered more
+// than once.
+var ErrDuplicateResponse = errors.New("multiple responses received for request")
+
 type Option func(*Client)
 
 // TODO: refactor to use mux rpc
@@ -45,10 +50,19 @@ type Client struct {
 	URL     string
 	chainID *big.Int
 
-	httpClient *http.Client
-	cache      Cache
+	httpClient  *http.Client
+	transport   Transport
+	retryPolicy RetryPolicy
+	rateLimiter *RateLimiter
+	batcher     *autoBatcher
+	cache       Cache
+	cachePolicy CachePolicy
+	finality    *cacheFinality
 }
 
+// NewClient returns a client reaching the node at `url` through the transport matching its scheme,
+// HTTP for `http://` and `https://`, WebSocket for `ws://` and `wss://` and IPC when `url` is a
+// plain path to the node's socket. Use `WithTransport` to provide any other transport.
 func NewClient(url string, opts ...Option) *Client {
 	c := &Client{
 		URL: url,
@@ -60,15 +74,44 @@ func NewClient(url string, opts ...Option) *Client {
 		opt(c)
 	}
 
+	if c.transport == nil {
+		c.transport = newTransport(c.URL, c.httpClient)
+	}
+
+	if c.batcher != nil {
+		c.batcher.transport = c.transport
+	}
+
+	if c.finality != nil {
+		c.finality.init(c)
+	}
+
 	return c
 }
 
+// Close releases the transport's resources, like its connections to the node.
+func (c *Client) Close() error {
+	if closer, ok := c.transport.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
 func WithHttpClient(httpClient *http.Client) Option {
 	return func(client *Client) {
 		client.httpClient = httpClient
 	}
 }
 
+// WithTransport sets the transport used to reach the node, replacing the one selected from the
+// client's URL.
+func WithTransport(transport Transport) Option {
+	return func(client *Client) {
+		client.transport = transport
+	}
+}
+
 func WithCache(cache Cache) Option {
 	return func(client *Client) {
 		client.cache = cache
@@ -77,11 +120,12 @@ func WithCache(cache Cache) Option {
 
 type LogsParams struct {
 	// FromBlock is either block number encoded as a hexadecimal or tagged value which is one of
-	// "latest" (`rpc.LatestBlock()`), "pending" (`rpc.PendingBlock()`) or "earliest" tags (`rpc.EarliestBlockRef`) (optional).
+	// "latest" (`rpc.LatestBlock`), "pending" (`rpc.PendingBlock`), "earliest" (`rpc.EarliestBlock`),
+	// "finalized" (`rpc.FinalizedBlock`) or "safe" (`rpc.SafeBlock`) tags (optional). A block referenced
+	// by hash (`rpc.BlockHash`) restricts the logs to this block, `ToBlock` must then be the same or unset.
 	FromBlock *BlockRef `json:"fromBlock,omitempty"`
 
-	// ToBlock is either block number encoded as a hexadecimal or tagged value which is one of
-	// "latest" (`LatestBlockRef()`), "pending" (`PendingBlockRef()`) or "earliest" tags (`EarliestBlockRef()`) (optional).
+	// ToBlock is either block number encoded as a hexadecimal or tagged value, see `FromBlock` (optional).
 	ToBlock *BlockRef `json:"toBlock,omitempty"`
 
 	// Address is the contract address or a list of addresses from which logs should originate (optional).
@@ -193,6 +237,52 @@ func OneOfTopic(topics ...interface{}) (out TopicFilterExpr) {
 	return
 }
 
+// MarshalJSONRPC encodes a block referenced by hash as the filter's `blockHash` (EIP-234), the only
+// form `eth_getLogs` accepts for it.
+func (p LogsParams) MarshalJSONRPC() ([]byte, error) {
+	type plainLogsParams LogsParams
+
+	hash, err := p.blockHash()
+	if err != nil {
+		return nil, err
+	}
+
+	if hash == nil {
+		return MarshalJSONRPC(plainLogsParams(p))
+	}
+
+	return MarshalJSONRPC(struct {
+		BlockHash eth.Hash     `json:"blockHash"`
+		Address   eth.Address  `json:"address,omitempty"`
+		Topics    *TopicFilter `json:"topics,omitempty"`
+	}{hash, p.Address, p.Topics})
+}
+
+func (p LogsParams) blockHash() (eth.Hash, error) {
+	var fromHash, toHash eth.Hash
+	if p.FromBlock != nil {
+		fromHash, _, _ = p.FromBlock.BlockHash()
+	}
+	if p.ToBlock != nil {
+		toHash, _, _ = p.ToBlock.BlockHash()
+	}
+
+	if fromHash == nil && toHash == nil {
+		return nil, nil
+	}
+
+	switch {
+	case fromHash == nil && p.FromBlock != nil, toHash == nil && p.ToBlock != nil:
+		return nil, fmt.Errorf("block referenced by hash cannot be combined with a block range")
+	case fromHash != nil && toHash != nil && !bytes.Equal(fromHash, toHash):
+		return nil, fmt.Errorf("from block %s and to block %s must reference the same block hash", fromHash.Pretty(), toHash.Pretty())
+	case fromHash != nil:
+		return fromHash, nil
+	}
+
+	return toHash, nil
+}
+
 func (c *Client) Logs(ctx context.Context, params LogsParams) ([]*LogEntry, error) {
 	result, err := c.DoRequest(ctx, "eth_getLogs", []interface{}{params})
 	if err != nil {
@@ -208,10 +298,45 @@ func (c *Client) Logs(ctx context.Context, params LogsParams) ([]*LogEntry, erro
 	return logs, nil
 }
 
-func (c *Client) GetBlockByNumber(ctx context.Context, blockNum uint64) (*Block, error) {
-	resp, err := c.DoRequest(ctx, "eth_getBlockByNumber", []interface{}{eth.Uint64(blockNum), false})
+type GetBlockOption func(*getBlockOptions)
+
+type getBlockOptions struct {
+	fullTransaction bool
+}
+
+// WithGetBlockFullTransaction requests the block's full transactions instead of only their hashes,
+// see `Block.Transactions`.
+func WithGetBlockFullTransaction() GetBlockOption {
+	return func(o *getBlockOptions) {
+		o.fullTransaction = true
+	}
+}
+
+// GetBlockByNumber fetches the block at height `blockNum`, `nil, nil` is returned if the queried node
+// does not know about it.
+func (c *Client) GetBlockByNumber(ctx context.Context, blockNum uint64, opts ...GetBlockOption) (*Block, error) {
+	return c.getBlock(ctx, "eth_getBlockByNumber", eth.Uint64(blockNum), opts)
+}
+
+// GetBlockByHash fetches the block with hash `hash`, `nil, nil` is returned if the queried node does
+// not know about it.
+func (c *Client) GetBlockByHash(ctx context.Context, hash eth.Hash, opts ...GetBlockOption) (*Block, error) {
+	return c.getBlock(ctx, "eth_getBlockByHash", hash, opts)
+}
+
+func (c *Client) getBlock(ctx context.Context, method string, blockID interface{}, opts []GetBlockOption) (*Block, error) {
+	options := &getBlockOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	resp, err := c.DoRequest(ctx, method, []interface{}{blockID, options.fullTransaction})
 	if err != nil {
-		return nil, fmt.Errorf("unable to perform eth_getBlockByNumber request: %w", err)
+		return nil, fmt.Errorf("unable to perform %s request: %w", method, err)
+	}
+
+	if resp == "" {
+		return nil, nil
 	}
 
 	var block *Block
@@ -350,12 +475,33 @@ func (c *Client) TransactionReceipt(ctx context.Context, hash eth.Hash) (out *Tr
 	return out, nil
 }
 
+// TransactionByHash fetches the transaction associated with the transaction's hash received. If the
+// transaction is not found by the queried node, `nil, nil` is returned.
+func (c *Client) TransactionByHash(ctx context.Context, hash eth.Hash) (out *Transaction, err error) {
+	resp, err := c.DoRequest(ctx, "eth_getTransactionByHash", []interface{}{hash})
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform eth_getTransactionByHash request: %w", err)
+	}
+
+	if resp == "" {
+		return nil, nil
+	}
+
+	err = json.Unmarshal([]byte(resp), &out)
+	if err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return out, nil
+}
+
 func (c *Client) GetTransactionCount(ctx context.Context, accountAddr eth.Address) (uint64, error) {
 	return c.Nonce(ctx, accountAddr)
 }
 
-func (c *Client) Nonce(ctx context.Context, accountAddr eth.Address) (uint64, error) {
-	resp, err := c.DoRequest(ctx, "eth_getTransactionCount", []interface{}{accountAddr.Pretty(), LatestBlock})
+// GetTransactionCountAtBlock is like GetTransactionCount but query the transaction count at `blockAt`.
+func (c *Client) GetTransactionCountAtBlock(ctx context.Context, accountAddr eth.Address, blockAt *BlockRef) (uint64, error) {
+	resp, err := c.DoRequest(ctx, "eth_getTransactionCount", []interface{}{accountAddr.Pretty(), blockAt})
 	if err != nil {
 		return 0, fmt.Errorf("unable to perform eth_getTransactionCount request: %w", err)
 	}
@@ -367,8 +513,17 @@ func (c *Client) Nonce(ctx context.Context, accountAddr eth.Address) (uint64, er
 	return nonce, nil
 }
 
+func (c *Client) Nonce(ctx context.Context, accountAddr eth.Address) (uint64, error) {
+	return c.GetTransactionCountAtBlock(ctx, accountAddr, LatestBlock)
+}
+
 func (c *Client) GetBalance(ctx context.Context, accountAddr eth.Address) (*eth.TokenAmount, error) {
-	resp, err := c.DoRequest(ctx, "eth_getBalance", []interface{}{accountAddr.Pretty(), LatestBlock})
+	return c.GetBalanceAtBlock(ctx, accountAddr, LatestBlock)
+}
+
+// GetBalanceAtBlock is like GetBalance but query the balance at `blockAt`.
+func (c *Client) GetBalanceAtBlock(ctx context.Context, accountAddr eth.Address, blockAt *BlockRef) (*eth.TokenAmount, error) {
+	resp, err := c.DoRequest(ctx, "eth_getBalance", []interface{}{accountAddr.Pretty(), blockAt})
 	if err != nil {
 		return nil, fmt.Errorf("unable to perform eth_getBalance request: %w", err)
 	}
@@ -399,6 +554,32 @@ func (c *Client) GasPrice(ctx context.Context) (*big.Int, error) {
 	return i, nil
 }
 
+// PendingNonce is like Nonce but query the transaction count at the "pending" block, accounting
+// for transactions of this account that sit in the node's mempool.
+func (c *Client) PendingNonce(ctx context.Context, accountAddr eth.Address) (uint64, error) {
+	return c.GetTransactionCountAtBlock(ctx, accountAddr, PendingBlock)
+}
+
+// FeeHistory returns the base fee and priority fees (for each of the requested `rewardPercentiles`) of the
+// `blockCount` blocks ending at `newestBlock`.
+func (c *Client) FeeHistory(ctx context.Context, blockCount uint64, newestBlock *BlockRef, rewardPercentiles []float64) (*FeeHistory, error) {
+	if rewardPercentiles == nil {
+		rewardPercentiles = []float64{}
+	}
+
+	resp, err := c.DoRequest(ctx, "eth_feeHistory", []interface{}{blockCount, newestBlock, rewardPercentiles})
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform eth_feeHistory request: %w", err)
+	}
+
+	out := &FeeHistory{}
+	if err := json.Unmarshal([]byte(resp), out); err != nil {
+		return nil, fmt.Errorf("unable to decode fee history from JSON: %w", err)
+	}
+
+	return out, nil
+}
+
 type RPCRequest struct {
 	Params  []interface{} `json:"params"`
 	Method  string        `json:"method"`
@@ -475,6 +656,7 @@ type ETHCall struct {
 	methodDef       *eth.MethodDef
 	atExpr          interface{}
 	responseDecoder ResponseDecoder
+	requireSuccess  bool
 }
 
 func (c *ETHCall) ToRequest() *RPCRequest {
@@ -499,7 +681,31 @@ func (c *Client) DoRequests(ctx context.Context, reqs []*RPCRequest) ([]*RPCResp
 		req.JSONRPC = "2.0"
 	}
 
-	reqsBytes, err := MarshalJSONRPC(&reqs)
+	// Each request is cached on its own, only the ones missing from the cache are sent
+	results := make([]*RPCResponse, len(reqs))
+	entries := make([]cacheEntry, len(reqs))
+	var pending []*RPCRequest
+	var pendingIndexes []int
+	for i, req := range reqs {
+		entries[i] = c.cacheEntry(ctx, logger, req)
+		if entries[i].cacheable {
+			if cached, found := c.cachedResult(ctx, logger, entries[i].key); found {
+				cached.ID = req.ID
+				cached.decoder = req.decoder
+				results[i] = cached
+				continue
+			}
+		}
+
+		pending = append(pending, req)
+		pendingIndexes = append(pendingIndexes, i)
+	}
+
+	if len(pending) == 0 {
+		return results, nil
+	}
+
+	reqsBytes, err := MarshalJSONRPC(&pending)
 	if err != nil {
 		return nil, fmt.Errorf("unable to marshal json_rpc requests: %w", err)
 	}
@@ -507,38 +713,45 @@ func (c *Client) DoRequests(ctx context.Context, reqs []*RPCRequest) ([]*RPCResp
 		logger.Debug("json_rpc requests", zap.Stringer("requests", eth.Hex(reqsBytes)))
 	}
 
-	var cacheKey string
-	if c.cache != nil {
-		cacheKey = hex.EncodeToString(sha256.New().Sum(reqsBytes))
-	}
+	var resp []byte
+	var received []*RPCResponse
+	err = c.withRetries(ctx, logger, func() (err error) {
+		received = nil
+		resp, err = c.doRequest(ctx, logger, reqsBytes, methodsFromRPCRequests(pending))
+		if err != nil {
+			return err
+		}
 
-	resp, err := c.doRequest(ctx, logger, reqsBytes, cacheKey)
-	if err != nil {
-		return nil, err
-	}
+		parsed, err := parseRPCResults(logger, resp)
+		if err != nil {
+			return err
+		}
 
-	results, err := parseRPCResults(logger, resp)
-	if err != nil {
+		// Errors of individual requests are part of the results, the whole batch is sent again if one is transient
+		received = matchRPCResults(logger, pending, parsed)
+		for _, result := range received {
+			if IsRetryableError(result.Err) {
+				return result.Err
+			}
+		}
+		return nil
+	})
+	if received == nil {
 		return nil, err
 	}
 
-	if len(results) != len(reqs) {
-		logger.Warn("invalid number of results", zap.Int("len_results", len(results)), zap.Int("len_reqs", len(reqs)))
-		return nil, fmt.Errorf("invalid number of results")
+	var raws map[int]string
+	if c.cache != nil {
+		raws = rawRPCResponses(resp)
 	}
 
-	if c.cache != nil {
-		deterministic := true
-		for i, req := range reqs {
-			results[i].decoder = req.decoder
-			if !results[i].Deterministic() {
-				deterministic = false
-				break
-			}
-		}
+	for j, result := range received {
+		i := pendingIndexes[j]
+		result.decoder = reqs[i].decoder
+		results[i] = result
 
-		if deterministic {
-			c.cache.Set(ctx, cacheKey, resp)
+		if entries[i].cacheable {
+			c.storeResult(ctx, entries[i], result, raws[result.ID])
 		}
 	}
 
@@ -554,6 +767,14 @@ func (c *Client) DoRequest(ctx context.Context, method string, params []interfac
 		Method:  method,
 		ID:      1,
 	}
+
+	entry := c.cacheEntry(ctx, logger, &req)
+	if entry.cacheable {
+		if cached, found := c.cachedResult(ctx, logger, entry.key); found {
+			return cached.Content, cached.Err
+		}
+	}
+
 	reqCnt, err := MarshalJSONRPC(&req)
 	if err != nil {
 		return "", fmt.Errorf("unable to marshal json_rpc request: %w", err)
@@ -563,71 +784,114 @@ func (c *Client) DoRequest(ctx context.Context, method string, params []interfac
 		logger.Debug("json_rpc request", zap.String("request", string(reqCnt)))
 	}
 
-	cacheKey := hex.EncodeToString(sha256.New().Sum(reqCnt))
+	var resp []byte
+	var results []*RPCResponse
+	err = c.withRetries(ctx, logger, func() (err error) {
+		results = nil
+		resp, err = c.doRequest(ctx, logger, reqCnt, []string{method})
+		if err != nil {
+			return err
+		}
 
-	resp, err := c.doRequest(ctx, logger, reqCnt, cacheKey)
-	if err != nil {
-		return "", err
-	}
+		parsed, err := parseRPCResults(logger, resp)
+		if err != nil {
+			return err
+		}
+		if len(parsed) != 1 {
+			return fmt.Errorf("received no result than number of requests")
+		}
 
-	results, err := parseRPCResults(logger, resp)
-	if err != nil {
+		results = parsed
+		return results[0].Err
+	})
+	if results == nil {
 		return "", err
 	}
-	if len(results) != 1 {
-		return "", fmt.Errorf("received no result than number of requests")
-	}
 
-	if c.cache != nil && results[0].Deterministic() {
-		c.cache.Set(ctx, cacheKey, resp)
+	if entry.cacheable {
+		c.storeResult(ctx, entry, results[0], string(resp))
 	}
 
 	return results[0].Content, results[0].Err
 }
 
-func (c *Client) doRequest(ctx context.Context, logger *zap.Logger, reqsBytes []byte, cacheKey string) ([]byte, error) {
-	if c.cache != nil {
-		cachedData, found := c.cache.Get(ctx, cacheKey)
-		if found {
-			if tracer.Enabled() {
-				logger.Debug("retrieve request's response from cache", zap.String("key", cacheKey))
-			}
+// cachedResult returns the response stored in the cache under `key`, if any.
+func (c *Client) cachedResult(ctx context.Context, logger *zap.Logger, key string) (*RPCResponse, bool) {
+	cachedData, found := c.cache.Get(ctx, key)
+	if !found {
+		return nil, false
+	}
 
-			return cachedData, nil
-		}
+	results, err := parseRPCResults(logger, cachedData)
+	if err != nil || len(results) != 1 {
+		logger.Warn("ignoring invalid cached response", zap.String("key", key), zap.Error(err))
+		return nil, false
 	}
 
-	body := bytes.NewBuffer(reqsBytes)
+	if tracer.Enabled() {
+		logger.Debug("retrieve request's response from cache", zap.String("key", key))
+	}
 
-	resp, err := c.post(ctx, c.URL, body)
-	if err != nil {
-		return nil, fmt.Errorf("sending request to json_rpc endpoint: %w", err)
+	return results[0], true
+}
+
+// storeResult caches the response, `raw` being its JSON-RPC payload, if it's final. A `null`
+// result, like the receipt of a transaction not mined yet, may be available later and a pending
+// transaction, without block hash, is mined later.
+func (c *Client) storeResult(ctx context.Context, entry cacheEntry, result *RPCResponse, raw string) {
+	if !result.Deterministic() || raw == "" {
+		return
 	}
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("error in response: %d", resp.StatusCode)
+
+	if result.Err == nil && gjson.Get(raw, "result").Type == gjson.Null {
+		return
 	}
-	defer resp.Body.Close()
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("unable to read json_rpc response body: %w", err)
+	if entry.mined && (c.finality == nil || gjson.Get(raw, "result.blockHash").Type != gjson.String) {
+		return
 	}
 
-	if tracer.Enabled() {
-		logger.Debug("json_rpc call response", zap.String("response_body", string(bodyBytes)))
+	if c.finality != nil && !c.finality.trackResult(ctx, entry.key, raw) {
+		return
 	}
 
-	return bodyBytes, nil
+	c.cache.Set(ctx, entry.key, []byte(raw), entry.ttl)
 }
 
-func (c *Client) post(ctx context.Context, url string, body io.Reader) (resp *http.Response, err error) {
-	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+// rawRPCResponses returns the JSON payload of each response of `in` by ID.
+func rawRPCResponses(in []byte) map[int]string {
+	responses := []gjson.Result{}
+
+	parsed := gjson.ParseBytes(in)
+	if parsed.IsArray() {
+		responses = parsed.Array()
+	} else {
+		responses = append(responses, parsed)
+	}
+
+	out := map[int]string{}
+	for _, response := range responses {
+		if id, ok := parseRPCID(response.Get("id").Raw); ok {
+			if _, found := out[id]; !found {
+				out[id] = response.Raw
+			}
+		}
+	}
+
+	return out
+}
+
+func (c *Client) doRequest(ctx context.Context, logger *zap.Logger, reqsBytes []byte, methods []string) ([]byte, error) {
+	bodyBytes, err := c.roundTrip(ctx, reqsBytes, methods)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("sending request to json_rpc endpoint: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	return c.httpClient.Do(req)
+	if tracer.Enabled() {
+		logger.Debug("json_rpc call response", zap.String("response_body", string(bodyBytes)))
+	}
+
+	return bodyBytes, nil
 }
 
 func parseRPCResults(logger *zap.Logger, in []byte) ([]*RPCResponse, error) {
@@ -643,9 +907,11 @@ func parseRPCResults(logger *zap.Logger, in []byte) ([]*RPCResponse, error) {
 
 	var out []*RPCResponse
 	for _, response := range responses {
+		id, _ := parseRPCID(response.Get("id").Raw)
+
 		rpcErrorResult := response.Get("error")
 		if !rpcErrorResult.Exists() {
-			out = append(out, &RPCResponse{Content: response.Get("result").String(), ID: int(hex2uint64(response.Get("id").String()))})
+			out = append(out, &RPCResponse{Content: response.Get("result").String(), ID: id})
 			continue
 		}
 
@@ -664,16 +930,121 @@ func parseRPCResults(logger *zap.Logger, in []byte) ([]*RPCResponse, error) {
 			return nil, fmt.Errorf("json_rpc returned error: %s", rpcErrorResult)
 		}
 
-		out = append(out, &RPCResponse{Err: rpcErr, ID: int(hex2uint64(response.Get("id").String()))})
+		out = append(out, &RPCResponse{Err: rpcErr, ID: id})
 	}
 
-	sort.Slice(out, func(i, j int) bool {
+	sort.SliceStable(out, func(i, j int) bool {
 		return out[i].ID < out[j].ID
 	})
 
 	return out, nil
 }
 
+// matchRPCResults returns the response of each request, matched by ID. Requests the node did not
+// answer get an `ErrMissingResponse` error, or the error the node answered for the whole batch if
+// it did, and requests answered more than once get an `ErrDuplicateResponse` error.
+func matchRPCResults(logger *zap.Logger, reqs []*RPCRequest, results []*RPCResponse) []*RPCResponse {
+	byID := make(map[int]*RPCResponse, len(results))
+	duplicates := map[int]bool{}
+	var batchErr error
+	for _, result := range results {
+		if result.ID == 0 {
+			// A response without identifier is the node rejecting the batch as a whole
+			if result.Err != nil {
+				batchErr = result.Err
+			}
+			continue
+		}
+
+		if _, found := byID[result.ID]; found {
+			duplicates[result.ID] = true
+			continue
+		}
+		byID[result.ID] = result
+	}
+
+	out := make([]*RPCResponse, len(reqs))
+	matched := 0
+	for i, req := range reqs {
+		result, found := byID[req.ID]
+		switch {
+		case duplicates[req.ID]:
+			out[i] = &RPCResponse{ID: req.ID, Err: ErrDuplicateResponse}
+		case found:
+			out[i] = result
+			matched++
+		case batchErr != nil:
+			out[i] = &RPCResponse{ID: req.ID, Err: batchErr}
+		default:
+			out[i] = &RPCResponse{ID: req.ID, Err: ErrMissingResponse}
+		}
+	}
+
+	if matched != len(reqs) || len(results) != len(reqs) {
+		logger.Warn("batch responses do not match requests", zap.Int("len_results", len(results)), zap.Int("len_reqs", len(reqs)), zap.Int("matched", matched), zap.Int("duplicates", len(duplicates)))
+	}
+
+	return out
+}
+
+// parseRPCID parses the raw JSON identifier of a response, identifiers are sent as hexadecimal
+// quantities and echoed as is by nodes, but some providers turn them into decimal numbers.
+func parseRPCID(raw string) (id int, ok bool) {
+	value := strings.TrimSpace(raw)
+	base := 10
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+		if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+			value = value[2:]
+			base = 16
+		}
+	}
+
+	parsed, err := strconv.ParseUint(value, base, 31)
+	if err != nil {
+		return 0, false
+	}
+
+	return int(parsed), true
+}
+
+// roundTrip sends the encoded requests through the client's transport, once allowed by its rate limiter.
+func (c *Client) roundTrip(ctx context.Context, reqsBytes []byte, methods []string) ([]byte, error) {
+	if c.rateLimiter != nil {
+		if err := c.rateLimiter.acquire(ctx, methods); err != nil {
+			return nil, err
+		}
+	}
+
+	transport := c.transport
+	if c.batcher != nil {
+		transport = c.batcher
+	}
+
+	return transport.RoundTrip(ctx, reqsBytes)
+}
+
+// sendRaw is `roundTrip` for already encoded requests, retrying transport errors following the
+// client's retry policy.
+func (c *Client) sendRaw(ctx context.Context, reqsBytes []byte) (out []byte, err error) {
+	var methods []string
+	gjson.ParseBytes(reqsBytes).ForEach(func(key, value gjson.Result) bool {
+		if key.String() == "method" {
+			methods = append(methods, value.String())
+		} else if method := value.Get("method"); method.Exists() {
+			methods = append(methods, method.String())
+		}
+		return true
+	})
+
+	err = c.withRetries(ctx, logging.Logger(ctx, zlog), func() (err error) {
+		out, err = c.roundTrip(ctx, reqsBytes, methods)
+		return err
+	})
+
+	return out, err
+}
+
 func methodsFromRPCRequests(requests []*RPCRequest) (out []string) {
 	out = make([]string, len(requests))
 	for i, v := range requests {
@@ -682,9 +1053,3 @@ func methodsFromRPCRequests(requests []*RPCRequest) (out []string) {
 
 	return
 }
-
-func hex2uint64(hexStr string) uint64 {
-	cleaned := strings.Replace(hexStr, "0x", "", -1)
-	result, _ := strconv.ParseUint(cleaned, 16, 64)
-	return result
-}
@@ -182,3 +182,180 @@ func (s *mockJSONRPCServer) RequestBody(t *testing.T) (out map[string]interface{
 
 	return out
 }
+
+func TestRPC_GetBlock(t *testing.T) {
+	block := func(transactions []interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"number":                "0x1312d00",
+			"hash":                  "0x1d5c1b3a1a6e0b3c38b1e5a7f2f2bfa0b7e4e2b3e2e0a3b2f7f1c8c9d0e1f2a3",
+			"difficulty":            "0x0",
+			"totalDifficulty":       "0xc70d815d562d3cfa955",
+			"baseFeePerGas":         "0x7",
+			"blobGasUsed":           "0x20000",
+			"excessBlobGas":         "0x0",
+			"parentBeaconBlockRoot": "0x2a",
+			"withdrawalsRoot":       "0x2b",
+			"withdrawals":           []interface{}{map[string]interface{}{"index": "0x1", "validatorIndex": "0x2", "address": "0x3535353535353535353535353535353535353535", "amount": "0x3b9aca00"}},
+			"transactions":          transactions,
+		}
+	}
+
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_getBlockByNumber": block([]interface{}{testTrxHash.Pretty()}),
+		"eth_getBlockByHash": block([]interface{}{
+			map[string]interface{}{"hash": testTrxHash.Pretty(), "type": "0x2", "nonce": "0x5", "from": testAccount.Pretty(), "value": "0xde0b6b3a7640000", "gas": "0x5208", "input": "0x", "maxFeePerGas": "0x2540be400", "accessList": []interface{}{}},
+		}),
+	})
+	defer closer()
+
+	client := NewClient(server.URL)
+
+	byNumber, err := client.GetBlockByNumber(context.Background(), 20000000)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"0x1312d00", false}, server.Params(t, "eth_getBlockByNumber"))
+
+	assert.False(t, byNumber.Transactions.IsFull())
+	assert.Equal(t, []eth.Hash{testTrxHash}, byNumber.Transactions.Hashes)
+	assert.Equal(t, "0", byNumber.Difficulty.String())
+	assert.Equal(t, "58750003716598352816469", byNumber.TotalDifficulty.String())
+	assert.Equal(t, ethUint64Ptr(0x20000), byNumber.BlobGasUsed)
+	assert.Equal(t, ethUint64Ptr(0), byNumber.ExcessBlobGas)
+	assert.Equal(t, eth.MustNewHash("0x2a"), byNumber.ParentBeaconBlockRoot)
+	assert.Equal(t, eth.MustNewHash("0x2b"), byNumber.WithdrawalsRoot)
+	assert.Equal(t, []*Withdrawal{{Index: 1, ValidatorIndex: 2, Address: eth.MustNewAddress("0x3535353535353535353535353535353535353535"), Amount: 1_000_000_000}}, byNumber.Withdrawals)
+	assert.Equal(t, "1000000000000000000", byNumber.Withdrawals[0].AmountWei().String())
+
+	byHash, err := client.GetBlockByHash(context.Background(), byNumber.Hash, WithGetBlockFullTransaction())
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{byNumber.Hash.Pretty(), true}, server.Params(t, "eth_getBlockByHash"))
+
+	assert.True(t, byHash.Transactions.IsFull())
+	assert.Equal(t, []eth.Hash{testTrxHash}, byHash.Transactions.Hashes)
+	require.Len(t, byHash.Transactions.Transactions, 1)
+	assert.Equal(t, eth.Uint64(2), byHash.Transactions.Transactions[0].Type)
+	assert.Equal(t, "1000000000000000000", byHash.Transactions.Transactions[0].Value.String())
+}
+
+func TestRPC_AtBlock(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_getBalance":          "0x2a",
+		"eth_getTransactionCount": "0x3",
+	})
+	defer closer()
+
+	client := NewClient(server.URL)
+	ctx := context.Background()
+	hash := eth.MustNewHash("0xc1ea26a4b5b2a0a2b7c8eb4d69f2c2f7e0b4a77c5bde7f58d0f5b5aab5fa1c11")
+
+	balance, err := client.GetBalanceAtBlock(ctx, testAccount, CanonicalBlockHash(hash))
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(42), balance.Amount)
+	assert.Equal(t, []interface{}{
+		"0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f",
+		map[string]interface{}{"blockHash": hash.Pretty(), "requireCanonical": true},
+	}, server.Params(t, "eth_getBalance"))
+
+	nonce, err := client.GetTransactionCountAtBlock(ctx, testAccount, SafeBlock)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), nonce)
+	assert.Equal(t, []interface{}{"0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f", "safe"}, server.Params(t, "eth_getTransactionCount"))
+}
+
+func TestRPC_DoRequests_MatchByID(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		expected []*RPCResponse
+	}{
+		{
+			"out of order",
+			`[{"id":"0xb","result":"0x0b"},{"id":"0x2","result":"0x02"},{"id":"0x1","result":"0x01"}]`,
+			[]*RPCResponse{{ID: 1, Content: "0x01"}, {ID: 2, Content: "0x02"}, {ID: 11, Content: "0x0b"}},
+		},
+		{
+			"decimal identifiers",
+			`[{"id":11,"result":"0x0b"},{"id":"2","result":"0x02"},{"id":1,"result":"0x01"}]`,
+			[]*RPCResponse{{ID: 1, Content: "0x01"}, {ID: 2, Content: "0x02"}, {ID: 11, Content: "0x0b"}},
+		},
+		{
+			"truncated",
+			`[{"id":"0x1","result":"0x01"}]`,
+			[]*RPCResponse{{ID: 1, Content: "0x01"}, {ID: 2, Err: ErrMissingResponse}, {ID: 11, Err: ErrMissingResponse}},
+		},
+		{
+			"duplicate and unknown",
+			`[{"id":"0x1","result":"0x01"},{"id":"0x2","result":"0x02"},{"id":"0x2","result":"0x03"},{"id":"0xc","result":"0x0c"},{"id":"0xb","result":"0x0b"}]`,
+			[]*RPCResponse{{ID: 1, Content: "0x01"}, {ID: 2, Err: ErrDuplicateResponse}, {ID: 11, Content: "0x0b"}},
+		},
+		{
+			"batch rejected",
+			`{"id":null,"error":{"code":-32600,"message":"batch too large"}}`,
+			[]*RPCResponse{{ID: 1, Err: &ErrResponse{Code: -32600, Message: "batch too large"}}, {ID: 2, Err: &ErrResponse{Code: -32600, Message: "batch too large"}}, {ID: 11, Err: &ErrResponse{Code: -32600, Message: "batch too large"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, closer := mockJSONRPC(t, json.RawMessage(test.response))
+			defer closer()
+
+			reqs := make([]*RPCRequest, 11)
+			for i := range reqs {
+				reqs[i] = &RPCRequest{Method: "eth_blockNumber"}
+			}
+
+			results, err := NewClient(server.URL).DoRequests(context.Background(), reqs)
+			require.NoError(t, err)
+			require.Len(t, results, 11)
+
+			assert.Equal(t, test.expected, []*RPCResponse{results[0], results[1], results[10]})
+		})
+	}
+}
+
+func TestParseRPCID(t *testing.T) {
+	tests := []struct {
+		raw        string
+		expected   int
+		expectedOK bool
+	}{
+		{`"0x10"`, 16, true},
+		{`"10"`, 10, true},
+		{`10`, 10, true},
+		{`null`, 0, false},
+		{``, 0, false},
+		{`"abc"`, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			id, ok := parseRPCID(test.raw)
+			assert.Equal(t, test.expected, id)
+			assert.Equal(t, test.expectedOK, ok)
+		})
+	}
+}
+
+func TestBlockTransactions_JSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"empty", `[]`},
+		{"hashes", `["0x8e4d4b2d4c8bdc0f0d8ab2e1f1fc51bfa8a85d7bb5f0ce0c9ac4c3b9d9c2d2f1"]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var transactions BlockTransactions
+			require.NoError(t, json.Unmarshal([]byte(test.in), &transactions))
+
+			out, err := json.Marshal(transactions)
+			require.NoError(t, err)
+
+			var actual BlockTransactions
+			require.NoError(t, json.Unmarshal(out, &actual))
+			assert.Equal(t, transactions, actual)
+		})
+	}
+}
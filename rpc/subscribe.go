@@ -0,0 +1,119 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/streamingfast/eth-go"
+)
+
+var ErrSubscriptionsUnsupported = errors.New("transport does not support subscriptions")
+
+// SubscribeNewHeads delivers the header of each new block appended to the canonical chain on `ch`,
+// the blocks have no transactions. The subscription ends when `ctx` is canceled. It requires a
+// streaming transport like WebSocket.
+func (c *Client) SubscribeNewHeads(ctx context.Context, ch chan<- *Block) (*Subscription, error) {
+	transport, err := c.streamingTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	return subscribeNewHeads(ctx, transport, ch)
+}
+
+// SubscribeLogs delivers the logs matching `params` on `ch` as blocks are appended to the canonical
+// chain, logs of blocks removed by a reorg are sent again with `Removed` set. Block range parameters
+// are not supported by nodes for subscriptions and are ignored. The subscription ends when `ctx` is
+// canceled. It requires a streaming transport like WebSocket.
+func (c *Client) SubscribeLogs(ctx context.Context, params LogsParams, ch chan<- *LogEntry) (*Subscription, error) {
+	transport, err := c.streamingTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	return subscribeLogs(ctx, transport, params, ch)
+}
+
+// SubscribeNewPendingTransactions delivers the hash of each transaction entering the node's pending
+// pool on `ch`. The subscription ends when `ctx` is canceled. It requires a streaming transport like
+// WebSocket.
+func (c *Client) SubscribeNewPendingTransactions(ctx context.Context, ch chan<- eth.Hash) (*Subscription, error) {
+	transport, err := c.streamingTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	return subscribeNewPendingTransactions(ctx, transport, ch)
+}
+
+func (c *Client) streamingTransport() (StreamingTransport, error) {
+	transport, ok := c.transport.(StreamingTransport)
+	if !ok {
+		return nil, ErrSubscriptionsUnsupported
+	}
+
+	return transport, nil
+}
+
+func subscribeNewHeads(ctx context.Context, transport StreamingTransport, ch chan<- *Block) (*Subscription, error) {
+	return transport.Subscribe(ctx, []interface{}{"newHeads"}, func(ctx context.Context, result json.RawMessage) error {
+		block := &Block{}
+		if err := json.Unmarshal(result, block); err != nil {
+			return fmt.Errorf("decode block header: %w", err)
+		}
+
+		select {
+		case ch <- block:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+}
+
+func subscribeLogs(ctx context.Context, transport StreamingTransport, params LogsParams, ch chan<- *LogEntry) (*Subscription, error) {
+	filter := LogsParams{Address: params.Address, Topics: params.Topics}
+
+	return transport.Subscribe(ctx, []interface{}{"logs", filter}, func(ctx context.Context, result json.RawMessage) error {
+		log := &LogEntry{}
+		if err := json.Unmarshal(result, log); err != nil {
+			return fmt.Errorf("decode log: %w", err)
+		}
+
+		select {
+		case ch <- log:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+}
+
+func subscribeNewPendingTransactions(ctx context.Context, transport StreamingTransport, ch chan<- eth.Hash) (*Subscription, error) {
+	return transport.Subscribe(ctx, []interface{}{"newPendingTransactions"}, func(ctx context.Context, result json.RawMessage) error {
+		var hash eth.Hash
+		if err := json.Unmarshal(result, &hash); err != nil {
+			return fmt.Errorf("decode transaction hash: %w", err)
+		}
+
+		select {
+		case ch <- hash:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+}
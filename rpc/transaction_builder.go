@@ -0,0 +1,386 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/eth-go/signer"
+	"github.com/streamingfast/logging"
+	"go.uber.org/zap"
+)
+
+// TransactionRequest holds the transaction's fields to build. Any field left
+// to its zero value is filled by the TransactionBuilder before signing.
+type TransactionRequest struct {
+	// To is the address the transaction is directed to, `nil` for a contract creation transaction.
+	To eth.Address
+	// Value is the amount of Wei sent with this transaction, `0` when `nil`.
+	Value *big.Int
+	// Data is the transaction's input data.
+	Data []byte
+
+	// Nonce is the transaction's nonce, the account's pending nonce (or the next one reserved through
+	// the NonceManager if configured) is used when `nil`.
+	Nonce *uint64
+	// ChainID is the chain's ID, fetched through `eth_chainId` when `nil`.
+	ChainID *big.Int
+	// GasLimit is the maximum amount of gas the transaction can use, estimated
+	// through `eth_estimateGas` when `0`.
+	GasLimit uint64
+
+	// GasPrice is the gas price of a legacy transaction. When set, the transaction is
+	// always signed as a legacy transaction and the dynamic fee fields are ignored.
+	GasPrice *big.Int
+	// MaxFeePerGas is the EIP-1559 maximum total fee per gas the sender is willing to pay.
+	MaxFeePerGas *big.Int
+	// MaxPriorityFeePerGas is the EIP-1559 maximum priority fee per gas (the miner's tip)
+	// the sender is willing to pay.
+	MaxPriorityFeePerGas *big.Int
+}
+
+// IsDynamicFee returns `true` if the request is for an EIP-1559 transaction, e.g. it has
+// its dynamic fee fields set and no legacy gas price.
+func (r *TransactionRequest) IsDynamicFee() bool {
+	return r.GasPrice == nil && r.MaxFeePerGas != nil && r.MaxPriorityFeePerGas != nil
+}
+
+type TransactionBuilderOption func(*TransactionBuilder)
+
+// WithGasLimitMultiplier multiplies the gas limit estimated through `eth_estimateGas`
+// by `multiplier` to give some leeway to transactions whose gas usage depends on the
+// state at inclusion time. The default multiplier is `1.0`.
+func WithGasLimitMultiplier(multiplier float64) TransactionBuilderOption {
+	return func(b *TransactionBuilder) {
+		b.gasLimitMultiplier = multiplier
+	}
+}
+
+// WithFeeHistory configures the `eth_feeHistory` query used to compute EIP-1559 fees. The
+// priority fee is the median of the `rewardPercentile` priority fees paid over the last
+// `blockCount` blocks. Defaults to the 50th percentile over the last 10 blocks.
+func WithFeeHistory(blockCount uint64, rewardPercentile float64) TransactionBuilderOption {
+	return func(b *TransactionBuilder) {
+		b.feeHistoryBlockCount = blockCount
+		b.feeHistoryRewardPercentile = rewardPercentile
+	}
+}
+
+// WithBaseFeeMultiplier sets how many times the next block's base fee is accounted for in the
+// max fee per gas, protecting the transaction against base fee increases while it's pending.
+// Defaults to `2`, which keeps the transaction includable for at least 6 consecutive full blocks.
+func WithBaseFeeMultiplier(multiplier uint64) TransactionBuilderOption {
+	return func(b *TransactionBuilder) {
+		b.baseFeeMultiplier = multiplier
+	}
+}
+
+// WithLegacyTransactions forces the builder to always produce legacy transactions, even when
+// the chain and the signer both support EIP-1559 transactions.
+func WithLegacyTransactions() TransactionBuilderOption {
+	return func(b *TransactionBuilder) {
+		b.legacyOnly = true
+	}
+}
+
+// WithNonceManager reserves the nonces of transactions through `manager` instead of querying
+// the node's pending nonce for each of them. Nonces reserved by Fill are the responsibility of
+// the caller, Sign and Send give them back to the manager when the transaction could not be
+// signed or sent.
+func WithNonceManager(manager *NonceManager) TransactionBuilderOption {
+	return func(b *TransactionBuilder) {
+		b.nonceManager = manager
+	}
+}
+
+// TransactionBuilder fills the missing fields of a TransactionRequest (nonce, chain ID, gas limit
+// and fees) by querying the node through the Client, signs the transaction through the Signer
+// and optionally sends it.
+//
+// EIP-1559 transactions are built when the Signer implements `signer.DynamicFeeSigner` and
+// the chain reports a base fee, otherwise legacy transactions are built.
+type TransactionBuilder struct {
+	client *Client
+	signer signer.Signer
+	from   eth.Address
+
+	gasLimitMultiplier         float64
+	feeHistoryBlockCount       uint64
+	feeHistoryRewardPercentile float64
+	baseFeeMultiplier          uint64
+	legacyOnly                 bool
+	nonceManager               *NonceManager
+}
+
+func NewTransactionBuilder(client *Client, signer signer.Signer, from eth.Address, opts ...TransactionBuilderOption) *TransactionBuilder {
+	b := &TransactionBuilder{
+		client: client,
+		signer: signer,
+		from:   from,
+
+		gasLimitMultiplier:         1.0,
+		feeHistoryBlockCount:       10,
+		feeHistoryRewardPercentile: 50,
+		baseFeeMultiplier:          2,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// Fill returns a copy of `req` with all its missing fields filled.
+func (b *TransactionBuilder) Fill(ctx context.Context, req *TransactionRequest) (*TransactionRequest, error) {
+	out := *req
+	if out.Value == nil {
+		out.Value = new(big.Int)
+	}
+
+	if out.ChainID == nil {
+		chainID, err := b.client.ChainID(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("chain id: %w", err)
+		}
+
+		out.ChainID = chainID
+	}
+
+	if out.GasLimit == 0 {
+		gasLimit, err := b.estimateGas(ctx, &out)
+		if err != nil {
+			return nil, fmt.Errorf("gas limit: %w", err)
+		}
+
+		out.GasLimit = gasLimit
+	}
+
+	if err := b.fillFees(ctx, &out); err != nil {
+		return nil, fmt.Errorf("fees: %w", err)
+	}
+
+	// Nonce is filled last so that a reserved nonce is never lost because filling another field failed
+	if out.Nonce == nil {
+		nonce, err := b.nextNonce(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("nonce: %w", err)
+		}
+
+		out.Nonce = &nonce
+	}
+
+	return &out, nil
+}
+
+func (b *TransactionBuilder) nextNonce(ctx context.Context) (uint64, error) {
+	if b.nonceManager != nil {
+		return b.nonceManager.Reserve(ctx, b.from)
+	}
+
+	return b.client.PendingNonce(ctx, b.from)
+}
+
+func (b *TransactionBuilder) estimateGas(ctx context.Context, req *TransactionRequest) (uint64, error) {
+	params := CallParams{From: b.from, To: req.To, Value: req.Value}
+	if len(req.Data) > 0 {
+		params.Data = req.Data
+	}
+
+	resp, err := b.client.EstimateGas(ctx, params)
+	if err != nil {
+		return 0, err
+	}
+
+	estimated, err := strconv.ParseUint(resp, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse gas estimate %s: %w", resp, err)
+	}
+
+	if b.gasLimitMultiplier <= 1.0 {
+		return estimated, nil
+	}
+
+	return uint64(math.Ceil(float64(estimated) * b.gasLimitMultiplier)), nil
+}
+
+func (b *TransactionBuilder) fillFees(ctx context.Context, req *TransactionRequest) error {
+	if req.GasPrice != nil {
+		return nil
+	}
+
+	if !b.canSignDynamicFee() {
+		if req.MaxFeePerGas != nil {
+			req.GasPrice = req.MaxFeePerGas
+			return nil
+		}
+
+		return b.fillGasPrice(ctx, req)
+	}
+
+	if req.MaxFeePerGas != nil && req.MaxPriorityFeePerGas != nil {
+		return nil
+	}
+
+	history, err := b.client.FeeHistory(ctx, b.feeHistoryBlockCount, LatestBlock, []float64{b.feeHistoryRewardPercentile})
+	if err != nil {
+		return err
+	}
+
+	nextBaseFee := history.NextBaseFee()
+	if nextBaseFee == 0 {
+		// Chain does not support EIP-1559, fallback to a legacy transaction
+		return b.fillGasPrice(ctx, req)
+	}
+
+	if req.MaxPriorityFeePerGas == nil {
+		req.MaxPriorityFeePerGas = medianReward(history)
+	}
+
+	if req.MaxFeePerGas == nil {
+		maxFee := new(big.Int).SetUint64(nextBaseFee)
+		maxFee.Mul(maxFee, new(big.Int).SetUint64(b.baseFeeMultiplier))
+		req.MaxFeePerGas = maxFee.Add(maxFee, req.MaxPriorityFeePerGas)
+	}
+
+	if req.MaxFeePerGas.Cmp(req.MaxPriorityFeePerGas) < 0 {
+		return fmt.Errorf("max fee per gas %s is lower than max priority fee per gas %s", req.MaxFeePerGas, req.MaxPriorityFeePerGas)
+	}
+
+	return nil
+}
+
+func (b *TransactionBuilder) fillGasPrice(ctx context.Context, req *TransactionRequest) error {
+	gasPrice, err := b.client.GasPrice(ctx)
+	if err != nil {
+		return err
+	}
+
+	req.GasPrice = gasPrice
+	req.MaxFeePerGas = nil
+	req.MaxPriorityFeePerGas = nil
+	return nil
+}
+
+func (b *TransactionBuilder) canSignDynamicFee() bool {
+	if b.legacyOnly {
+		return false
+	}
+
+	_, ok := b.signer.(signer.DynamicFeeSigner)
+	return ok
+}
+
+// medianReward returns the median of the first percentile's rewards paid in each block
+// of the fee history, blocks that were empty (reward of 0) are ignored.
+func medianReward(history *FeeHistory) *big.Int {
+	var rewards []uint64
+	for _, blockRewards := range history.Reward {
+		if len(blockRewards) == 0 || blockRewards[0] == 0 {
+			continue
+		}
+
+		rewards = append(rewards, uint64(blockRewards[0]))
+	}
+
+	if len(rewards) == 0 {
+		return new(big.Int)
+	}
+
+	sort.Slice(rewards, func(i, j int) bool { return rewards[i] < rewards[j] })
+	return new(big.Int).SetUint64(rewards[len(rewards)/2])
+}
+
+// Sign fills the missing fields of `req` then signs the transaction, returning the signed encoded transaction
+// ready to be sent as well as the filled request that was signed.
+func (b *TransactionBuilder) Sign(ctx context.Context, req *TransactionRequest) (signed []byte, filled *TransactionRequest, err error) {
+	filled, err = b.Fill(ctx, req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fill transaction: %w", err)
+	}
+
+	if b.nonceReserved(req) {
+		// The error paths reset `filled`, the reserved nonce must be captured beforehand
+		nonce := *filled.Nonce
+		defer func() {
+			if err != nil {
+				b.nonceManager.Release(ctx, b.from, nonce)
+			}
+		}()
+	}
+
+	if chainIDSigner, ok := b.signer.(interface{ ChainID() *big.Int }); ok {
+		if signerChainID := chainIDSigner.ChainID(); signerChainID != nil && signerChainID.Cmp(filled.ChainID) != 0 {
+			return nil, nil, fmt.Errorf("signer chain id %s does not match transaction chain id %s", signerChainID, filled.ChainID)
+		}
+	}
+
+	if filled.IsDynamicFee() {
+		signed, err = b.signer.(signer.DynamicFeeSigner).SignDynamicFeeTransaction(*filled.Nonce, filled.To, filled.Value, filled.GasLimit, filled.MaxFeePerGas, filled.MaxPriorityFeePerGas, filled.Data)
+	} else {
+		signed, err = b.signer.SignTransaction(*filled.Nonce, filled.To, filled.Value, filled.GasLimit, filled.GasPrice, filled.Data)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("sign transaction: %w", err)
+	}
+
+	return signed, filled, nil
+}
+
+// Send fills, signs and sends the transaction through `eth_sendRawTransaction`, returning
+// the transaction's hash.
+func (b *TransactionBuilder) Send(ctx context.Context, req *TransactionRequest) (eth.Hash, error) {
+	signed, filled, err := b.Sign(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Logger(ctx, zlog).Debug("sending transaction",
+		zap.Stringer("from", b.from),
+		zap.Uint64("nonce", *filled.Nonce),
+		zap.Uint64("gas_limit", filled.GasLimit),
+		zap.Bool("dynamic_fee", filled.IsDynamicFee()),
+	)
+
+	resp, err := b.client.SendRawTransaction(ctx, signed)
+	if err != nil && b.nonceReserved(req) {
+		if err = b.nonceManager.HandleSendError(ctx, b.from, *filled.Nonce, err); err == nil {
+			// Already known by the node, its hash is the hash of the signed transaction
+			return eth.Keccak256(signed), nil
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("send transaction: %w", err)
+	}
+
+	hash, err := eth.NewHash(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction hash: %w", err)
+	}
+
+	return hash, nil
+}
+
+func (b *TransactionBuilder) nonceReserved(req *TransactionRequest) bool {
+	return b.nonceManager != nil && req.Nonce == nil
+}
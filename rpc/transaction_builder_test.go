@@ -0,0 +1,280 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/eth-go/signer/native"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTransactionBuilder_Fill(t *testing.T) {
+	tests := []struct {
+		name     string
+		results  map[string]interface{}
+		opts     []TransactionBuilderOption
+		in       *TransactionRequest
+		expected *TransactionRequest
+	}{
+		{
+			name: "dynamic fee",
+			results: map[string]interface{}{
+				"eth_chainId":             "0x1",
+				"eth_getTransactionCount": "0x9",
+				"eth_estimateGas":         "0x5208",
+				"eth_feeHistory": map[string]interface{}{
+					"oldestBlock":   "0x10",
+					"baseFeePerGas": []string{"0x3b9aca00", "0x3b9aca00", "0x77359400"},
+					"gasUsedRatio":  []float64{0.5, 0.9},
+					"reward":        [][]string{{"0x3b9aca00"}, {"0x77359400"}},
+				},
+			},
+			in: &TransactionRequest{To: eth.MustNewAddress("0x3535353535353535353535353535353535353535")},
+			expected: &TransactionRequest{
+				To:                   eth.MustNewAddress("0x3535353535353535353535353535353535353535"),
+				Value:                big.NewInt(0),
+				Nonce:                uint64Ptr(9),
+				ChainID:              big.NewInt(1),
+				GasLimit:             21000,
+				MaxFeePerGas:         big.NewInt(6000000000),
+				MaxPriorityFeePerGas: big.NewInt(2000000000),
+			},
+		},
+		{
+			name: "gas limit multiplier",
+			results: map[string]interface{}{
+				"eth_chainId":             "0x1",
+				"eth_getTransactionCount": "0x9",
+				"eth_estimateGas":         "0x5208",
+				"eth_gasPrice":            "0x3b9aca00",
+			},
+			opts: []TransactionBuilderOption{WithGasLimitMultiplier(1.5), WithLegacyTransactions()},
+			in:   &TransactionRequest{To: eth.MustNewAddress("0x3535353535353535353535353535353535353535")},
+			expected: &TransactionRequest{
+				To:       eth.MustNewAddress("0x3535353535353535353535353535353535353535"),
+				Value:    big.NewInt(0),
+				Nonce:    uint64Ptr(9),
+				ChainID:  big.NewInt(1),
+				GasLimit: 31500,
+				GasPrice: big.NewInt(1000000000),
+			},
+		},
+		{
+			name: "legacy when chain has no base fee",
+			results: map[string]interface{}{
+				"eth_chainId": "0x1",
+				"eth_feeHistory": map[string]interface{}{
+					"oldestBlock":   "0x10",
+					"baseFeePerGas": []string{"0x0", "0x0"},
+					"gasUsedRatio":  []float64{0.5},
+				},
+				"eth_gasPrice": "0x3b9aca00",
+			},
+			in: &TransactionRequest{Nonce: uint64Ptr(1), GasLimit: 100000},
+			expected: &TransactionRequest{
+				Value:    big.NewInt(0),
+				Nonce:    uint64Ptr(1),
+				ChainID:  big.NewInt(1),
+				GasLimit: 100000,
+				GasPrice: big.NewInt(1000000000),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, closer := mockJSONRPCMethods(t, test.results)
+			defer closer()
+
+			builder := NewTransactionBuilder(NewClient(server.URL), testSigner(t, 1), eth.MustNewAddress("0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f"), test.opts...)
+			actual, err := builder.Fill(context.Background(), test.in)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestTransactionBuilder_Send(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_chainId":            "0x1",
+		"eth_sendRawTransaction": "0x8e4d4b2d4c8bdc0f0d8ab2e1f1fc51bfa8a85d7bb5f0ce0c9ac4c3b9d9c2d2f1",
+	})
+	defer closer()
+
+	builder := NewTransactionBuilder(NewClient(server.URL), testSigner(t, 1), eth.MustNewAddress("0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f"))
+	hash, err := builder.Send(context.Background(), &TransactionRequest{
+		To:                   eth.MustNewAddress("0x3535353535353535353535353535353535353535"),
+		Value:                big.NewInt(1000000000000000000),
+		Nonce:                uint64Ptr(9),
+		GasLimit:             21000,
+		MaxFeePerGas:         big.NewInt(30000000000),
+		MaxPriorityFeePerGas: big.NewInt(2000000000),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, eth.MustNewHash("0x8e4d4b2d4c8bdc0f0d8ab2e1f1fc51bfa8a85d7bb5f0ce0c9ac4c3b9d9c2d2f1"), hash)
+	assert.Equal(t, []interface{}{
+		"0x02f873010984773594008506fc23ac00825208943535353535353535353535353535353535353535880de0b6b3a764000080c080a02b03b67e070f45175ce9d07c4512720168bd468a24edb6997977a53d48c87a12a0733d775fdd689d306e08ac8ab399f34b5a0253b47ed81b8bf2d2a6ea607fcac7",
+	}, server.Params(t, "eth_sendRawTransaction"))
+}
+
+func TestTransactionBuilder_ChainIDMismatch(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_chainId": "0x5"})
+	defer closer()
+
+	builder := NewTransactionBuilder(NewClient(server.URL), testSigner(t, 1), eth.MustNewAddress("0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f"))
+	_, _, err := builder.Sign(context.Background(), &TransactionRequest{Nonce: uint64Ptr(1), GasLimit: 21000, GasPrice: big.NewInt(1)})
+
+	assert.EqualError(t, err, "signer chain id 1 does not match transaction chain id 5")
+}
+
+func TestTransactionBuilder_SignErrorReleasesNonce(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_chainId":             "0x5",
+		"eth_getTransactionCount": "0x3",
+	})
+	defer closer()
+
+	ctx := context.Background()
+	client := NewClient(server.URL)
+	manager := NewNonceManager(client)
+
+	builder := NewTransactionBuilder(client, testSigner(t, 1), testAccount, WithNonceManager(manager))
+	_, _, err := builder.Sign(ctx, &TransactionRequest{GasLimit: 21000, GasPrice: big.NewInt(1)})
+	assert.EqualError(t, err, "signer chain id 1 does not match transaction chain id 5")
+
+	nonce, err := manager.Reserve(ctx, testAccount)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), nonce, "nonce should have been released")
+}
+
+func testSigner(t *testing.T, chainID int64) *native.PrivateKeySigner {
+	t.Helper()
+
+	privateKey, err := eth.NewPrivateKey("4646464646464646464646464646464646464646464646464646464646464646")
+	require.NoError(t, err)
+
+	signer, err := native.NewPrivateKeySigner(zap.NewNop(), big.NewInt(chainID), privateKey)
+	require.NoError(t, err)
+
+	return signer
+}
+
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
+
+// mockJSONRPCMethodsServer answers each JSON-RPC request with the result configured for its
+// method, it records the params received for each method. A result can be a `*ErrResponse` to
+// answer with an error or a `func(params []interface{}) interface{}` to compute it dynamically.
+type mockJSONRPCMethodsServer struct {
+	*httptest.Server
+
+	lock   sync.Mutex
+	params map[string][]interface{}
+	counts map[string]int
+}
+
+func mockJSONRPCMethods(t *testing.T, results map[string]interface{}) (mock *mockJSONRPCMethodsServer, close func()) {
+	mock = &mockJSONRPCMethodsServer{
+		params: map[string][]interface{}{},
+		counts: map[string]int{},
+	}
+
+	respond := func(request map[string]interface{}) map[string]interface{} {
+		method, _ := request["method"].(string)
+		params, _ := request["params"].([]interface{})
+
+		mock.lock.Lock()
+		mock.params[method] = params
+		mock.counts[method]++
+		mock.lock.Unlock()
+
+		result, found := results[method]
+		if !found {
+			return map[string]interface{}{"jsonrpc": "2.0", "id": request["id"], "error": map[string]interface{}{"code": -32601, "message": "method not found"}}
+		}
+
+		if resolver, ok := result.(func(params []interface{}) interface{}); ok {
+			result = resolver(params)
+		}
+
+		if err, ok := result.(*ErrResponse); ok {
+			return map[string]interface{}{"jsonrpc": "2.0", "id": request["id"], "error": err}
+		}
+
+		return map[string]interface{}{"jsonrpc": "2.0", "id": request["id"], "result": result}
+	}
+
+	mock.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		var response interface{}
+		if len(body) > 0 && body[0] == '[' {
+			var requests []map[string]interface{}
+			require.NoError(t, json.Unmarshal(body, &requests))
+
+			responses := make([]interface{}, len(requests))
+			for i, request := range requests {
+				responses[i] = respond(request)
+			}
+			response = responses
+		} else {
+			var request map[string]interface{}
+			require.NoError(t, json.Unmarshal(body, &request))
+
+			response = respond(request)
+		}
+
+		out, err := json.Marshal(response)
+		require.NoError(t, err)
+
+		rw.Write(out)
+	}))
+
+	return mock, func() { mock.Close() }
+}
+
+func (s *mockJSONRPCMethodsServer) Params(t *testing.T, method string) []interface{} {
+	t.Helper()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	params, found := s.params[method]
+	require.True(t, found, "method %q was never called", method)
+
+	return params
+}
+
+func (s *mockJSONRPCMethodsServer) Count(method string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.counts[method]
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport carries JSON-RPC payloads, a single request or a batch of them, to a node and returns
+// the node's response payload. Batching and caching are performed by the `Client` on top of it.
+type Transport interface {
+	RoundTrip(ctx context.Context, request []byte) (response []byte, err error)
+}
+
+// StreamingTransport is a `Transport` also able to receive the events the node pushes for
+// `eth_subscribe` subscriptions, like `WebSocketClient`.
+type StreamingTransport interface {
+	Transport
+
+	// Subscribe calls `eth_subscribe` with `params` then calls `onEvent` with the result of each event
+	// received until the subscription ends, an error returned by `onEvent` ends the subscription.
+	Subscribe(ctx context.Context, params []interface{}, onEvent func(ctx context.Context, result json.RawMessage) error) (*Subscription, error)
+}
+
+// TransportFunc turns a function into a `Transport`, handy for in-process mocks.
+type TransportFunc func(ctx context.Context, request []byte) ([]byte, error)
+
+func (f TransportFunc) RoundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	return f(ctx, request)
+}
+
+// newTransport selects the transport of `url` from its scheme, `ws://` and `wss://` use WebSocket,
+// other URLs use HTTP and plain paths use IPC.
+func newTransport(url string, httpClient *http.Client) Transport {
+	switch {
+	case strings.HasPrefix(url, "ws://"), strings.HasPrefix(url, "wss://"):
+		return NewWebSocketClient(url)
+	case strings.Contains(url, "://"):
+		return newHTTPTransport(url, httpClient)
+	default:
+		return NewIPCTransport(url)
+	}
+}
+
+// parseRetryAfter reads a `Retry-After` header value, either a number of seconds or an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
+}
+
+type httpTransport struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPTransport(url string, client *http.Client) *httpTransport {
+	return &httpTransport{url: url, client: client}
+}
+
+func (t *httpTransport) RoundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read json_rpc response body: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode, Body: body, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+
+	return body, nil
+}
+
+// RecordedExchange is a payload sent through a transport along with the node's response to it.
+type RecordedExchange struct {
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// RecordingTransport records the exchanges performed through the transport it wraps, they can be
+// saved as a fixture file replayed later by a `ReplayTransport`.
+type RecordingTransport struct {
+	Transport
+
+	lock      sync.Mutex
+	exchanges []RecordedExchange
+}
+
+func NewRecordingTransport(transport Transport) *RecordingTransport {
+	return &RecordingTransport{Transport: transport}
+}
+
+func (t *RecordingTransport) RoundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	response, err := t.Transport.RoundTrip(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	t.lock.Lock()
+	t.exchanges = append(t.exchanges, RecordedExchange{
+		Request:  append(json.RawMessage(nil), request...),
+		Response: append(json.RawMessage(nil), response...),
+	})
+	t.lock.Unlock()
+
+	return response, nil
+}
+
+// Exchanges returns the exchanges recorded so far, in order.
+func (t *RecordingTransport) Exchanges() []RecordedExchange {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return append([]RecordedExchange(nil), t.exchanges...)
+}
+
+// Save writes the exchanges recorded so far to the fixture file `path`.
+func (t *RecordingTransport) Save(path string) error {
+	content, err := json.MarshalIndent(t.Exchanges(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+// ReplayTransport answers requests with recorded responses, without reaching any node. A request
+// recorded multiple times gets its responses in recording order, the last one being repeated once
+// all were replayed.
+type ReplayTransport struct {
+	lock      sync.Mutex
+	responses map[string][][]byte
+}
+
+func NewReplayTransport(exchanges []RecordedExchange) (*ReplayTransport, error) {
+	t := &ReplayTransport{responses: map[string][][]byte{}}
+	for i, exchange := range exchanges {
+		key, err := replayKey(exchange.Request)
+		if err != nil {
+			return nil, fmt.Errorf("exchange #%d: %w", i, err)
+		}
+
+		t.responses[key] = append(t.responses[key], exchange.Response)
+	}
+
+	return t, nil
+}
+
+// LoadReplayTransport returns a `ReplayTransport` replaying the fixture file `path`, as written by
+// `RecordingTransport.Save`.
+func LoadReplayTransport(path string) (*ReplayTransport, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var exchanges []RecordedExchange
+	if err := json.Unmarshal(content, &exchanges); err != nil {
+		return nil, fmt.Errorf("invalid fixture file %q: %w", path, err)
+	}
+
+	return NewReplayTransport(exchanges)
+}
+
+func (t *ReplayTransport) RoundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	key, err := replayKey(request)
+	if err != nil {
+		return nil, err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	responses := t.responses[key]
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("no recorded response for request %s", key)
+	}
+
+	if len(responses) > 1 {
+		t.responses[key] = responses[1:]
+	}
+	return responses[0], nil
+}
+
+// replayKey is the compacted form of the request, so that indentation in fixture files is irrelevant
+func replayKey(request []byte) (string, error) {
+	buffer := bytes.NewBuffer(nil)
+	if err := json.Compact(buffer, request); err != nil {
+		return "", fmt.Errorf("invalid json_rpc request: %w", err)
+	}
+
+	return buffer.String(), nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClient_Transport(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected Transport
+	}{
+		{"http://localhost:8545", &httpTransport{}},
+		{"https://mainnet.example.com/v1", &httpTransport{}},
+		{"ws://localhost:8546", &WebSocketClient{}},
+		{"wss://mainnet.example.com/ws", &WebSocketClient{}},
+		{"/var/lib/geth/geth.ipc", &IPCTransport{}},
+		{"geth.ipc", &IPCTransport{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			assert.IsType(t, test.expected, NewClient(test.url).transport)
+		})
+	}
+}
+
+func TestTransportFunc(t *testing.T) {
+	client := NewClient("", WithTransport(TransportFunc(func(ctx context.Context, request []byte) ([]byte, error) {
+		assert.JSONEq(t, `{"params":[],"method":"eth_blockNumber","jsonrpc":"2.0","id":"0x1"}`, string(request))
+		return []byte(`{"jsonrpc":"2.0","id":"0x1","result":"0x2a"}`), nil
+	})))
+
+	blockNum, err := client.LatestBlockNum(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), blockNum)
+
+	_, err = client.SubscribeNewHeads(context.Background(), make(chan *Block))
+	assert.Equal(t, ErrSubscriptionsUnsupported, err)
+}
+
+func TestRecordingTransport(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{"eth_chainId": "0x1"})
+	defer closer()
+
+	recorder := NewRecordingTransport(newHTTPTransport(server.URL, server.Client()))
+	chainID, err := NewClient(server.URL, WithTransport(recorder)).ChainID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), chainID.Int64())
+
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	require.NoError(t, recorder.Save(path))
+
+	replay, err := LoadReplayTransport(path)
+	require.NoError(t, err)
+
+	chainID, err = NewClient("", WithTransport(replay)).ChainID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), chainID.Int64())
+}
+
+func TestReplayTransport(t *testing.T) {
+	replay, err := LoadReplayTransport("testdata/transport_replay.json")
+	require.NoError(t, err)
+
+	client := NewClient("", WithTransport(replay))
+	ctx := context.Background()
+
+	for _, expected := range []uint64{0x10, 0x11, 0x11} {
+		blockNum, err := client.LatestBlockNum(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, expected, blockNum)
+	}
+
+	_, err = client.GasPrice(ctx)
+	assert.Error(t, err)
+}
+
+func TestClient_WebSocketTransport(t *testing.T) {
+	server := mockWebSocket(t, func(conn *mockWebSocketConn, request map[string]interface{}) {
+		switch request["method"] {
+		case "eth_blockNumber":
+			conn.Respond(request, "0x10")
+		case "eth_chainId":
+			conn.Respond(request, "0x1")
+		case "eth_subscribe":
+			conn.Respond(request, "0xcc")
+			conn.Notify("0xcc", map[string]interface{}{"number": "0x11"})
+		}
+	})
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	responses, err := client.DoRequests(ctx, []*RPCRequest{
+		{Method: "eth_blockNumber", Params: []interface{}{}},
+		{Method: "eth_chainId", Params: []interface{}{}},
+	})
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	assert.Equal(t, &RPCResponse{Content: "0x10", ID: 1}, responses[0])
+	assert.Equal(t, &RPCResponse{Content: "0x1", ID: 2}, responses[1])
+
+	heads := make(chan *Block)
+	_, err = client.SubscribeNewHeads(ctx, heads)
+	require.NoError(t, err)
+	assert.Equal(t, eth.Uint64(0x11), (<-heads).Number)
+}
@@ -1,6 +1,10 @@
 package rpc
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 
@@ -10,16 +14,34 @@ import (
 var LatestBlock = &BlockRef{tag: "latest"}
 var PendingBlock = &BlockRef{tag: "pending"}
 var EarliestBlock = &BlockRef{tag: "earliest"}
+var FinalizedBlock = &BlockRef{tag: "finalized"}
+var SafeBlock = &BlockRef{tag: "safe"}
 
+// BlockRef references a block by tag, by number or, per EIP-1898, by hash.
 type BlockRef struct {
 	tag   string
 	value uint64
+
+	hash             eth.Hash
+	requireCanonical bool
 }
 
 func BlockNumber(number uint64) *BlockRef {
 	return &BlockRef{tag: "", value: number}
 }
 
+// BlockHash references the block with the given hash, the node answers even if the block is not
+// part of the canonical chain anymore.
+func BlockHash(hash eth.Hash) *BlockRef {
+	return &BlockRef{hash: hash}
+}
+
+// CanonicalBlockHash references the block with the given hash, the node returns an error if the
+// block is not part of the canonical chain.
+func CanonicalBlockHash(hash eth.Hash) *BlockRef {
+	return &BlockRef{hash: hash, requireCanonical: true}
+}
+
 func (b *BlockRef) IsLatest() bool {
 	return b == LatestBlock || b.tag == LatestBlock.tag
 }
@@ -32,29 +54,50 @@ func (b *BlockRef) IsPending() bool {
 	return b == PendingBlock || b.tag == PendingBlock.tag
 }
 
+func (b *BlockRef) IsFinalized() bool {
+	return b == FinalizedBlock || b.tag == FinalizedBlock.tag
+}
+
+func (b *BlockRef) IsSafe() bool {
+	return b == SafeBlock || b.tag == SafeBlock.tag
+}
+
 func (b *BlockRef) BlockNumber() (number uint64, ok bool) {
-	if b.tag != "" {
+	if b.tag != "" || b.hash != nil {
 		return 0, false
 	}
 
 	return b.value, true
 }
 
+// BlockHash returns the hash of the referenced block and whether it must be part of the canonical
+// chain, `ok` is `false` if the block is not referenced by hash.
+func (b *BlockRef) BlockHash() (hash eth.Hash, requireCanonical bool, ok bool) {
+	if b.hash == nil {
+		return nil, false, false
+	}
+
+	return b.hash, b.requireCanonical, true
+}
+
 func (b *BlockRef) UnmarshalText(text []byte) error {
 	lowerTextString := strings.ToLower(string(text))
 
-	if lowerTextString == LatestBlock.tag {
-		*b = *LatestBlock
-		return nil
+	for _, tagged := range []*BlockRef{LatestBlock, EarliestBlock, PendingBlock, FinalizedBlock, SafeBlock} {
+		if lowerTextString == tagged.tag {
+			*b = *tagged
+			return nil
+		}
 	}
 
-	if lowerTextString == EarliestBlock.tag {
-		*b = *EarliestBlock
-		return nil
-	}
+	// A 32 bytes hexadecimal value cannot be a block number, it's a block hash
+	if len(lowerTextString) == 66 && strings.HasPrefix(lowerTextString, "0x") {
+		hash, err := eth.NewHash(lowerTextString)
+		if err != nil {
+			return err
+		}
 
-	if lowerTextString == PendingBlock.tag {
-		*b = *PendingBlock
+		*b = BlockRef{hash: hash}
 		return nil
 	}
 
@@ -63,12 +106,20 @@ func (b *BlockRef) UnmarshalText(text []byte) error {
 		return err
 	}
 
-	b.tag = ""
-	b.value = uint64(value)
+	*b = BlockRef{value: uint64(value)}
 	return nil
 }
 
 func (b BlockRef) MarshalJSONRPC() ([]byte, error) {
+	if b.hash != nil {
+		reference := map[string]interface{}{"blockHash": b.hash}
+		if b.requireCanonical {
+			reference["requireCanonical"] = true
+		}
+
+		return MarshalJSONRPC(reference)
+	}
+
 	if b.tag != "" {
 		return MarshalJSONRPC(b.tag)
 	}
@@ -77,6 +128,10 @@ func (b BlockRef) MarshalJSONRPC() ([]byte, error) {
 }
 
 func (b BlockRef) String() string {
+	if b.hash != nil {
+		return b.hash.Pretty()
+	}
+
 	if b.tag != "" {
 		return strings.ToUpper(string(b.tag[0])) + b.tag[1:]
 	}
@@ -133,6 +188,190 @@ type TransactionReceipt struct {
 	Logs []*LogEntry `json:"logs"`
 	// LogsBloom is the Bloom filter for light clients to quickly retrieve related logs.
 	LogsBloom eth.Hex `json:"logsBloom"`
+	// Status is `1` if the transaction succeeded and `0` if it reverted, `nil` for transactions
+	// mined before the Byzantium hard fork.
+	Status *eth.Uint64 `json:"status,omitempty"`
+	// Root is the intermediate state root after the transaction, only present for transactions
+	// mined before the Byzantium hard fork.
+	Root eth.Hash `json:"root,omitempty"`
+	// Type is the EIP-2718 type of the transaction, `0` for legacy transactions.
+	Type eth.Uint64 `json:"type"`
+	// EffectiveGasPrice is the price per gas actually paid by the sender, base fee plus tip for
+	// EIP-1559 transactions, `nil` when the node does not report it.
+	EffectiveGasPrice *eth.Uint256 `json:"effectiveGasPrice,omitempty"`
+	// BlobGasUsed is the amount of blob gas used by EIP-4844 transactions, `nil` otherwise.
+	BlobGasUsed *eth.Uint64 `json:"blobGasUsed,omitempty"`
+	// BlobGasPrice is the price per blob gas paid by EIP-4844 transactions, `nil` otherwise.
+	BlobGasPrice *eth.Uint256 `json:"blobGasPrice,omitempty"`
+}
+
+// Succeeded returns `true` if the transaction's status is `1`, for transactions mined before the
+// Byzantium hard fork, which have no status, it's always `false`.
+func (r *TransactionReceipt) Succeeded() bool {
+	return r.Status != nil && *r.Status == 1
+}
+
+// Fee returns the amount of ETH paid by the sender for the transaction's execution, including the
+// blob fee of EIP-4844 transactions. It returns `nil` when the node did not report the effective
+// gas price.
+func (r *TransactionReceipt) Fee() *eth.TokenAmount {
+	if r.EffectiveGasPrice == nil {
+		return nil
+	}
+
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(uint64(r.GasUsed)), r.EffectiveGasPrice.Int())
+	if r.BlobGasUsed != nil && r.BlobGasPrice != nil {
+		fee.Add(fee, new(big.Int).Mul(new(big.Int).SetUint64(uint64(*r.BlobGasUsed)), r.BlobGasPrice.Int()))
+	}
+
+	amount := eth.ETHToken.AmountBig(fee)
+	return &amount
+}
+
+// DecodedLog is a receipt's log entry decoded through the ABI of its emitting contract.
+type DecodedLog struct {
+	Entry *LogEntry
+	Event *eth.LogEventDef
+	// Fields contains the decoded parameters keyed by name (see `eth.LogParameter.GetName`). Indexed
+	// parameters of dynamic types (strings, bytes, arrays and tuples) are only available as the
+	// `eth.Hash` of their value.
+	Fields map[string]interface{}
+}
+
+// DecodeLogs decodes the receipt's logs emitted by events defined in `abi`, logs of other events
+// (including anonymous ones) are skipped.
+func (r *TransactionReceipt) DecodeLogs(abi *eth.ABI) (out []*DecodedLog, err error) {
+	for _, entry := range r.Logs {
+		if len(entry.Topics) == 0 {
+			continue
+		}
+
+		event := abi.FindLog(entry.Topics[0])
+		if event == nil {
+			continue
+		}
+
+		fields, err := decodeLogFields(entry, event)
+		if err != nil {
+			return nil, fmt.Errorf("decode log #%d event %q: %w", uint64(entry.LogIndex), event.Name, err)
+		}
+
+		out = append(out, &DecodedLog{Entry: entry, Event: event, Fields: fields})
+	}
+
+	return out, nil
+}
+
+func decodeLogFields(entry *LogEntry, event *eth.LogEventDef) (map[string]interface{}, error) {
+	log := entry.ToLog()
+	topicDecoder := eth.NewLogDecoder(&log)
+
+	// Skips topic 0, the event's signature
+	if _, err := topicDecoder.ReadTopic(); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{}, len(event.Parameters))
+
+	var dataParameters []*eth.MethodParameter
+	var dataNames []string
+	for i, parameter := range event.Parameters {
+		name := parameter.GetName(i)
+		if !parameter.Indexed {
+			dataParameters = append(dataParameters, &eth.MethodParameter{Name: name, TypeName: parameter.TypeName})
+			dataNames = append(dataNames, name)
+			continue
+		}
+
+		if isHashedTopicType(parameter.TypeName) {
+			topic, err := topicDecoder.ReadTopic()
+			if err != nil {
+				return nil, fmt.Errorf("read topic %q: %w", name, err)
+			}
+
+			fields[name] = eth.Hash(topic)
+			continue
+		}
+
+		value, err := topicDecoder.ReadTypedTopic(parameter.TypeName)
+		if err != nil {
+			return nil, fmt.Errorf("read topic %q: %w", name, err)
+		}
+		fields[name] = value
+	}
+
+	if len(dataParameters) > 0 {
+		values, err := eth.NewDecoder(entry.Data).ReadOutput(dataParameters)
+		if err != nil {
+			return nil, fmt.Errorf("read data: %w", err)
+		}
+
+		for i, value := range values {
+			fields[dataNames[i]] = value
+		}
+	}
+
+	return fields, nil
+}
+
+// isHashedTopicType returns `true` for types that are stored as the Keccak-256 hash of their
+// encoding when used as an indexed event parameter.
+func isHashedTopicType(typeName string) bool {
+	return typeName == "string" || typeName == "bytes" || strings.HasSuffix(typeName, "]") || strings.HasPrefix(typeName, "tuple")
+}
+
+type Transaction struct {
+	// Hash is the hash of the transaction.
+	Hash eth.Hash `json:"hash"`
+	// Type is the EIP-2718 type of the transaction, `0` for legacy transactions.
+	Type eth.Uint64 `json:"type"`
+	// ChainID is the chain ID the transaction is valid for, `nil` for legacy transactions not protected by EIP-155.
+	ChainID *eth.Uint64 `json:"chainId,omitempty"`
+	// Nonce is the number of transactions made by the sender prior to this one.
+	Nonce eth.Uint64 `json:"nonce"`
+	// From is the address of the sender.
+	From eth.Address `json:"from"`
+	// To is the address of the receiver, `null` when the transaction is a contract creation transaction.
+	To *eth.Address `json:"to,omitempty"`
+	// Value is the value transferred in Wei.
+	Value *eth.Uint256 `json:"value"`
+	// Gas is the gas limit provided by the sender.
+	Gas eth.Uint64 `json:"gas"`
+	// GasPrice is the gas price provided by the sender for legacy transactions, for EIP-1559 transactions,
+	// it's the effective gas price paid once mined or the max fee per gas while pending.
+	GasPrice *eth.Uint256 `json:"gasPrice,omitempty"`
+	// MaxFeePerGas is the maximum total fee per gas of EIP-1559 transactions.
+	MaxFeePerGas *eth.Uint256 `json:"maxFeePerGas,omitempty"`
+	// MaxPriorityFeePerGas is the maximum priority fee per gas of EIP-1559 transactions.
+	MaxPriorityFeePerGas *eth.Uint256 `json:"maxPriorityFeePerGas,omitempty"`
+	// Input is the data sent along with the transaction.
+	Input eth.Hex `json:"input"`
+	// BlockHash is the hash of the block where this transaction was in, empty when pending.
+	BlockHash eth.Hash `json:"blockHash,omitempty"`
+	// BlockNumber is the block number where this transaction was in, `nil` when pending.
+	BlockNumber *eth.Uint64 `json:"blockNumber,omitempty"`
+	// TransactionIndex is the transactions index position in the block, `nil` when pending.
+	TransactionIndex *eth.Uint64 `json:"transactionIndex,omitempty"`
+	// AccessList is the EIP-2930 access list of typed transactions, `nil` for legacy transactions.
+	AccessList []*AccessTuple `json:"accessList,omitempty"`
+	// MaxFeePerBlobGas is the maximum fee per blob gas of EIP-4844 transactions.
+	MaxFeePerBlobGas *eth.Uint256 `json:"maxFeePerBlobGas,omitempty"`
+	// BlobVersionedHashes are the versioned hashes of the blobs carried by EIP-4844 transactions.
+	BlobVersionedHashes []eth.Hash `json:"blobVersionedHashes,omitempty"`
+	// V, R and S are the signature's values of the transaction.
+	V *eth.Uint256 `json:"v,omitempty"`
+	R *eth.Uint256 `json:"r,omitempty"`
+	S *eth.Uint256 `json:"s,omitempty"`
+}
+
+// IsPending returns `true` if the transaction is not yet included in a block.
+func (t *Transaction) IsPending() bool {
+	return t.BlockNumber == nil
+}
+
+type AccessTuple struct {
+	Address     eth.Address `json:"address"`
+	StorageKeys []eth.Hash  `json:"storageKeys"`
 }
 
 type Block struct {
@@ -146,20 +385,129 @@ type Block struct {
 	MixHash          eth.Hash      `json:"mixHash"`
 	GasLimit         eth.Uint64    `json:"gasLimit"`
 	GasUsed          eth.Uint64    `json:"gasUsed"`
-	// Left out for now because we need to actually pull in https://github.com/holiman/uint256
-	// and get a eth.Uint256 wrapper in that is able to properly read those value from a JSON
-	// string like "0x8792c6f47f70f".
-	// Difficulty     *big.Int    `json:"difficulty"`
-	// TotalDifficult *big.Int    `json:"totalDifficulty"`
-	Miner         eth.Address `json:"miner"`
-	Nonce         eth.Hex     `json:"nonce,omitempty"`
-	LogsBloom     eth.Hex     `json:"logsBloom"`
-	ExtraData     eth.Hex     `json:"extraData"`
-	BaseFeePerGas eth.Uint64  `json:"baseFeePerGas,omitempty"`
-	BlockSize     eth.Uint64  `json:"size,omitempty"`
-	// Left out for now because this is a dynamic type. It's a []eth.Hash value when hydrating
-	// params is sets to `false` and it's a `rpc.TransactionReceipt` when sets to `true`.
-	// Transactions  interface{} `json:"transactions,omitempty"`
-	UnclesSHA3 eth.Hash   `json:"sha3Uncles,omitempty"`
-	Uncles     []eth.Hash `json:"uncles,omitempty"`
+	Difficulty       *eth.Uint256  `json:"difficulty,omitempty"`
+	// TotalDifficulty is not returned anymore by most nodes since the Paris hard fork, `nil` in that case.
+	TotalDifficulty *eth.Uint256 `json:"totalDifficulty,omitempty"`
+	Miner           eth.Address  `json:"miner"`
+	Nonce           eth.Hex      `json:"nonce,omitempty"`
+	LogsBloom       eth.Hex      `json:"logsBloom"`
+	ExtraData       eth.Hex      `json:"extraData"`
+	BaseFeePerGas   eth.Uint64   `json:"baseFeePerGas,omitempty"`
+	BlockSize       eth.Uint64   `json:"size,omitempty"`
+	// Transactions contains either the hashes of the block's transactions or the full transactions,
+	// depending on whether the block was fetched with `WithGetBlockFullTransaction` or not.
+	Transactions BlockTransactions `json:"transactions"`
+	UnclesSHA3   eth.Hash          `json:"sha3Uncles,omitempty"`
+	Uncles       []eth.Hash        `json:"uncles,omitempty"`
+	// WithdrawalsRoot and Withdrawals are present since the Shanghai hard fork.
+	WithdrawalsRoot eth.Hash      `json:"withdrawalsRoot,omitempty"`
+	Withdrawals     []*Withdrawal `json:"withdrawals,omitempty"`
+	// BlobGasUsed and ExcessBlobGas are present since the Cancun hard fork.
+	BlobGasUsed   *eth.Uint64 `json:"blobGasUsed,omitempty"`
+	ExcessBlobGas *eth.Uint64 `json:"excessBlobGas,omitempty"`
+	// ParentBeaconBlockRoot is present since the Cancun hard fork.
+	ParentBeaconBlockRoot eth.Hash `json:"parentBeaconBlockRoot,omitempty"`
+	// RequestsHash is present since the Prague hard fork.
+	RequestsHash eth.Hash `json:"requestsHash,omitempty"`
+}
+
+// BlockTransactions holds the transactions of a block as returned by the node, only `Hashes` is
+// filled when the block was fetched without full transactions, otherwise `Transactions` is filled
+// and `Hashes` holds their hashes.
+type BlockTransactions struct {
+	Hashes       []eth.Hash
+	Transactions []*Transaction
+}
+
+// IsFull returns `true` if the full transactions were fetched, an empty block always reports `false`.
+func (t *BlockTransactions) IsFull() bool {
+	return t.Transactions != nil
+}
+
+func (t *BlockTransactions) Len() int {
+	return len(t.Hashes)
+}
+
+func (t BlockTransactions) MarshalJSON() ([]byte, error) {
+	if t.Transactions != nil {
+		return json.Marshal(t.Transactions)
+	}
+
+	if t.Hashes == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal(t.Hashes)
+}
+
+func (t *BlockTransactions) UnmarshalJSON(data []byte) error {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return fmt.Errorf("block transactions: %w", err)
+	}
+
+	*t = BlockTransactions{Hashes: make([]eth.Hash, len(elements))}
+	if len(elements) == 0 {
+		return nil
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(elements[0]), []byte("{")) {
+		t.Transactions = make([]*Transaction, len(elements))
+		for i, element := range elements {
+			if err := json.Unmarshal(element, &t.Transactions[i]); err != nil {
+				return fmt.Errorf("block transaction #%d: %w", i, err)
+			}
+
+			t.Hashes[i] = t.Transactions[i].Hash
+		}
+
+		return nil
+	}
+
+	for i, element := range elements {
+		if err := json.Unmarshal(element, &t.Hashes[i]); err != nil {
+			return fmt.Errorf("block transaction hash #%d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Withdrawal is a validator withdrawal from the beacon chain, included in execution blocks since the
+// Shanghai hard fork.
+type Withdrawal struct {
+	Index          eth.Uint64  `json:"index"`
+	ValidatorIndex eth.Uint64  `json:"validatorIndex"`
+	Address        eth.Address `json:"address"`
+	// Amount is the withdrawn amount in Gwei.
+	Amount eth.Uint64 `json:"amount"`
+}
+
+// AmountWei returns the withdrawn amount in Wei.
+func (w *Withdrawal) AmountWei() *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(uint64(w.Amount)), big.NewInt(1_000_000_000))
+}
+
+type FeeHistory struct {
+	// OldestBlock is the lowest block number of the returned range.
+	OldestBlock eth.Uint64 `json:"oldestBlock"`
+	// BaseFeePerGas contains the base fee of each block of the range, it also includes the
+	// next block after the newest one of the range, so it contains one more element than
+	// `GasUsedRatio`. Zeroes are returned for pre-EIP-1559 blocks.
+	BaseFeePerGas []eth.Uint64 `json:"baseFeePerGas"`
+	// GasUsedRatio contains the ratio of gas used over gas limit of each block of the range.
+	GasUsedRatio []float64 `json:"gasUsedRatio"`
+	// Reward contains for each block of the range the effective priority fee per gas paid at
+	// each of the requested percentiles, empty if no percentiles were requested.
+	Reward [][]eth.Uint64 `json:"reward,omitempty"`
+}
+
+// NextBaseFee returns the base fee of the next block following the newest block of the range,
+// `0` if the range is empty or the chain does not support EIP-1559.
+func (h *FeeHistory) NextBaseFee() uint64 {
+	if len(h.BaseFeePerGas) == 0 {
+		return 0
+	}
+
+	return uint64(h.BaseFeePerGas[len(h.BaseFeePerGas)-1])
 }
@@ -1,6 +1,8 @@
 package rpc
 
 import (
+	"encoding/json"
+	"math/big"
 	"reflect"
 	"testing"
 
@@ -86,6 +88,14 @@ func TestBlockRef_UnmarshalText(t *testing.T) {
 		{"pending mixed case", args{"pEndIng"}, PendingBlock, require.NoError},
 		{"pending all upper case", args{"PENDING"}, PendingBlock, require.NoError},
 
+		{"finalized all lower case", args{"finalized"}, FinalizedBlock, require.NoError},
+		{"finalized all upper case", args{"FINALIZED"}, FinalizedBlock, require.NoError},
+
+		{"safe all lower case", args{"safe"}, SafeBlock, require.NoError},
+		{"safe mixed case", args{"SaFe"}, SafeBlock, require.NoError},
+
+		{"block hash", args{"0xc1ea26a4b5b2a0a2b7c8eb4d69f2c2f7e0b4a77c5bde7f58d0f5b5aab5fa1c11"}, BlockHash(eth.MustNewHash("0xc1ea26a4b5b2a0a2b7c8eb4d69f2c2f7e0b4a77c5bde7f58d0f5b5aab5fa1c11")), require.NoError},
+
 		{"block number decimal zero", args{"0"}, BlockNumber(0), require.NoError},
 		{"block number decimal value", args{"112"}, BlockNumber(112), require.NoError},
 
@@ -212,6 +222,76 @@ func TestBlockRef_BlockNumber(t *testing.T) {
 	}
 }
 
+func TestBlockRef_MarshalJSONRPC(t *testing.T) {
+	hash := eth.MustNewHash("0xc1ea26a4b5b2a0a2b7c8eb4d69f2c2f7e0b4a77c5bde7f58d0f5b5aab5fa1c11")
+
+	tests := []struct {
+		name     string
+		ref      *BlockRef
+		expected string
+	}{
+		{"latest", LatestBlock, `"latest"`},
+		{"finalized", FinalizedBlock, `"finalized"`},
+		{"safe", SafeBlock, `"safe"`},
+		{"block number", BlockNumber(16), `"0x10"`},
+		{"block hash", BlockHash(hash), `{"blockHash":"0xc1ea26a4b5b2a0a2b7c8eb4d69f2c2f7e0b4a77c5bde7f58d0f5b5aab5fa1c11"}`},
+		{"canonical block hash", CanonicalBlockHash(hash), `{"blockHash":"0xc1ea26a4b5b2a0a2b7c8eb4d69f2c2f7e0b4a77c5bde7f58d0f5b5aab5fa1c11","requireCanonical":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := MarshalJSONRPC(tt.ref)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, string(actual))
+		})
+	}
+}
+
+func TestBlockRef_BlockHash(t *testing.T) {
+	hash := eth.MustNewHash("0xc1ea26a4b5b2a0a2b7c8eb4d69f2c2f7e0b4a77c5bde7f58d0f5b5aab5fa1c11")
+
+	_, _, ok := LatestBlock.BlockHash()
+	assert.False(t, ok)
+
+	_, ok = BlockHash(hash).BlockNumber()
+	assert.False(t, ok)
+
+	actual, requireCanonical, ok := CanonicalBlockHash(hash).BlockHash()
+	require.True(t, ok)
+	assert.Equal(t, hash, actual)
+	assert.True(t, requireCanonical)
+}
+
+func TestLogsParams_MarshalJSONRPC(t *testing.T) {
+	hash := eth.MustNewHash("0xc1ea26a4b5b2a0a2b7c8eb4d69f2c2f7e0b4a77c5bde7f58d0f5b5aab5fa1c11")
+	otherHash := eth.MustNewHash("0xd1ea26a4b5b2a0a2b7c8eb4d69f2c2f7e0b4a77c5bde7f58d0f5b5aab5fa1c11")
+
+	tests := []struct {
+		name        string
+		params      LogsParams
+		expected    string
+		expectedErr bool
+	}{
+		{"block range", LogsParams{FromBlock: BlockNumber(1), ToBlock: FinalizedBlock}, `{"fromBlock":"0x1","toBlock":"finalized"}`, false},
+		{"from block hash", LogsParams{FromBlock: BlockHash(hash), Address: eth.MustNewAddress("0x2")}, `{"blockHash":"0xc1ea26a4b5b2a0a2b7c8eb4d69f2c2f7e0b4a77c5bde7f58d0f5b5aab5fa1c11","address":"0x02"}`, false},
+		{"same block hash", LogsParams{FromBlock: BlockHash(hash), ToBlock: CanonicalBlockHash(hash)}, `{"blockHash":"0xc1ea26a4b5b2a0a2b7c8eb4d69f2c2f7e0b4a77c5bde7f58d0f5b5aab5fa1c11"}`, false},
+		{"different block hashes", LogsParams{FromBlock: BlockHash(hash), ToBlock: BlockHash(otherHash)}, "", true},
+		{"block hash and number", LogsParams{FromBlock: BlockNumber(1), ToBlock: BlockHash(hash)}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := MarshalJSONRPC(tt.params)
+			if tt.expectedErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(actual))
+		})
+	}
+}
+
 func blockRefFromUnmarshal(t *testing.T) (*BlockRef, *BlockRef, *BlockRef) {
 	t.Helper()
 
@@ -226,3 +306,104 @@ func blockRefFromUnmarshal(t *testing.T) (*BlockRef, *BlockRef, *BlockRef) {
 
 	return latest, earliest, pending
 }
+
+func TestTransaction_UnmarshalJSON(t *testing.T) {
+	var transaction Transaction
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"hash": "0x8e4d4b2d4c8bdc0f0d8ab2e1f1fc51bfa8a85d7bb5f0ce0c9ac4c3b9d9c2d2f1",
+		"nonce": "0x7",
+		"value": "0xde0b6b3a7640000",
+		"gasPrice": "1000000000",
+		"maxFeePerGas": 3000000000,
+		"input": "0x",
+		"blockNumber": null
+	}`), &transaction))
+
+	assert.Equal(t, eth.Uint64(7), transaction.Nonce)
+	assert.Equal(t, "1000000000000000000", transaction.Value.String())
+	assert.Equal(t, "1000000000", transaction.GasPrice.String())
+	assert.Equal(t, "3000000000", transaction.MaxFeePerGas.String())
+	assert.Nil(t, transaction.MaxPriorityFeePerGas)
+	assert.True(t, transaction.IsPending())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"value": "0xzz"}`), &transaction))
+}
+
+func TestTransactionReceipt_UnmarshalJSON(t *testing.T) {
+	var receipt TransactionReceipt
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"transactionHash": "0x8e4d4b2d4c8bdc0f0d8ab2e1f1fc51bfa8a85d7bb5f0ce0c9ac4c3b9d9c2d2f1",
+		"status": "0x0",
+		"type": "0x3",
+		"gasUsed": "0x5208",
+		"effectiveGasPrice": "0x3b9aca00",
+		"blobGasUsed": "0x20000",
+		"blobGasPrice": "0x2",
+		"logs": []
+	}`), &receipt))
+
+	assert.Equal(t, ethUint64Ptr(0), receipt.Status)
+	assert.Equal(t, eth.Uint64(3), receipt.Type)
+	assert.Equal(t, "1000000000", receipt.EffectiveGasPrice.String())
+	assert.Equal(t, ethUint64Ptr(0x20000), receipt.BlobGasUsed)
+	assert.Equal(t, "2", receipt.BlobGasPrice.String())
+	assert.False(t, receipt.Succeeded())
+}
+
+func TestTransactionReceipt_Fee(t *testing.T) {
+	tests := []struct {
+		name     string
+		receipt  *TransactionReceipt
+		expected string
+	}{
+		{"unknown effective gas price", &TransactionReceipt{GasUsed: 21000}, ""},
+		{"regular", &TransactionReceipt{GasUsed: 21000, EffectiveGasPrice: eth.NewUint256FromUint64(1_000_000_000)}, "21000000000000"},
+		{"with blob fee", &TransactionReceipt{GasUsed: 21000, EffectiveGasPrice: eth.NewUint256FromUint64(1_000_000_000), BlobGasUsed: ethUint64Ptr(131072), BlobGasPrice: eth.NewUint256FromUint64(2)}, "21000000262144"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fee := test.receipt.Fee()
+			if test.expected == "" {
+				assert.Nil(t, fee)
+				return
+			}
+
+			require.NotNil(t, fee)
+			assert.Equal(t, eth.ETHToken, fee.Token)
+			assert.Equal(t, test.expected, fee.Amount.String())
+		})
+	}
+}
+
+func TestTransactionReceipt_DecodeLogs(t *testing.T) {
+	abi, err := eth.ParseABI("../testdata/uniswap_v2_factory.abi.json")
+	require.NoError(t, err)
+
+	receipt := &TransactionReceipt{Logs: []*LogEntry{
+		{
+			Address: eth.MustNewAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+			Topics: []eth.Hash{
+				eth.MustNewHash("0x0d3648bd0f6ba80134a33ba9275ac585d9d315f0ad8355cddefde31afa28d0e9"),
+				eth.MustNewHash("0x000000000000000000000000a0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"),
+				eth.MustNewHash("0x000000000000000000000000f1290473e210b2108a85237fbcd7b6eb42cc654f"),
+			},
+			Data: eth.MustNewHex("0x000000000000000000000000fc2890ffb3069a1a9d3f7b11c7775a1a1ee721c00000000000000000000000000000000000000000000000000000000000002f4d"),
+		},
+		{
+			Address: eth.MustNewAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"),
+			Topics:  []eth.Hash{eth.MustNewHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")},
+		},
+	}}
+
+	logs, err := receipt.DecodeLogs(abi)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+
+	assert.Equal(t, "PairCreated", logs[0].Event.Name)
+	assert.Equal(t, receipt.Logs[0], logs[0].Entry)
+	assert.Equal(t, eth.MustNewAddress("0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"), logs[0].Fields["token0"])
+	assert.Equal(t, eth.MustNewAddress("0xf1290473e210b2108a85237fbcd7b6eb42cc654f"), logs[0].Fields["token1"])
+	assert.Equal(t, eth.MustNewAddress("0xfc2890ffb3069a1a9d3f7b11c7775a1a1ee721c0"), logs[0].Fields["pair"])
+	assert.Equal(t, "12109", logs[0].Fields["unamed4"].(*big.Int).String())
+}
@@ -0,0 +1,348 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/logging"
+	"go.uber.org/zap"
+)
+
+type TransactionStatus uint8
+
+const (
+	// TransactionStatusUnknown is used for transactions mined before the Byzantium hard fork, for
+	// which the receipt does not tell if the transaction succeeded or not.
+	TransactionStatusUnknown TransactionStatus = iota
+	TransactionStatusSucceeded
+	TransactionStatusReverted
+	// TransactionStatusDropped is used when the node does not know about the transaction anymore,
+	// and no other transaction using its nonce was mined.
+	TransactionStatusDropped
+	// TransactionStatusReplaced is used when another transaction using the same nonce was mined instead.
+	TransactionStatusReplaced
+)
+
+func (s TransactionStatus) String() string {
+	switch s {
+	case TransactionStatusSucceeded:
+		return "Succeeded"
+	case TransactionStatusReverted:
+		return "Reverted"
+	case TransactionStatusDropped:
+		return "Dropped"
+	case TransactionStatusReplaced:
+		return "Replaced"
+	default:
+		return "Unknown"
+	}
+}
+
+// MinedTransaction is the outcome of waiting for a transaction through `Client.WaitMined`.
+type MinedTransaction struct {
+	Status TransactionStatus
+	// Receipt is the transaction's receipt, `nil` when the transaction was dropped or replaced.
+	Receipt *TransactionReceipt
+	// Confirmations is the number of blocks, including the receipt's one, built on top of the
+	// receipt's block when the wait completed.
+	Confirmations uint64
+	// Reorgs is the number of times the block containing the transaction was removed from the
+	// canonical chain while waiting for confirmations.
+	Reorgs int
+	// RevertData is the data returned by the replayed call when the transaction reverted.
+	RevertData eth.Hex
+	// RevertReason is the reason of the revert when the transaction reverted and the node
+	// provided it (or when it could be decoded from RevertData).
+	RevertReason string
+}
+
+type WaitOption func(*waitOptions)
+
+type waitOptions struct {
+	pollInterval    time.Duration
+	maxPollInterval time.Duration
+	droppedAfter    time.Duration
+	revertReason    bool
+}
+
+// WithPollInterval sets the interval between two checks of the transaction's state, the interval
+// grows by 50% after each check, up to `max`. Defaults to 1s up to 12s.
+func WithPollInterval(initial, max time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		o.pollInterval = initial
+		o.maxPollInterval = max
+	}
+}
+
+// WithDroppedAfter sets for how long the transaction can be unknown to the node before it's reported
+// as dropped, defaults to 5 minutes.
+func WithDroppedAfter(duration time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		o.droppedAfter = duration
+	}
+}
+
+// WithoutRevertReason disables the `eth_call` replay performed to fetch the revert reason of a
+// reverted transaction.
+func WithoutRevertReason() WaitOption {
+	return func(o *waitOptions) {
+		o.revertReason = false
+	}
+}
+
+// WaitMined waits until the transaction `hash` is mined and has received `confirmations` blocks
+// (the block containing it counts as the first one, `0` is treated like `1`). The node is only ever
+// polled, with an increasing interval between polls, `eth_subscribe` is not used even when the
+// client's transport supports subscriptions.
+//
+// While waiting for confirmations, a reorg removing the receipt's block from the canonical chain
+// resets the wait until the transaction is mined again. A transaction unknown to the node for too
+// long is reported as `TransactionStatusDropped` and one whose nonce got used by another mined
+// transaction is reported as `TransactionStatusReplaced`, in both cases without an error.
+//
+// When the transaction reverted, the transaction is replayed through `eth_call` at the receipt's
+// block to fetch the revert reason.
+func (c *Client) WaitMined(ctx context.Context, hash eth.Hash, confirmations uint64, opts ...WaitOption) (*MinedTransaction, error) {
+	options := &waitOptions{
+		pollInterval:    1 * time.Second,
+		maxPollInterval: 12 * time.Second,
+		droppedAfter:    5 * time.Minute,
+		revertReason:    true,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if confirmations == 0 {
+		confirmations = 1
+	}
+
+	logger := logging.Logger(ctx, zlog).With(zap.Stringer("trx_hash", hash))
+
+	out := &MinedTransaction{}
+	var transaction *Transaction
+	var lastSeen = time.Now()
+	var minedBlockHash eth.Hash
+
+	interval := options.pollInterval
+	for {
+		receipt, err := c.TransactionReceipt(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		if receipt == nil {
+			if minedBlockHash != nil {
+				logger.Info("transaction receipt disappeared, its block was reorged out", zap.Stringer("block_hash", minedBlockHash))
+				out.Reorgs++
+				minedBlockHash = nil
+			}
+
+			status, err := c.pendingTransactionStatus(ctx, hash, &transaction, &lastSeen, options.droppedAfter)
+			if err != nil {
+				return nil, err
+			}
+
+			if status != TransactionStatusUnknown {
+				logger.Info("transaction will never be mined", zap.Stringer("status", status))
+				out.Status = status
+				return out, nil
+			}
+		} else {
+			lastSeen = time.Now()
+			if minedBlockHash != nil && !bytes.Equal(minedBlockHash, receipt.BlockHash) {
+				logger.Info("transaction mined in another block, previous one was reorged out", zap.Stringer("previous_block_hash", minedBlockHash), zap.Stringer("block_hash", receipt.BlockHash))
+				out.Reorgs++
+			}
+			minedBlockHash = receipt.BlockHash
+
+			done, err := c.checkConfirmations(ctx, receipt, confirmations, out)
+			if err != nil {
+				return nil, err
+			}
+
+			if done {
+				return c.completeMinedTransaction(ctx, logger, receipt, out, options)
+			}
+
+			if out.Confirmations == 0 {
+				logger.Info("transaction receipt's block is not canonical anymore", zap.Stringer("block_hash", receipt.BlockHash))
+				out.Reorgs++
+				minedBlockHash = nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		interval = interval + interval/2
+		if interval > options.maxPollInterval {
+			interval = options.maxPollInterval
+		}
+	}
+}
+
+// pendingTransactionStatus determines if a transaction without a receipt is still pending (in which case
+// `TransactionStatusUnknown` is returned), was dropped or was replaced.
+func (c *Client) pendingTransactionStatus(ctx context.Context, hash eth.Hash, transaction **Transaction, lastSeen *time.Time, droppedAfter time.Duration) (TransactionStatus, error) {
+	current, err := c.TransactionByHash(ctx, hash)
+	if err != nil {
+		return TransactionStatusUnknown, err
+	}
+
+	if current != nil {
+		*transaction = current
+		*lastSeen = time.Now()
+	}
+
+	if *transaction != nil {
+		minedNonce, err := c.Nonce(ctx, (*transaction).From)
+		if err != nil {
+			return TransactionStatusUnknown, err
+		}
+
+		if minedNonce > uint64((*transaction).Nonce) {
+			// The transaction might just have been mined in-between our checks, let's make sure it's not the case
+			receipt, err := c.TransactionReceipt(ctx, hash)
+			if err != nil {
+				return TransactionStatusUnknown, err
+			}
+
+			if receipt == nil {
+				return TransactionStatusReplaced, nil
+			}
+
+			return TransactionStatusUnknown, nil
+		}
+	}
+
+	if current == nil && time.Since(*lastSeen) > droppedAfter {
+		return TransactionStatusDropped, nil
+	}
+
+	return TransactionStatusUnknown, nil
+}
+
+// checkConfirmations updates `out.Confirmations` with the number of confirmations of the receipt, `0` if
+// the receipt's block is not part of the canonical chain anymore.
+func (c *Client) checkConfirmations(ctx context.Context, receipt *TransactionReceipt, confirmations uint64, out *MinedTransaction) (done bool, err error) {
+	head, err := c.LatestBlockNum(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	blockNum := uint64(receipt.BlockNumber)
+	if head < blockNum {
+		// Node lagging behind the one that served the receipt, let's wait for it
+		out.Confirmations = 1
+		return false, nil
+	}
+
+	block, err := c.GetBlockByNumber(ctx, blockNum)
+	if err != nil {
+		return false, err
+	}
+
+	if block == nil || !bytes.Equal(block.Hash, receipt.BlockHash) {
+		out.Confirmations = 0
+		return false, nil
+	}
+
+	out.Confirmations = head - blockNum + 1
+	return out.Confirmations >= confirmations, nil
+}
+
+func (c *Client) completeMinedTransaction(ctx context.Context, logger *zap.Logger, receipt *TransactionReceipt, out *MinedTransaction, options *waitOptions) (*MinedTransaction, error) {
+	out.Receipt = receipt
+	switch {
+	case receipt.Status == nil:
+		out.Status = TransactionStatusUnknown
+	case *receipt.Status == 1:
+		out.Status = TransactionStatusSucceeded
+	default:
+		out.Status = TransactionStatusReverted
+	}
+
+	if out.Status == TransactionStatusReverted && options.revertReason {
+		if err := c.fetchRevertReason(ctx, receipt, out); err != nil {
+			// The revert reason is a best effort, we don't fail the whole wait for it
+			logger.Info("unable to fetch transaction revert reason", zap.Error(err))
+		}
+	}
+
+	return out, nil
+}
+
+var errNotReverted = errors.New("replayed call did not revert")
+
+func (c *Client) fetchRevertReason(ctx context.Context, receipt *TransactionReceipt, out *MinedTransaction) error {
+	transaction, err := c.TransactionByHash(ctx, receipt.TransactionHash)
+	if err != nil {
+		return err
+	}
+
+	if transaction == nil {
+		return fmt.Errorf("transaction %s not found", receipt.TransactionHash.Pretty())
+	}
+
+	params := CallParams{
+		From:     transaction.From,
+		GasLimit: uint64(transaction.Gas),
+		Value:    transaction.Value.Int(),
+	}
+	if transaction.To != nil {
+		params.To = *transaction.To
+	}
+	if len(transaction.Input) > 0 {
+		params.Data = transaction.Input
+	}
+
+	_, err = c.CallAtBlock(ctx, params, BlockNumber(uint64(receipt.BlockNumber)))
+	if err == nil {
+		return errNotReverted
+	}
+
+	var rpcErr *ErrResponse
+	if !errors.As(err, &rpcErr) {
+		return err
+	}
+
+	if data, ok := rpcErr.RevertData(); ok {
+		out.RevertData = data
+		if reason, ok := DecodeRevertReason(data); ok {
+			out.RevertReason = reason
+			return nil
+		}
+	}
+
+	// Without revert data, only errors of the execution itself are revert reasons, the replay can also
+	// fail because the node pruned the block's state or rate limited us
+	if out.RevertData == nil && !IsDeterministicError(rpcErr) {
+		return fmt.Errorf("replay call: %w", err)
+	}
+
+	out.RevertReason = strings.TrimPrefix(rpcErr.Message, "execution reverted: ")
+	return nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTrxHash = eth.MustNewHash("0x8e4d4b2d4c8bdc0f0d8ab2e1f1fc51bfa8a85d7bb5f0ce0c9ac4c3b9d9c2d2f1")
+
+func TestClient_WaitMined(t *testing.T) {
+	pendingTrx := map[string]interface{}{"hash": testTrxHash.Pretty(), "from": testAccount.Pretty(), "nonce": "0x5", "value": "0x0", "gas": "0x5208", "input": "0x"}
+	minedTrx := map[string]interface{}{"hash": testTrxHash.Pretty(), "from": testAccount.Pretty(), "to": "0x3535353535353535353535353535353535353535", "nonce": "0x5", "value": "0x0", "gas": "0x5208", "input": "0x01", "blockNumber": "0x64"}
+	receipt := func(blockHash string, status string) map[string]interface{} {
+		return map[string]interface{}{"transactionHash": testTrxHash.Pretty(), "blockHash": blockHash, "blockNumber": "0x64", "status": status, "logs": []interface{}{}}
+	}
+
+	tests := []struct {
+		name          string
+		confirmations uint64
+		results       func(poll func() int) map[string]interface{}
+		expected      *MinedTransaction
+	}{
+		{
+			name:          "succeeded after being pending",
+			confirmations: 3,
+			results: func(poll func() int) map[string]interface{} {
+				return map[string]interface{}{
+					"eth_getTransactionReceipt": func(params []interface{}) interface{} {
+						if poll() < 3 {
+							return nil
+						}
+						return receipt("0xaa", "0x1")
+					},
+					"eth_getTransactionByHash": pendingTrx,
+					"eth_getTransactionCount":  "0x5",
+					"eth_blockNumber":          func(params []interface{}) interface{} { return fmt.Sprintf("0x%x", 0x64+poll()-3) },
+					"eth_getBlockByNumber":     map[string]interface{}{"hash": "0xaa"},
+				}
+			},
+			expected: &MinedTransaction{
+				Status:        TransactionStatusSucceeded,
+				Receipt:       &TransactionReceipt{TransactionHash: testTrxHash, BlockHash: eth.MustNewHash("0xaa"), BlockNumber: 0x64, Logs: []*LogEntry{}, Status: ethUint64Ptr(1)},
+				Confirmations: 3,
+			},
+		},
+		{
+			name:          "reverted",
+			confirmations: 1,
+			results: func(poll func() int) map[string]interface{} {
+				return map[string]interface{}{
+					"eth_getTransactionReceipt": receipt("0xaa", "0x0"),
+					"eth_getTransactionByHash":  minedTrx,
+					"eth_blockNumber":           "0x64",
+					"eth_getBlockByNumber":      map[string]interface{}{"hash": "0xaa"},
+					"eth_call":                  &ErrResponse{Code: 3, Message: "execution reverted: not enough", Data: "0x08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000a6e6f7420656e6f75676800000000000000000000000000000000000000000000"},
+				}
+			},
+			expected: &MinedTransaction{
+				Status:        TransactionStatusReverted,
+				Receipt:       &TransactionReceipt{TransactionHash: testTrxHash, BlockHash: eth.MustNewHash("0xaa"), BlockNumber: 0x64, Logs: []*LogEntry{}, Status: ethUint64Ptr(0)},
+				Confirmations: 1,
+				RevertData:    eth.MustNewHex("0x08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000a6e6f7420656e6f75676800000000000000000000000000000000000000000000"),
+				RevertReason:  "not enough",
+			},
+		},
+		{
+			name:          "reverted with replay failure",
+			confirmations: 1,
+			results: func(poll func() int) map[string]interface{} {
+				return map[string]interface{}{
+					"eth_getTransactionReceipt": receipt("0xaa", "0x0"),
+					"eth_getTransactionByHash":  minedTrx,
+					"eth_blockNumber":           "0x64",
+					"eth_getBlockByNumber":      map[string]interface{}{"hash": "0xaa"},
+					"eth_call":                  &ErrResponse{Code: -32000, Message: "missing trie node 5e1ad0bd1b6d6c1d4e2d4c3b7c1b0e0c0a9b8c7d6e5f4a3b2c1d0e0f0a1b2c3d (path ) state 0x5e1ad0bd1b6d6c1d4e2d4c3b7c1b0e0c0a9b8c7d6e5f4a3b2c1d0e0f0a1b2c3d is not available, not found"},
+				}
+			},
+			expected: &MinedTransaction{
+				Status:        TransactionStatusReverted,
+				Receipt:       &TransactionReceipt{TransactionHash: testTrxHash, BlockHash: eth.MustNewHash("0xaa"), BlockNumber: 0x64, Logs: []*LogEntry{}, Status: ethUint64Ptr(0)},
+				Confirmations: 1,
+			},
+		},
+		{
+			name:          "replaced",
+			confirmations: 1,
+			results: func(poll func() int) map[string]interface{} {
+				return map[string]interface{}{
+					"eth_getTransactionReceipt": nil,
+					"eth_getTransactionByHash": func(params []interface{}) interface{} {
+						if poll() < 2 {
+							return pendingTrx
+						}
+						return nil
+					},
+					"eth_getTransactionCount": func(params []interface{}) interface{} {
+						if poll() < 2 {
+							return "0x5"
+						}
+						return "0x6"
+					},
+				}
+			},
+			expected: &MinedTransaction{Status: TransactionStatusReplaced},
+		},
+		{
+			name:          "reorged while waiting for confirmations",
+			confirmations: 2,
+			results: func(poll func() int) map[string]interface{} {
+				return map[string]interface{}{
+					"eth_getTransactionReceipt": func(params []interface{}) interface{} {
+						if poll() < 2 {
+							return receipt("0xaa", "0x1")
+						}
+						return receipt("0xbb", "0x1")
+					},
+					"eth_blockNumber": func(params []interface{}) interface{} {
+						if poll() < 2 {
+							return "0x64"
+						}
+						return "0x65"
+					},
+					"eth_getBlockByNumber": func(params []interface{}) interface{} {
+						if poll() < 2 {
+							return map[string]interface{}{"hash": "0xaa"}
+						}
+						return map[string]interface{}{"hash": "0xbb"}
+					},
+				}
+			},
+			expected: &MinedTransaction{
+				Status:        TransactionStatusSucceeded,
+				Receipt:       &TransactionReceipt{TransactionHash: testTrxHash, BlockHash: eth.MustNewHash("0xbb"), BlockNumber: 0x64, Logs: []*LogEntry{}, Status: ethUint64Ptr(1)},
+				Confirmations: 2,
+				Reorgs:        1,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Each poll starts with a eth_getTransactionReceipt call, so we use their count as the poll number
+			var server *mockJSONRPCMethodsServer
+			poll := func() int { return server.Count("eth_getTransactionReceipt") }
+
+			server, closer := mockJSONRPCMethods(t, test.results(poll))
+			defer closer()
+
+			client := NewClient(server.URL)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			actual, err := client.WaitMined(ctx, testTrxHash, test.confirmations, WithPollInterval(10*time.Millisecond, 10*time.Millisecond))
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestClient_WaitMined_Dropped(t *testing.T) {
+	server, closer := mockJSONRPCMethods(t, map[string]interface{}{
+		"eth_getTransactionReceipt": nil,
+		"eth_getTransactionByHash":  nil,
+	})
+	defer closer()
+
+	actual, err := NewClient(server.URL).WaitMined(context.Background(), testTrxHash, 1, WithPollInterval(time.Millisecond, time.Millisecond), WithDroppedAfter(20*time.Millisecond))
+	require.NoError(t, err)
+
+	assert.Equal(t, &MinedTransaction{Status: TransactionStatusDropped}, actual)
+}
+
+func TestDecodeRevertReason(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         string
+		expected   string
+		expectedOk bool
+	}{
+		{"error string", "0x08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000a6e6f7420656e6f75676800000000000000000000000000000000000000000000", "not enough", true},
+		{"panic", "0x4e487b710000000000000000000000000000000000000000000000000000000000000011", "panic: 0x11", true},
+		{"custom error", "0xdeadbeef", "", false},
+		{"empty", "0x", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, ok := DecodeRevertReason(eth.MustNewHex(test.in))
+
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.expectedOk, ok)
+		})
+	}
+}
+
+func ethUint64Ptr(v uint64) *eth.Uint64 {
+	out := eth.Uint64(v)
+	return &out
+}
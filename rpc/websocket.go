@@ -0,0 +1,692 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
+)
+
+var ErrClientClosed = errors.New("client closed")
+
+type WebSocketOption func(*WebSocketClient)
+
+// WithWebSocketHeader sets extra HTTP headers sent with the WebSocket handshake, authentication
+// headers for example.
+func WithWebSocketHeader(header http.Header) WebSocketOption {
+	return func(c *WebSocketClient) {
+		c.header = header
+	}
+}
+
+// WithReconnectDelay sets the delay before reconnecting after the connection is lost, the delay doubles
+// after each failed attempt, up to `max`. Defaults to 500ms up to 30s.
+func WithReconnectDelay(initial, max time.Duration) WebSocketOption {
+	return func(c *WebSocketClient) {
+		c.reconnectDelay = initial
+		c.maxReconnectDelay = max
+	}
+}
+
+// WithKeepAlive sets the interval between the pings sent to the node and for how long the client
+// waits for any data, pongs included, or for a message to be written before considering the
+// connection lost. Defaults to pinging every 30s with a 60s timeout, a `0` interval disables pings
+// and a `0` timeout disables the timeout.
+func WithKeepAlive(pingInterval, timeout time.Duration) WebSocketOption {
+	return func(c *WebSocketClient) {
+		c.pingInterval = pingInterval
+		c.readTimeout = timeout
+	}
+}
+
+// WebSocketClient talks to a node over a WebSocket connection, which unlike HTTP supports
+// `eth_subscribe`. The connection is established on first use, when it's lost while subscriptions
+// are active, the client reconnects and subscribes again to all of them.
+//
+// Events are delivered on the subscriptions' channels from the connection's reading loop, a channel
+// not consumed blocks all calls and subscriptions of the client.
+type WebSocketClient struct {
+	URL string
+
+	header            http.Header
+	reconnectDelay    time.Duration
+	maxReconnectDelay time.Duration
+	pingInterval      time.Duration
+	readTimeout       time.Duration
+
+	// dialLock ensures a single connection attempt at a time
+	dialLock sync.Mutex
+
+	lock    sync.Mutex
+	conn    *wsConn
+	nextID  int
+	pending map[int]*wsPendingCall
+	// subscriptions holds the active subscriptions by their node's identifier, which changes on resubscription
+	subscriptions map[string]*Subscription
+	active        map[*Subscription]bool
+	closed        bool
+	closing       chan struct{}
+}
+
+var _ StreamingTransport = (*WebSocketClient)(nil)
+
+func NewWebSocketClient(url string, opts ...WebSocketOption) *WebSocketClient {
+	c := &WebSocketClient{
+		URL:               url,
+		reconnectDelay:    500 * time.Millisecond,
+		maxReconnectDelay: 30 * time.Second,
+		pingInterval:      30 * time.Second,
+		readTimeout:       60 * time.Second,
+		pending:           map[int]*wsPendingCall{},
+		subscriptions:     map[string]*Subscription{},
+		active:            map[*Subscription]bool{},
+		closing:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+type wsPendingCall struct {
+	// onResult, when set, is called by the read loop with the call's result before any following
+	// message is processed
+	onResult func(result json.RawMessage)
+	done     chan wsCallResult
+}
+
+// complete delivers the call's outcome, only the first one is kept when the call's response races
+// with the loss of the connection.
+func (p *wsPendingCall) complete(result wsCallResult) {
+	select {
+	case p.done <- result:
+	default:
+	}
+}
+
+type wsCallResult struct {
+	message *wsMessage
+	raw     []byte
+	// err is set when the call failed without a response from the node
+	err error
+}
+
+type wsMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *ErrResponse    `json:"error"`
+	Params *struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+// DoRequest performs a single JSON-RPC call and returns its result like `Client.DoRequest`.
+func (c *WebSocketClient) DoRequest(ctx context.Context, method string, params []interface{}) (string, error) {
+	result, err := c.call(ctx, method, params, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return gjson.ParseBytes(result).String(), nil
+}
+
+// RoundTrip sends a JSON-RPC payload, a single request or a batch, which makes the client usable
+// as a `Client`'s transport. The requests are sent individually under identifiers unique to the
+// connection, the response holds the original identifiers.
+func (c *WebSocketClient) RoundTrip(ctx context.Context, request []byte) ([]byte, error) {
+	request = bytes.TrimSpace(request)
+	batch := len(request) > 0 && request[0] == '['
+
+	var requests []map[string]json.RawMessage
+	if batch {
+		if err := json.Unmarshal(request, &requests); err != nil {
+			return nil, fmt.Errorf("invalid json_rpc batch: %w", err)
+		}
+	} else {
+		var single map[string]json.RawMessage
+		if err := json.Unmarshal(request, &single); err != nil {
+			return nil, fmt.Errorf("invalid json_rpc request: %w", err)
+		}
+		requests = []map[string]json.RawMessage{single}
+	}
+
+	type inflight struct {
+		id         int
+		pending    *wsPendingCall
+		originalID json.RawMessage
+	}
+
+	calls := make([]inflight, 0, len(requests))
+	defer func() {
+		for _, call := range calls {
+			c.forget(call.id)
+		}
+	}()
+
+	for _, req := range requests {
+		originalID := req["id"]
+		id, pending, err := c.send(ctx, func(id int) ([]byte, error) {
+			req["id"] = json.RawMessage(fmt.Sprintf(`"0x%x"`, id))
+			return json.Marshal(req)
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		calls = append(calls, inflight{id: id, pending: pending, originalID: originalID})
+	}
+
+	responses := make([]json.RawMessage, len(calls))
+	for i, call := range calls {
+		out, err := c.wait(ctx, call.id, call.pending)
+		if err != nil {
+			return nil, err
+		}
+
+		var response map[string]json.RawMessage
+		if err := json.Unmarshal(out.raw, &response); err != nil {
+			return nil, fmt.Errorf("invalid json_rpc response: %w", err)
+		}
+
+		if call.originalID != nil {
+			response["id"] = call.originalID
+		} else {
+			delete(response, "id")
+		}
+
+		if responses[i], err = json.Marshal(response); err != nil {
+			return nil, err
+		}
+	}
+
+	if !batch {
+		return responses[0], nil
+	}
+	return json.Marshal(responses)
+}
+
+// SubscribeNewHeads is `Client.SubscribeNewHeads` for this WebSocket connection.
+func (c *WebSocketClient) SubscribeNewHeads(ctx context.Context, ch chan<- *Block) (*Subscription, error) {
+	return subscribeNewHeads(ctx, c, ch)
+}
+
+// SubscribeLogs is `Client.SubscribeLogs` for this WebSocket connection.
+func (c *WebSocketClient) SubscribeLogs(ctx context.Context, params LogsParams, ch chan<- *LogEntry) (*Subscription, error) {
+	return subscribeLogs(ctx, c, params, ch)
+}
+
+// SubscribeNewPendingTransactions is `Client.SubscribeNewPendingTransactions` for this WebSocket connection.
+func (c *WebSocketClient) SubscribeNewPendingTransactions(ctx context.Context, ch chan<- eth.Hash) (*Subscription, error) {
+	return subscribeNewPendingTransactions(ctx, c, ch)
+}
+
+// Close closes the connection and ends all subscriptions with `ErrClientClosed`.
+func (c *WebSocketClient) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+
+	c.closed = true
+	close(c.closing)
+	conn := c.conn
+	c.conn = nil
+	subscriptions := make([]*Subscription, 0, len(c.active))
+	for subscription := range c.active {
+		subscriptions = append(subscriptions, subscription)
+	}
+	c.lock.Unlock()
+
+	for _, subscription := range subscriptions {
+		subscription.fail(ErrClientClosed)
+	}
+
+	if conn != nil {
+		c.failPending(ErrClientClosed)
+		return conn.Close()
+	}
+	return nil
+}
+
+func (c *WebSocketClient) connection(ctx context.Context) (*wsConn, error) {
+	c.dialLock.Lock()
+	defer c.dialLock.Unlock()
+
+	c.lock.Lock()
+	closed, conn := c.closed, c.conn
+	c.lock.Unlock()
+
+	if closed {
+		return nil, ErrClientClosed
+	}
+	if conn != nil {
+		return conn, nil
+	}
+
+	conn, err := dialWebSocket(ctx, c.URL, c.header)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", c.URL, err)
+	}
+
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		conn.Close()
+		return nil, ErrClientClosed
+	}
+	conn.readTimeout = c.readTimeout
+	conn.writeTimeout = c.readTimeout
+	c.conn = conn
+	c.lock.Unlock()
+
+	go c.readLoop(conn)
+	if c.pingInterval > 0 {
+		go c.pingLoop(conn)
+	}
+	return conn, nil
+}
+
+// pingLoop pings the node periodically for as long as `conn` is the client's connection, so that a
+// connection silently dropped along the way hits the read timeout.
+func (c *WebSocketClient) pingLoop(conn *wsConn) {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closing:
+			return
+		case <-ticker.C:
+		}
+
+		c.lock.Lock()
+		current := c.conn
+		c.lock.Unlock()
+
+		if current != conn {
+			return
+		}
+
+		if err := conn.Ping(); err != nil {
+			c.disconnected(conn, err)
+			return
+		}
+	}
+}
+
+func (c *WebSocketClient) call(ctx context.Context, method string, params []interface{}, onResult func(result json.RawMessage)) (json.RawMessage, error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	id, pending, err := c.send(ctx, func(id int) ([]byte, error) {
+		req, err := MarshalJSONRPC(&RPCRequest{Params: params, Method: method, JSONRPC: "2.0", ID: id})
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal json_rpc request: %w", err)
+		}
+		return req, nil
+	}, onResult)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := c.wait(ctx, id, pending)
+	if err != nil {
+		return nil, err
+	}
+
+	if out.message.Error != nil {
+		return nil, out.message.Error
+	}
+	return out.message.Result, nil
+}
+
+// send registers a pending call under a new identifier then writes the request `build` returns
+// for this identifier.
+func (c *WebSocketClient) send(ctx context.Context, build func(id int) ([]byte, error), onResult func(result json.RawMessage)) (id int, pending *wsPendingCall, err error) {
+	conn, err := c.connection(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	pending = &wsPendingCall{onResult: onResult, done: make(chan wsCallResult, 1)}
+
+	c.lock.Lock()
+	c.nextID++
+	id = c.nextID
+	c.pending[id] = pending
+	c.lock.Unlock()
+
+	req, err := build(id)
+	if err != nil {
+		c.forget(id)
+		return 0, nil, err
+	}
+
+	if err := conn.WriteMessage(ctx, req); err != nil {
+		c.forget(id)
+		c.disconnected(conn, err)
+		return 0, nil, fmt.Errorf("sending request to json_rpc endpoint: %w", err)
+	}
+
+	return id, pending, nil
+}
+
+func (c *WebSocketClient) wait(ctx context.Context, id int, pending *wsPendingCall) (wsCallResult, error) {
+	defer c.forget(id)
+
+	select {
+	case <-ctx.Done():
+		return wsCallResult{}, ctx.Err()
+	case out := <-pending.done:
+		return out, out.err
+	}
+}
+
+func (c *WebSocketClient) forget(id int) {
+	c.lock.Lock()
+	delete(c.pending, id)
+	c.lock.Unlock()
+}
+
+func (c *WebSocketClient) readLoop(conn *wsConn) {
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			c.disconnected(conn, err)
+			return
+		}
+
+		if tracer.Enabled() {
+			zlog.Debug("websocket message received", zap.String("message", string(data)))
+		}
+
+		message := &wsMessage{}
+		if err := json.Unmarshal(data, message); err != nil {
+			zlog.Info("skipping invalid websocket message", zap.String("message", string(data)), zap.Error(err))
+			continue
+		}
+
+		if len(message.ID) > 0 && string(message.ID) != "null" {
+			id, _ := parseRPCID(string(message.ID))
+
+			c.lock.Lock()
+			pending := c.pending[id]
+			c.lock.Unlock()
+
+			if pending == nil {
+				continue
+			}
+
+			if pending.onResult != nil && message.Error == nil {
+				pending.onResult(message.Result)
+			}
+			pending.complete(wsCallResult{message: message, raw: data})
+			continue
+		}
+
+		if message.Method == "eth_subscription" && message.Params != nil {
+			c.lock.Lock()
+			subscription := c.subscriptions[message.Params.Subscription]
+			c.lock.Unlock()
+
+			if subscription != nil {
+				subscription.deliver(message.Params.Result)
+			}
+		}
+	}
+}
+
+// disconnected drops the lost connection `conn`, failing its in-flight calls, and starts reconnecting
+// if subscriptions are active.
+func (c *WebSocketClient) disconnected(conn *wsConn, err error) {
+	c.lock.Lock()
+	if c.conn != conn {
+		c.lock.Unlock()
+		return
+	}
+
+	c.conn = nil
+	c.subscriptions = map[string]*Subscription{}
+	reconnect := len(c.active) > 0 && !c.closed
+	c.lock.Unlock()
+
+	conn.Close()
+	c.failPending(err)
+
+	zlog.Info("websocket connection lost", zap.String("url", c.URL), zap.Bool("reconnect", reconnect), zap.Error(err))
+	if reconnect {
+		go c.reconnect()
+	}
+}
+
+func (c *WebSocketClient) failPending(err error) {
+	c.lock.Lock()
+	pending := c.pending
+	c.pending = map[int]*wsPendingCall{}
+	c.lock.Unlock()
+
+	for _, call := range pending {
+		call.complete(wsCallResult{err: fmt.Errorf("connection lost: %w", err)})
+	}
+}
+
+func (c *WebSocketClient) reconnect() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	delay := c.reconnectDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		conn, err := c.connection(ctx)
+		if err == nil {
+			c.resubscribe(ctx, conn)
+			return
+		}
+
+		if errors.Is(err, ErrClientClosed) {
+			return
+		}
+
+		delay *= 2
+		if delay > c.maxReconnectDelay {
+			delay = c.maxReconnectDelay
+		}
+
+		zlog.Info("websocket reconnection failed", zap.String("url", c.URL), zap.Duration("next_attempt_in", delay), zap.Error(err))
+	}
+}
+
+func (c *WebSocketClient) resubscribe(ctx context.Context, conn *wsConn) {
+	c.lock.Lock()
+	subscriptions := make([]*Subscription, 0, len(c.active))
+	for subscription := range c.active {
+		subscriptions = append(subscriptions, subscription)
+	}
+	c.lock.Unlock()
+
+	zlog.Info("websocket reconnected, subscribing again", zap.String("url", c.URL), zap.Int("subscription_count", len(subscriptions)))
+	for _, subscription := range subscriptions {
+		err := c.sendSubscribe(ctx, subscription)
+		if err == nil {
+			continue
+		}
+
+		var rpcErr *ErrResponse
+		if errors.As(err, &rpcErr) {
+			subscription.fail(fmt.Errorf("subscribe again: %w", err))
+			continue
+		}
+
+		// The new connection was lost as well, losing it started another reconnection
+		return
+	}
+}
+
+// Subscribe calls `eth_subscribe` with `params` then calls `onEvent` with the result of each event
+// received until the subscription ends, an error returned by `onEvent` ends the subscription.
+func (c *WebSocketClient) Subscribe(ctx context.Context, params []interface{}, onEvent func(ctx context.Context, result json.RawMessage) error) (*Subscription, error) {
+	subCtx, cancel := context.WithCancel(ctx)
+	subscription := &Subscription{
+		client:  c,
+		params:  params,
+		decode:  onEvent,
+		ctx:     subCtx,
+		cancel:  cancel,
+		err:     make(chan error, 1),
+		stopped: make(chan struct{}),
+	}
+
+	if err := c.sendSubscribe(ctx, subscription); err != nil {
+		// The response might have been received, registering the subscription, before `ctx` ended
+		cancel()
+		c.unsubscribe(subscription)
+		return nil, fmt.Errorf("subscribe %s: %w", params[0], err)
+	}
+
+	go subscription.run()
+	return subscription, nil
+}
+
+func (c *WebSocketClient) sendSubscribe(ctx context.Context, subscription *Subscription) error {
+	_, err := c.call(ctx, "eth_subscribe", subscription.params, func(result json.RawMessage) {
+		var id string
+		if err := json.Unmarshal(result, &id); err != nil {
+			return
+		}
+
+		// Registered from the read loop so that events following the response are not missed
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if subscription.ctx.Err() != nil {
+			return
+		}
+
+		subscription.id = id
+		c.subscriptions[id] = subscription
+		c.active[subscription] = true
+	})
+
+	return err
+}
+
+func (c *WebSocketClient) unsubscribe(subscription *Subscription) {
+	c.lock.Lock()
+	delete(c.active, subscription)
+	id := subscription.id
+	if id != "" && c.subscriptions[id] == subscription {
+		delete(c.subscriptions, id)
+	}
+	connected := c.conn != nil && !c.closed
+	c.lock.Unlock()
+
+	if id == "" || !connected {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := c.call(ctx, "eth_unsubscribe", []interface{}{id}, nil); err != nil {
+		zlog.Debug("unable to unsubscribe", zap.String("subscription_id", id), zap.Error(err))
+	}
+}
+
+// Subscription is an active `eth_subscribe` subscription of a `WebSocketClient`, it survives
+// reconnections.
+type Subscription struct {
+	client *WebSocketClient
+	params []interface{}
+	decode func(ctx context.Context, result json.RawMessage) error
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// id is the node's identifier of the subscription, guarded by the client's lock
+	id string
+
+	failureLock sync.Mutex
+	failure     error
+	err         chan error
+	stopped     chan struct{}
+}
+
+// Err returns a channel receiving the error that ended the subscription, it's closed once the
+// subscription ended, without receiving anything when it ended through its context or `Unsubscribe`.
+func (s *Subscription) Err() <-chan error {
+	return s.err
+}
+
+// Unsubscribe ends the subscription and waits until the node was told about it.
+func (s *Subscription) Unsubscribe() {
+	s.cancel()
+	<-s.stopped
+}
+
+func (s *Subscription) run() {
+	<-s.ctx.Done()
+	s.client.unsubscribe(s)
+
+	s.failureLock.Lock()
+	if s.failure != nil {
+		s.err <- s.failure
+	}
+	s.failureLock.Unlock()
+
+	close(s.err)
+	close(s.stopped)
+}
+
+func (s *Subscription) deliver(result json.RawMessage) {
+	if err := s.decode(s.ctx, result); err != nil {
+		s.fail(err)
+	}
+}
+
+func (s *Subscription) fail(err error) {
+	s.failureLock.Lock()
+	if s.failure == nil {
+		s.failure = err
+	}
+	s.failureLock.Unlock()
+
+	s.cancel()
+}
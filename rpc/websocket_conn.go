@@ -0,0 +1,384 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// The WebSocket protocol (RFC 6455) subset needed to talk JSON-RPC to Ethereum nodes, messages
+// are exchanged as text frames, fragmented messages are reassembled and pings are sent and answered.
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+
+	wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// wsMaxMessageSize is the biggest message accepted, large enough for full blocks and big log batches
+	wsMaxMessageSize = 128 * 1024 * 1024
+
+	// wsCloseTimeout is the longest time waited for the close frame to be sent before closing the connection
+	wsCloseTimeout = time.Second
+)
+
+var errWebSocketClosed = errors.New("websocket connection closed")
+
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// masked is true for client connections, which must mask the frames they send
+	masked bool
+	// readTimeout is the longest time waited for the next frame, each frame received extends the
+	// read deadline, no deadline when 0
+	readTimeout time.Duration
+	// writeTimeout is the longest time a frame can take to be written, a peer that stops reading
+	// eventually fills the connection's buffers and blocks writes, no deadline when 0
+	writeTimeout time.Duration
+
+	writeLock sync.Mutex
+}
+
+func dialWebSocket(ctx context.Context, rawURL string, header http.Header) (*wsConn, error) {
+	endpoint, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket url %q: %w", rawURL, err)
+	}
+
+	host := endpoint.Host
+	secure := false
+	switch endpoint.Scheme {
+	case "ws":
+		if endpoint.Port() == "" {
+			host = net.JoinHostPort(endpoint.Hostname(), "80")
+		}
+	case "wss":
+		secure = true
+		if endpoint.Port() == "" {
+			host = net.JoinHostPort(endpoint.Hostname(), "443")
+		}
+	default:
+		return nil, fmt.Errorf("invalid websocket url %q: unsupported scheme %q", rawURL, endpoint.Scheme)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	if secure {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: endpoint.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("tls handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	// The handshake must not outlive the context, closing the connection unblocks it
+	handshakeDone := make(chan struct{})
+	defer close(handshakeDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshakeDone:
+		}
+	}()
+
+	ws, err := wsClientHandshake(conn, endpoint, header)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("websocket handshake: %w", err)
+	}
+
+	return ws, nil
+}
+
+func wsClientHandshake(conn net.Conn, endpoint *url.URL, header http.Header) (*wsConn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     "GET",
+		URL:        endpoint,
+		Host:       endpoint.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		return nil, fmt.Errorf("invalid Sec-WebSocket-Accept header")
+	}
+
+	return &wsConn{conn: conn, reader: reader, masked: true}, nil
+}
+
+func wsAcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ReadMessage returns the next data message, answering pings received while waiting for it.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(context.Background(), wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			// Echo the close frame to complete the closing handshake, the connection is unusable afterward anyway
+			c.writeFrame(context.Background(), wsOpClose, payload)
+			return nil, errWebSocketClosed
+		case wsOpText, wsOpBinary:
+			if message != nil {
+				return nil, fmt.Errorf("new message started before the end of the previous one")
+			}
+			message = payload
+		case wsOpContinuation:
+			if message == nil {
+				return nil, fmt.Errorf("continuation frame without a started message")
+			}
+			message = append(message, payload...)
+		default:
+			return nil, fmt.Errorf("unknown frame opcode %d", opcode)
+		}
+
+		if len(message) > wsMaxMessageSize {
+			return nil, fmt.Errorf("message bigger than %d bytes", wsMaxMessageSize)
+		}
+
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	if err = c.extendReadDeadline(); err != nil {
+		return
+	}
+
+	var header [2]byte
+	if _, err = io.ReadFull(c.reader, header[:]); err != nil {
+		return
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err = io.ReadFull(c.reader, extended[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err = io.ReadFull(c.reader, extended[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	if length > wsMaxMessageSize {
+		err = fmt.Errorf("frame bigger than %d bytes", wsMaxMessageSize)
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+			return
+		}
+	}
+
+	// Large frames can take a while to arrive, they get a full timeout once their header is read
+	if err = c.extendReadDeadline(); err != nil {
+		return
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return
+}
+
+func (c *wsConn) extendReadDeadline() error {
+	if c.readTimeout <= 0 {
+		return nil
+	}
+	return c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+}
+
+// Ping sends a ping frame, the peer's pong extends the read deadline like any other frame.
+func (c *wsConn) Ping() error {
+	return c.writeFrame(context.Background(), wsOpPing, nil)
+}
+
+// WriteMessage sends `data` as a single text frame, giving up at the deadline of `ctx` if it comes
+// before the write timeout, it's safe for concurrent use. The connection must be closed after a
+// failed write, the frame might have been partially written.
+func (c *wsConn) WriteMessage(ctx context.Context, data []byte) error {
+	return c.writeFrame(ctx, wsOpText, data)
+}
+
+func (c *wsConn) writeDeadline(ctx context.Context) time.Time {
+	deadline, _ := ctx.Deadline()
+	if c.writeTimeout > 0 {
+		if timeout := time.Now().Add(c.writeTimeout); deadline.IsZero() || timeout.Before(deadline) {
+			deadline = timeout
+		}
+	}
+	return deadline
+}
+
+func (c *wsConn) writeFrame(ctx context.Context, opcode byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|opcode)
+
+	maskBit := byte(0)
+	if c.masked {
+		maskBit = 0x80
+	}
+
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[len(frame)-2:], uint16(length))
+	default:
+		frame = append(frame, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(length))
+	}
+
+	if c.masked {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if err := c.conn.SetWriteDeadline(c.writeDeadline(ctx)); err != nil {
+		return err
+	}
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close sends the close frame then closes the connection. A write blocked on a peer that stopped
+// reading holds the write lock, the connection is then closed without waiting for the close frame,
+// which unblocks the write.
+func (c *wsConn) Close() error {
+	sent := make(chan struct{})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), wsCloseTimeout)
+		defer cancel()
+
+		c.writeFrame(ctx, wsOpClose, []byte{0x03, 0xe8})
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(wsCloseTimeout):
+	}
+
+	return c.conn.Close()
+}
@@ -0,0 +1,318 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketClient_SubscribeNewHeads(t *testing.T) {
+	server := mockWebSocket(t, func(conn *mockWebSocketConn, request map[string]interface{}) {
+		switch request["method"] {
+		case "eth_subscribe":
+			conn.Respond(request, "0xaa")
+			conn.Notify("0xaa", map[string]interface{}{"number": "0x1", "hash": "0x01"})
+			conn.Notify("0xaa", map[string]interface{}{"number": "0x2", "hash": "0x02"})
+		case "eth_unsubscribe":
+			conn.Respond(request, true)
+		}
+	})
+	defer server.Close()
+
+	client := NewWebSocketClient(server.URL)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	heads := make(chan *Block)
+	subscription, err := client.SubscribeNewHeads(ctx, heads)
+	require.NoError(t, err)
+
+	assert.Equal(t, eth.Uint64(1), (<-heads).Number)
+	assert.Equal(t, eth.Uint64(2), (<-heads).Number)
+
+	subscription.Unsubscribe()
+	_, ok := <-subscription.Err()
+	assert.False(t, ok)
+
+	assert.Equal(t, []interface{}{"newHeads"}, server.Params("eth_subscribe"))
+	assert.Equal(t, []interface{}{"0xaa"}, server.Params("eth_unsubscribe"))
+}
+
+func TestWebSocketClient_SubscribeLogs(t *testing.T) {
+	server := mockWebSocket(t, func(conn *mockWebSocketConn, request map[string]interface{}) {
+		conn.Respond(request, "0xbb")
+		conn.Notify("0xbb", map[string]interface{}{"address": "0x5a0b54d5dc17e0aadc383d2db43b0a0d3e029c4c", "topics": []string{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}, "data": "0x", "logIndex": "0x3"})
+	})
+	defer server.Close()
+
+	client := NewWebSocketClient(server.URL)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	logs := make(chan *LogEntry)
+	_, err := client.SubscribeLogs(ctx, LogsParams{
+		FromBlock: BlockNumber(10),
+		Address:   eth.MustNewAddress("0x5a0b54d5dc17e0aadc383d2db43b0a0d3e029c4c"),
+		Topics:    NewTopicFilter(eth.MustNewHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")),
+	}, logs)
+	require.NoError(t, err)
+
+	assert.Equal(t, eth.Uint64(3), (<-logs).LogIndex)
+	assert.Equal(t, []interface{}{"logs", map[string]interface{}{
+		"address": "0x5a0b54d5dc17e0aadc383d2db43b0a0d3e029c4c",
+		"topics":  []interface{}{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"},
+	}}, server.Params("eth_subscribe"))
+}
+
+func TestWebSocketClient_Reconnect(t *testing.T) {
+	server := mockWebSocket(t, func(conn *mockWebSocketConn, request map[string]interface{}) {
+		switch request["method"] {
+		case "eth_subscribe":
+			id := fmt.Sprintf("0x%d", conn.index)
+			conn.Respond(request, id)
+			conn.Notify(id, fmt.Sprintf("0x%064x", conn.index))
+
+			// The first connection is lost right after its first event
+			if conn.index == 1 {
+				conn.Close()
+			}
+		case "eth_blockNumber":
+			conn.Respond(request, "0x10")
+		}
+	})
+	defer server.Close()
+
+	client := NewWebSocketClient(server.URL, WithReconnectDelay(time.Millisecond, 10*time.Millisecond))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hashes := make(chan eth.Hash)
+	subscription, err := client.SubscribeNewPendingTransactions(ctx, hashes)
+	require.NoError(t, err)
+
+	assert.Equal(t, fmt.Sprintf("%064x", 1), (<-hashes).String())
+	assert.Equal(t, fmt.Sprintf("%064x", 2), (<-hashes).String())
+	assert.Equal(t, 2, server.Count("eth_subscribe"))
+
+	result, err := client.DoRequest(ctx, "eth_blockNumber", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "0x10", result)
+
+	require.NoError(t, client.Close())
+	assert.Equal(t, ErrClientClosed, <-subscription.Err())
+}
+
+func TestWebSocketClient_KeepAlive(t *testing.T) {
+	unresponsive := make(chan struct{})
+	defer close(unresponsive)
+
+	server := mockWebSocket(t, func(conn *mockWebSocketConn, request map[string]interface{}) {
+		id := fmt.Sprintf("0x%d", conn.index)
+		conn.Respond(request, id)
+
+		// The first connection stops answering anything, pings included, once subscribed
+		if conn.index == 1 {
+			<-unresponsive
+			return
+		}
+		conn.Notify(id, fmt.Sprintf("0x%064x", conn.index))
+	})
+	defer server.Close()
+
+	client := NewWebSocketClient(server.URL, WithReconnectDelay(time.Millisecond, 10*time.Millisecond), WithKeepAlive(10*time.Millisecond, 50*time.Millisecond))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hashes := make(chan eth.Hash)
+	_, err := client.SubscribeNewPendingTransactions(ctx, hashes)
+	require.NoError(t, err)
+
+	select {
+	case hash := <-hashes:
+		assert.Equal(t, fmt.Sprintf("%064x", 2), hash.String())
+	case <-ctx.Done():
+		require.FailNow(t, "unresponsive connection not dropped")
+	}
+	assert.Equal(t, 2, server.Count("eth_subscribe"))
+}
+
+func TestWebSocketClient_WriteTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	defer close(stalled)
+
+	server := mockWebSocket(t, func(conn *mockWebSocketConn, request map[string]interface{}) {
+		// The node stops reading after the first request, the client's writes end up blocked
+		<-stalled
+	})
+	defer server.Close()
+
+	client := NewWebSocketClient(server.URL, WithKeepAlive(0, 200*time.Millisecond))
+	defer client.Close()
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := client.DoRequest(context.Background(), "eth_blockNumber", nil)
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return server.Count("eth_blockNumber") == 1 }, time.Second, time.Millisecond)
+
+	go func() {
+		_, err := client.DoRequest(context.Background(), "eth_call", []interface{}{strings.Repeat("0", 64*1024*1024)})
+		done <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			assert.Error(t, err)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "request to a stalled node not failed")
+		}
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- client.Close() }()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "client close blocked")
+	}
+}
+
+func TestWebSocketClient_Error(t *testing.T) {
+	server := mockWebSocket(t, func(conn *mockWebSocketConn, request map[string]interface{}) {
+		conn.Write(map[string]interface{}{"jsonrpc": "2.0", "id": request["id"], "error": map[string]interface{}{"code": -32601, "message": "notifications not supported"}})
+	})
+	defer server.Close()
+
+	client := NewWebSocketClient(server.URL)
+	defer client.Close()
+
+	_, err := client.SubscribeNewHeads(context.Background(), make(chan *Block))
+	assert.Equal(t, fmt.Errorf("subscribe newHeads: %w", &ErrResponse{Code: -32601, Message: "notifications not supported"}), err)
+}
+
+type mockWebSocketServer struct {
+	*httptest.Server
+	URL string
+
+	lock   sync.Mutex
+	params map[string][]interface{}
+	counts map[string]int
+}
+
+type mockWebSocketConn struct {
+	*wsConn
+	t     *testing.T
+	index int
+}
+
+func (c *mockWebSocketConn) Write(message interface{}) {
+	data, err := json.Marshal(message)
+	require.NoError(c.t, err)
+
+	c.WriteMessage(context.Background(), data)
+}
+
+func (c *mockWebSocketConn) Respond(request map[string]interface{}, result interface{}) {
+	c.Write(map[string]interface{}{"jsonrpc": "2.0", "id": request["id"], "result": result})
+}
+
+func (c *mockWebSocketConn) Notify(subscription string, result interface{}) {
+	c.Write(map[string]interface{}{"jsonrpc": "2.0", "method": "eth_subscription", "params": map[string]interface{}{"subscription": subscription, "result": result}})
+}
+
+func (s *mockWebSocketServer) Params(method string) []interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.params[method]
+}
+
+func (s *mockWebSocketServer) Count(method string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.counts[method]
+}
+
+// mockWebSocket starts a WebSocket server calling `handle` for each request received, `conn.index` is
+// the 1-based index of the connection the request was received on.
+func mockWebSocket(t *testing.T, handle func(conn *mockWebSocketConn, request map[string]interface{})) *mockWebSocketServer {
+	mock := &mockWebSocketServer{
+		params: map[string][]interface{}{},
+		counts: map[string]int{},
+	}
+
+	var connCount int
+	mock.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		raw, buffer, err := rw.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+
+		buffer.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		buffer.WriteString("Sec-WebSocket-Accept: " + wsAcceptKey(req.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		require.NoError(t, buffer.Flush())
+
+		mock.lock.Lock()
+		connCount++
+		conn := &mockWebSocketConn{wsConn: &wsConn{conn: raw, reader: buffer.Reader}, t: t, index: connCount}
+		mock.lock.Unlock()
+
+		for {
+			data, err := conn.ReadMessage()
+			if err != nil {
+				raw.Close()
+				return
+			}
+
+			var request map[string]interface{}
+			require.NoError(t, json.Unmarshal(data, &request))
+
+			method, _ := request["method"].(string)
+			params, _ := request["params"].([]interface{})
+
+			mock.lock.Lock()
+			mock.params[method] = params
+			mock.counts[method]++
+			mock.lock.Unlock()
+
+			handle(conn, request)
+		}
+	}))
+	mock.URL = "ws://" + strings.TrimPrefix(mock.Server.URL, "http://")
+
+	return mock
+}
@@ -32,3 +32,15 @@ type Signer interface {
 	// return them.
 	TransactionSignature(nonce uint64, toAddress []byte, value *big.Int, gasLimit uint64, gasPrice *big.Int, transactionData []byte) (r, s, v *big.Int, err error)
 }
+
+// DynamicFeeSigner is implemented by signers that are able to sign EIP-1559 dynamic fee transactions (transaction
+// type `0x02`). It's an optional extension of Signer, callers are expected to type assert a Signer to find out if
+// dynamic fee transactions are supported.
+//
+// **Important** This interface might change at any time to adjust to new Ethereum rules.
+type DynamicFeeSigner interface {
+	// SignDynamicFeeTransaction generates the right payload for signing an EIP-1559 transaction, perform the signing operation
+	// and returns the typed transaction envelope (`0x02 || rlp([chainId, nonce, maxPriorityFeePerGas, maxFeePerGas, gasLimit, to, value, data, accessList, yParity, r, s])`)
+	// ready to be sent through `eth_sendRawTransaction`.
+	SignDynamicFeeTransaction(nonce uint64, toAddress []byte, value *big.Int, gasLimit uint64, maxFeePerGas *big.Int, maxPriorityFeePerGas *big.Int, transactionData []byte) (signedEncodedTrx []byte, err error)
+}
@@ -127,3 +127,66 @@ func (p *PrivateKeySigner) TransactionSignature(nonce uint64, to []byte, value *
 
 	return v, r, s, nil
 }
+
+// ChainID returns the chain ID this signer has been configured with, it's the one used in EIP-155
+// replay protection as well as in EIP-1559 transaction payload.
+func (p *PrivateKeySigner) ChainID() *big.Int {
+	return p.chainID
+}
+
+// dynamicFeeTxType is the EIP-2718 transaction type of EIP-1559 transactions.
+const dynamicFeeTxType = 0x02
+
+func (p *PrivateKeySigner) SignDynamicFeeTransaction(nonce uint64, to []byte, value *big.Int, gasLimit uint64, maxFeePerGas *big.Int, maxPriorityFeePerGas *big.Int, trxData []byte) (signedEncodedTrx []byte, err error) {
+	p.logger.Debug("signing dynamic fee transaction",
+		zap.Uint64("nonce", nonce),
+		zap.Stringer("to", eth.Address(to)),
+		zap.Stringer("value", value),
+		zap.Uint64("gas_limit", gasLimit),
+		zap.Stringer("max_fee_per_gas", maxFeePerGas),
+		zap.Stringer("max_priority_fee_per_gas", maxPriorityFeePerGas),
+		zap.Stringer("trx_data", eth.Hex(trxData)),
+		zap.Stringer("chain_id", p.chainID),
+	)
+
+	// We do not support access list for now, so it's always encoded as an empty list
+	fields := []interface{}{
+		p.chainID,
+		nonce,
+		maxPriorityFeePerGas,
+		maxFeePerGas,
+		gasLimit,
+		to,
+		value,
+		trxData,
+		[]interface{}{},
+	}
+
+	data, err := rlp.Encode(fields)
+	if err != nil {
+		return nil, fmt.Errorf("rlp encode: %w", err)
+	}
+
+	hash := eth.Keccak256(append([]byte{dynamicFeeTxType}, data...))
+	signature, err := p.privateKey.Sign(hash)
+	if err != nil {
+		return nil, fmt.Errorf("sign compact: %w", err)
+	}
+
+	// Typed transactions uses the parity of Y directly (0 or 1) instead of the EIP-155 `v` value,
+	// btcec gives us 27 when parity is 0 and 28 when parity is 1.
+	yParity := uint64(signature.V() - 27)
+
+	p.logger.Debug("signed dynamic fee transaction signature",
+		zap.Uint64("y_parity", yParity),
+		zap.Stringer("r", signature.R()),
+		zap.Stringer("s", signature.S()),
+	)
+
+	data, err = rlp.Encode(append(fields, yParity, signature.R(), signature.S()))
+	if err != nil {
+		return nil, fmt.Errorf("rlp signed encode: %w", err)
+	}
+
+	return append([]byte{dynamicFeeTxType}, data...), nil
+}
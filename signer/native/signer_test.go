@@ -183,3 +183,44 @@ func bigString(t *testing.T, value string) *big.Int {
 
 	return out
 }
+
+func TestSigner_SignDynamicFeeTransaction(t *testing.T) {
+	tests := []struct {
+		name                 string
+		in                   trx
+		maxFeePerGas         *big.Int
+		maxPriorityFeePerGas *big.Int
+		privateKey           string
+		expected             string
+		expectedErr          error
+	}{
+		{
+			"transfer",
+			trx{9, nil, 21000, eth.MustNewAddress("0x3535353535353535353535353535353535353535"), b1e18, nil, b1},
+			bigString(t, "30000000000"),
+			bigString(t, "2000000000"),
+			"4646464646464646464646464646464646464646464646464646464646464646",
+			"02f873010984773594008506fc23ac00825208943535353535353535353535353535353535353535880de0b6b3a764000080c080a02b03b67e070f45175ce9d07c4512720168bd468a24edb6997977a53d48c87a12a0733d775fdd689d306e08ac8ab399f34b5a0253b47ed81b8bf2d2a6ea607fcac7",
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			priv, err := eth.NewPrivateKey(test.privateKey)
+			require.NoError(t, err)
+
+			signer, err := NewPrivateKeySigner(zlog, test.in.chainID, priv)
+			require.NoError(t, err)
+
+			actual, err := signer.SignDynamicFeeTransaction(test.in.nonce, test.in.to, test.in.value, test.in.gasLimit, test.maxFeePerGas, test.maxPriorityFeePerGas, test.in.input)
+
+			if test.expectedErr == nil {
+				require.NoError(t, err)
+				assert.Equal(t, test.expected, hex.EncodeToString(actual))
+			} else {
+				assert.Equal(t, test.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trie
+
+// keyToNibbles splits a key in nibbles (half bytes) and appends the terminator.
+func keyToNibbles(key []byte) []byte {
+	nibbles := make([]byte, len(key)*2+1)
+	for i, b := range key {
+		nibbles[i*2] = b / 16
+		nibbles[i*2+1] = b % 16
+	}
+	nibbles[len(nibbles)-1] = terminator
+
+	return nibbles
+}
+
+// nibblesToCompact applies the hex-prefix encoding to nibbles, the first nibble of the output
+// flags whether the path is odd and whether it ends with the terminator (leaf nodes).
+func nibblesToCompact(nibbles []byte) []byte {
+	var flags byte
+	if len(nibbles) > 0 && nibbles[len(nibbles)-1] == terminator {
+		flags = 1 << 5
+		nibbles = nibbles[:len(nibbles)-1]
+	}
+
+	out := make([]byte, len(nibbles)/2+1)
+	if len(nibbles)%2 == 1 {
+		flags |= 1<<4 | nibbles[0]
+		nibbles = nibbles[1:]
+	}
+	out[0] = flags
+
+	for i := 0; i < len(nibbles); i += 2 {
+		out[i/2+1] = nibbles[i]<<4 | nibbles[i+1]
+	}
+
+	return out
+}
+
+// compactToNibbles reverses `nibblesToCompact`.
+func compactToNibbles(compact []byte) []byte {
+	if len(compact) == 0 {
+		return nil
+	}
+
+	nibbles := keyToNibbles(compact)
+	flags := nibbles[0]
+
+	// Extension nodes have no terminator
+	if flags&2 == 0 {
+		nibbles = nibbles[:len(nibbles)-1]
+	}
+
+	// Skips the flags nibble, as well as the padding nibble of even paths
+	if flags&1 == 1 {
+		return nibbles[1:]
+	}
+
+	return nibbles[2:]
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/eth-go/rlp"
+)
+
+var ErrInvalidProof = errors.New("invalid proof")
+
+// VerifyProof checks the Merkle proof of `key` against the trie root `root` and returns the value
+// the proof shows for the key, `nil` when the proof shows the key is not in the trie. The proof
+// nodes can be in any order, an error wrapping `ErrInvalidProof` is returned if the proof does not
+// lead from the root to the key's value or absence.
+func VerifyProof(root eth.Hash, key []byte, proof [][]byte) (value []byte, err error) {
+	nodes := make(map[string][]byte, len(proof))
+	for _, encoded := range proof {
+		nodes[string(eth.Keccak256(encoded))] = encoded
+	}
+
+	path := keyToNibbles(key)
+	wantedHash := root
+	for depth := 0; ; depth++ {
+		encoded, found := nodes[string(wantedHash)]
+		if !found {
+			if depth == 0 && bytes.Equal(root, EmptyRoot) {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("node %s at depth %d is missing: %w", wantedHash.Pretty(), depth, ErrInvalidProof)
+		}
+
+		var next []byte
+		value, next, path, err = walkNode(encoded, path)
+		if err != nil {
+			return nil, fmt.Errorf("node %s at depth %d: %w", wantedHash.Pretty(), depth, err)
+		}
+
+		if next == nil {
+			return value, nil
+		}
+
+		wantedHash = eth.Hash(next)
+	}
+}
+
+// walkNode follows `path` through the encoded node and its embedded children. It returns the value
+// found at the end of the path, or `nil, nil` if the path leads nowhere, or the hash of the next node
+// to follow along with the remaining path.
+func walkNode(encoded []byte, path []byte) (value []byte, nextHash []byte, remaining []byte, err error) {
+	for {
+		elements, _, err := rlp.SplitList(encoded)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("decode node: %s: %w", err, ErrInvalidProof)
+		}
+
+		var child rlp.RawValue
+		switch len(elements) {
+		case 2:
+			compactKey, _, err := rlp.SplitString(elements[0])
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("decode short node key: %s: %w", err, ErrInvalidProof)
+			}
+
+			key := compactToNibbles(compactKey)
+			if len(key) == 0 {
+				return nil, nil, nil, fmt.Errorf("short node with empty key: %w", ErrInvalidProof)
+			}
+
+			if !bytes.HasPrefix(path, key) {
+				return nil, nil, nil, nil
+			}
+
+			path = path[len(key):]
+			if key[len(key)-1] == terminator {
+				return stringValue(elements[1])
+			}
+
+			child = elements[1]
+
+		case 17:
+			if path[0] == terminator {
+				return stringValue(elements[terminator])
+			}
+
+			child = elements[path[0]]
+			path = path[1:]
+
+		default:
+			return nil, nil, nil, fmt.Errorf("node has %d elements: %w", len(elements), ErrInvalidProof)
+		}
+
+		kind, content, _, err := rlp.Split(child)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("decode child reference: %s: %w", err, ErrInvalidProof)
+		}
+
+		switch {
+		case kind == rlp.KindList:
+			// Embedded child node, we keep walking within the same proof node
+			encoded = child
+		case len(content) == 0:
+			return nil, nil, nil, nil
+		case len(content) == 32:
+			return nil, content, path, nil
+		default:
+			return nil, nil, nil, fmt.Errorf("child reference of %d bytes: %w", len(content), ErrInvalidProof)
+		}
+	}
+}
+
+func stringValue(encoded rlp.RawValue) (value []byte, nextHash []byte, remaining []byte, err error) {
+	value, _, err = rlp.SplitString(encoded)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("decode value: %s: %w", err, ErrInvalidProof)
+	}
+
+	if len(value) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	return value, nil, nil, nil
+}
@@ -0,0 +1,241 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trie implements an in-memory Merkle Patricia Trie, the structure used by Ethereum
+// to commit to the state, the transactions and the receipts of a block, as well as the
+// verification of the Merkle proofs served by nodes.
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/eth-go/rlp"
+)
+
+// EmptyRoot is the root hash of an empty trie.
+var EmptyRoot = eth.MustNewHash("0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+// terminator is the nibble appended to keys to flag the end of a key, it's also the index
+// of the value slot of branch nodes.
+const terminator = 16
+
+type node interface{}
+
+type (
+	// branchNode has a child per nibble, the 17th slot holds the value of the key ending at it.
+	branchNode struct {
+		children [17]node
+	}
+
+	// shortNode is either an extension node, when `key` is a path leading to a branch node, or a
+	// leaf node, when `key` ends with the terminator and `value` is a `valueNode`.
+	shortNode struct {
+		key   []byte
+		value node
+	}
+
+	valueNode []byte
+)
+
+// Trie is an in-memory Merkle Patricia Trie, it's not safe for concurrent use.
+type Trie struct {
+	root node
+}
+
+func New() *Trie {
+	return &Trie{}
+}
+
+// DeriveListRoot computes the root of the trie mapping the RLP encoded index of each value to
+// the value, which is how the transactions, receipts and withdrawals roots of a block are computed.
+func DeriveListRoot(values [][]byte) (eth.Hash, error) {
+	trie := New()
+	for i, value := range values {
+		key, err := rlp.Encode(uint64(i))
+		if err != nil {
+			return nil, fmt.Errorf("encode key #%d: %w", i, err)
+		}
+
+		if err := trie.Put(key, value); err != nil {
+			return nil, fmt.Errorf("put value #%d: %w", i, err)
+		}
+	}
+
+	return trie.Hash(), nil
+}
+
+// Put inserts or replaces the value associated with `key`, empty values are not accepted as
+// they are indistinguishable from a missing key in the trie.
+func (t *Trie) Put(key, value []byte) error {
+	if len(value) == 0 {
+		return errors.New("empty value")
+	}
+
+	t.root = insert(t.root, keyToNibbles(key), valueNode(append([]byte{}, value...)))
+	return nil
+}
+
+// Get returns the value associated with `key`, `ok` is `false` if the key is not in the trie.
+func (t *Trie) Get(key []byte) (value []byte, ok bool) {
+	n := t.root
+	path := keyToNibbles(key)
+
+	for {
+		switch current := n.(type) {
+		case nil:
+			return nil, false
+		case valueNode:
+			return append([]byte{}, current...), true
+		case *shortNode:
+			if !bytes.HasPrefix(path, current.key) {
+				return nil, false
+			}
+
+			path = path[len(current.key):]
+			n = current.value
+		case *branchNode:
+			n = current.children[path[0]]
+			path = path[1:]
+		}
+	}
+}
+
+// Hash returns the root hash of the trie.
+func (t *Trie) Hash() eth.Hash {
+	if t.root == nil {
+		return append(eth.Hash{}, EmptyRoot...)
+	}
+
+	return eth.Keccak256(encodeNode(t.root))
+}
+
+// Prove returns the Merkle proof of `key`, the RLP encoded nodes on the path from the root to the
+// key. Nodes small enough to be embedded in their parent are not part of the proof. When the key
+// is not in the trie, the proof shows its absence, see `VerifyProof`.
+func (t *Trie) Prove(key []byte) (proof [][]byte) {
+	path := keyToNibbles(key)
+
+	for n := t.root; n != nil; {
+		if _, isValue := n.(valueNode); isValue {
+			break
+		}
+
+		encoded := encodeNode(n)
+		if n == t.root || len(encoded) >= 32 {
+			proof = append(proof, encoded)
+		}
+
+		switch current := n.(type) {
+		case *shortNode:
+			if !bytes.HasPrefix(path, current.key) {
+				return proof
+			}
+
+			path = path[len(current.key):]
+			n = current.value
+		case *branchNode:
+			n = current.children[path[0]]
+			path = path[1:]
+		}
+	}
+
+	return proof
+}
+
+func insert(n node, path []byte, value node) node {
+	if len(path) == 0 {
+		return value
+	}
+
+	switch current := n.(type) {
+	case nil:
+		return &shortNode{key: path, value: value}
+
+	case *shortNode:
+		match := commonPrefixLength(path, current.key)
+		if match == len(current.key) {
+			return &shortNode{key: current.key, value: insert(current.value, path[match:], value)}
+		}
+
+		// The paths diverge, a branch node is added where they do with each of them as children
+		branch := &branchNode{}
+		branch.children[current.key[match]] = insert(nil, current.key[match+1:], current.value)
+		branch.children[path[match]] = insert(nil, path[match+1:], value)
+		if match == 0 {
+			return branch
+		}
+
+		return &shortNode{key: path[:match], value: branch}
+
+	case *branchNode:
+		branch := *current
+		branch.children[path[0]] = insert(branch.children[path[0]], path[1:], value)
+		return &branch
+
+	default:
+		panic(fmt.Errorf("unexpected node type %T at non-empty path", n))
+	}
+}
+
+// encodeNode returns the RLP encoding of a node, children are referenced by the hash of their
+// encoding, unless it's shorter than 32 bytes in which case they are embedded as-is.
+func encodeNode(n node) []byte {
+	var fields []interface{}
+
+	switch current := n.(type) {
+	case *shortNode:
+		fields = []interface{}{nibblesToCompact(current.key), reference(current.value)}
+	case *branchNode:
+		fields = make([]interface{}, 17)
+		for i, child := range current.children {
+			fields[i] = reference(child)
+		}
+	default:
+		panic(fmt.Errorf("unexpected node type %T to encode", n))
+	}
+
+	encoded, err := rlp.Encode(fields)
+	if err != nil {
+		// Only byte strings and raw values are encoded, which can't fail
+		panic(fmt.Errorf("encode trie node: %w", err))
+	}
+
+	return encoded
+}
+
+func reference(n node) interface{} {
+	switch current := n.(type) {
+	case nil:
+		return []byte{}
+	case valueNode:
+		return []byte(current)
+	}
+
+	encoded := encodeNode(n)
+	if len(encoded) < 32 {
+		return rlp.RawValue(encoded)
+	}
+
+	return []byte(eth.Keccak256(encoded))
+}
+
+func commonPrefixLength(left, right []byte) (i int) {
+	for i < len(left) && i < len(right) && left[i] == right[i] {
+		i++
+	}
+	return
+}
@@ -0,0 +1,165 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/streamingfast/eth-go"
+	"github.com/streamingfast/eth-go/rlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrie_Hash(t *testing.T) {
+	assert.Equal(t, EmptyRoot, New().Hash())
+
+	trie := New()
+	for _, kv := range [][2]string{{"do", "verb"}, {"dog", "puppy"}, {"doge", "coin"}, {"horse", "stallion"}} {
+		require.NoError(t, trie.Put([]byte(kv[0]), []byte(kv[1])))
+	}
+
+	assert.Equal(t, eth.MustNewHash("0x5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84"), trie.Hash())
+
+	require.NoError(t, trie.Put([]byte("dog"), []byte("hound")))
+	require.NoError(t, trie.Put([]byte("dog"), []byte("puppy")))
+	assert.Equal(t, eth.MustNewHash("0x5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84"), trie.Hash())
+
+	assert.Error(t, trie.Put([]byte("cat"), nil))
+}
+
+func TestDeriveListRoot(t *testing.T) {
+	tests := []struct {
+		count    int
+		expected string
+	}{
+		{0, "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"},
+		{1, "0x77294110514da1760764c520e5110b8821b25fe74f074e677851666e718b3535"},
+		{3, "0x8e00c9f0530675fa9a88e4ef623013dce593fcd6afe3ca42fc5955f1bc2e9b9c"},
+		{130, "0x4ddd6f7227185a327bf09fa9ba8e6a67e3b61ca72e2bef85de69c6fe7b0bc356"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d values", test.count), func(t *testing.T) {
+			root, err := DeriveListRoot(testListValues(test.count))
+			require.NoError(t, err)
+
+			assert.Equal(t, eth.MustNewHash(test.expected), root)
+		})
+	}
+}
+
+func TestTrie_Get(t *testing.T) {
+	trie := New()
+	values := testListValues(130)
+	for i, value := range values {
+		require.NoError(t, trie.Put(testListKey(i), value))
+	}
+
+	for i, value := range values {
+		actual, ok := trie.Get(testListKey(i))
+		require.True(t, ok)
+		assert.Equal(t, value, actual)
+	}
+
+	_, ok := trie.Get(testListKey(130))
+	assert.False(t, ok)
+
+	_, ok = trie.Get([]byte("unknown"))
+	assert.False(t, ok)
+}
+
+func TestTrie_Prove(t *testing.T) {
+	trie := New()
+	values := testListValues(130)
+	for i, value := range values {
+		require.NoError(t, trie.Put(testListKey(i), value))
+	}
+	root := trie.Hash()
+
+	for _, i := range []int{0, 1, 15, 16, 77, 128, 129} {
+		proof := trie.Prove(testListKey(i))
+
+		value, err := VerifyProof(root, testListKey(i), proof)
+		require.NoError(t, err)
+		assert.Equal(t, values[i], value, "value #%d", i)
+	}
+
+	for _, key := range [][]byte{testListKey(130), testListKey(5000), []byte("unknown")} {
+		value, err := VerifyProof(root, key, trie.Prove(key))
+		require.NoError(t, err)
+		assert.Nil(t, value)
+	}
+
+	proof := trie.Prove(testListKey(77))
+	proof[len(proof)-1] = append([]byte{}, proof[len(proof)-1]...)
+	proof[len(proof)-1][len(proof[len(proof)-1])-1] ^= 0xff
+	_, err := VerifyProof(root, testListKey(77), proof)
+	assert.ErrorIs(t, err, ErrInvalidProof)
+
+	_, err = VerifyProof(root, testListKey(77), nil)
+	assert.ErrorIs(t, err, ErrInvalidProof)
+
+	value, err := VerifyProof(EmptyRoot, testListKey(77), nil)
+	require.NoError(t, err)
+	assert.Nil(t, value)
+}
+
+func TestVerifyProof_Geth(t *testing.T) {
+	// Proof generated by go-ethereum for key #77 of the 130 values list, nodes are in hash order
+	proof := [][]byte{
+		eth.MustNewHex("0xf90131a004884482858ac1889ab570091d19d5621e75e74a877fd4bf5b1b834f4de9e9b6a0fab2fa2851a898738ace316e270f3a9aeb78725ea68635e4d6bdc83557bd3615a04667aab3f3b00e7671821dbf8f91ae2bb523c2ace04b8d65fa3a2a5505f8766ca0f60c1a6d40bdbe0b1262037096061bd83622d047b5d3677fb3735e6f20e1b4bba0b03e200641b576f3c2df58dcaa5bc3758bb15e0d3cdab7c72ba2ddd43dfa79a5a04ccb05358af87632180c02d82b9954e97d4c4151a4cc997fd0483cfeae14abfda09576f9e611ba22aecb2cff942a07cb2cbb9a531f1e5933361db1b86606ff5157a07b987bf485f3f359da324836a8e7910e4d452722f178fc13bf742d84804badd5a0a87d60ae8e1e7eeef090615b5462717bb845181c076de0661384bb2450c81f9f8080808080808080"),
+		eth.MustNewHex("0xf8b8c22050c420823fedc52083afd628c620845baabe78c7208574bf64a458c82086c3d529168d50c920876766986ba5dd22ca20883f62601b8b8ff522cb20890df4d529a32617376dcc208a27be1df4bc2d5cb10b8ccd208bf19a18ba7e9f8726bf2575ce208ce1bbcf1439daca86d215dfcacf208d58dc40d7a9e48589548f9d4857d0208e0c0ccf3a2eb8aa2508fb6151e7f5d1208fcb4478b35c660780cd19b8ef13bc11d220909f9f4e05896df536be8728270ddebf5c80"),
+	}
+
+	value, err := VerifyProof(eth.MustNewHash("0x4ddd6f7227185a327bf09fa9ba8e6a67e3b61ca72e2bef85de69c6fe7b0bc356"), testListKey(77), proof)
+	require.NoError(t, err)
+	assert.Equal(t, testListValues(78)[77], value)
+}
+
+func TestCompactEncoding(t *testing.T) {
+	tests := []struct {
+		nibbles []byte
+		compact []byte
+	}{
+		{[]byte{}, []byte{0x00}},
+		{[]byte{terminator}, []byte{0x20}},
+		{[]byte{1, 2, 3, 4, 5}, []byte{0x11, 0x23, 0x45}},
+		{[]byte{0, 1, 2, 3, 4, 5}, []byte{0x00, 0x01, 0x23, 0x45}},
+		{[]byte{0, 15, 1, 12, 11, 8, terminator}, []byte{0x20, 0x0f, 0x1c, 0xb8}},
+		{[]byte{15, 1, 12, 11, 8, terminator}, []byte{0x3f, 0x1c, 0xb8}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.compact, nibblesToCompact(test.nibbles), "compact of %v", test.nibbles)
+		assert.Equal(t, test.nibbles, compactToNibbles(test.compact), "nibbles of %x", test.compact)
+	}
+}
+
+func testListKey(i int) []byte {
+	key, err := rlp.Encode(uint64(i))
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func testListValues(count int) (out [][]byte) {
+	for i := 0; i < count; i++ {
+		out = append(out, eth.Keccak256([]byte(fmt.Sprintf("value-%d", i)))[:1+i%32])
+	}
+	return
+}
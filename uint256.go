@@ -0,0 +1,222 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var (
+	maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	maxInt256  = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1))
+	minInt256  = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 255))
+)
+
+// Uint256 is an unsigned 256 bits integer backed by a `big.Int`, it's able to read
+// JSON-RPC quantities like `"0x8792c6f47f70f"` (as well as decimal strings and JSON
+// numbers) and is written back as a JSON-RPC quantity.
+//
+// Use it through a pointer, `*Uint256`, so that absent JSON values can be detected. The
+// arithmetic methods never modify their receiver and report when the result does not
+// fit in 256 bits, in which case the result is wrapped around like the EVM does.
+type Uint256 big.Int
+
+// NewUint256 returns a copy of `value` as a `Uint256`, it's the caller's responsibility to
+// ensure `value` fits in 256 bits, use `NewUint256FromBig` when unsure.
+func NewUint256(value *big.Int) *Uint256 {
+	return (*Uint256)(new(big.Int).Set(value))
+}
+
+// NewUint256FromBig returns a copy of `value` as a `Uint256`, failing if it's negative or
+// overflows 256 bits.
+func NewUint256FromBig(value *big.Int) (*Uint256, error) {
+	if value.Sign() < 0 {
+		return nil, fmt.Errorf("invalid uint256 number %s: negative", value)
+	}
+
+	if value.BitLen() > 256 {
+		return nil, fmt.Errorf("invalid uint256 number %s: overflows 256 bits", value)
+	}
+
+	return NewUint256(value), nil
+}
+
+func NewUint256FromUint64(value uint64) *Uint256 {
+	return (*Uint256)(new(big.Int).SetUint64(value))
+}
+
+// ParseUint256 parses a hexadecimal (`0x` prefixed) or decimal string into a `Uint256`.
+func ParseUint256(text string) (*Uint256, error) {
+	value, err := parseUint256(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*Uint256)(value), nil
+}
+
+// MustParseUint256 is like `ParseUint256` but panics on error.
+func MustParseUint256(text string) *Uint256 {
+	value, err := ParseUint256(text)
+	if err != nil {
+		panic(err)
+	}
+
+	return value
+}
+
+// Int returns a copy of the value as a `big.Int`, `nil` if the receiver is `nil`.
+func (u *Uint256) Int() *big.Int {
+	if u == nil {
+		return nil
+	}
+
+	return new(big.Int).Set((*big.Int)(u))
+}
+
+// Uint64 returns the value as an `uint64`, `ok` is `false` if it does not fit in 64 bits.
+func (u *Uint256) Uint64() (value uint64, ok bool) {
+	v := (*big.Int)(u)
+	return v.Uint64(), v.IsUint64()
+}
+
+func (u *Uint256) IsZero() bool {
+	return (*big.Int)(u).Sign() == 0
+}
+
+// Cmp compares `u` and `other` and returns -1, 0 or +1 like `big.Int.Cmp`.
+func (u *Uint256) Cmp(other *Uint256) int {
+	return (*big.Int)(u).Cmp((*big.Int)(other))
+}
+
+// Add returns `u + other`, `overflow` is `true` if the sum overflowed 256 bits.
+func (u *Uint256) Add(other *Uint256) (out *Uint256, overflow bool) {
+	return wrapUint256(new(big.Int).Add((*big.Int)(u), (*big.Int)(other)))
+}
+
+// Sub returns `u - other`, `overflow` is `true` if `other` is greater than `u`.
+func (u *Uint256) Sub(other *Uint256) (out *Uint256, overflow bool) {
+	return wrapUint256(new(big.Int).Sub((*big.Int)(u), (*big.Int)(other)))
+}
+
+// Mul returns `u * other`, `overflow` is `true` if the product overflowed 256 bits.
+func (u *Uint256) Mul(other *Uint256) (out *Uint256, overflow bool) {
+	return wrapUint256(new(big.Int).Mul((*big.Int)(u), (*big.Int)(other)))
+}
+
+// Div returns `u / other` rounded down, division by zero returns zero like the EVM does.
+func (u *Uint256) Div(other *Uint256) *Uint256 {
+	if other.IsZero() {
+		return new(Uint256)
+	}
+
+	return (*Uint256)(new(big.Int).Div((*big.Int)(u), (*big.Int)(other)))
+}
+
+// Mod returns `u % other`, modulo zero returns zero like the EVM does.
+func (u *Uint256) Mod(other *Uint256) *Uint256 {
+	if other.IsZero() {
+		return new(Uint256)
+	}
+
+	return (*Uint256)(new(big.Int).Mod((*big.Int)(u), (*big.Int)(other)))
+}
+
+func wrapUint256(value *big.Int) (out *Uint256, overflow bool) {
+	if value.Sign() >= 0 && value.BitLen() <= 256 {
+		return (*Uint256)(value), false
+	}
+
+	// Mod being an Euclidean modulus, negative values wrap around to positive ones
+	return (*Uint256)(value.Mod(value, new(big.Int).Add(maxUint256, big.NewInt(1)))), true
+}
+
+// Bytes32 returns the big-endian 32 bytes representation of the value.
+func (u *Uint256) Bytes32() (out [32]byte) {
+	(*big.Int)(u).FillBytes(out[:])
+	return
+}
+
+func (u *Uint256) String() string {
+	if u == nil {
+		return "<nil>"
+	}
+
+	return (*big.Int)(u).String()
+}
+
+func (u *Uint256) MarshalText() ([]byte, error) {
+	return []byte("0x" + (*big.Int)(u).Text(16)), nil
+}
+
+func (u *Uint256) MarshalJSONRPC() ([]byte, error) {
+	return []byte(`"0x` + (*big.Int)(u).Text(16) + `"`), nil
+}
+
+func (u *Uint256) UnmarshalText(text []byte) error {
+	value, err := parseUint256(string(text))
+	if err != nil {
+		return err
+	}
+
+	*u = Uint256(*value)
+	return nil
+}
+
+// UnmarshalJSON accepts JSON strings as well as JSON numbers, which some nodes use for large
+// quantities like the total difficulty.
+func (u *Uint256) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	return u.UnmarshalText(bytes.Trim(data, `"`))
+}
+
+func parseUint256(text string) (*big.Int, error) {
+	value := new(big.Int)
+	if len(text) == 0 {
+		return value, nil
+	}
+
+	base := 10
+	if strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X") {
+		text = text[2:]
+		base = 16
+		if text == "" {
+			return value, nil
+		}
+	}
+
+	if _, ok := value.SetString(text, base); !ok {
+		if base == 16 {
+			return nil, fmt.Errorf("invalid hex uint256 number %q", text)
+		}
+		return nil, fmt.Errorf("invalid uint256 number %q", text)
+	}
+
+	if value.Sign() < 0 {
+		return nil, fmt.Errorf("invalid uint256 number %q: negative", text)
+	}
+
+	if value.BitLen() > 256 {
+		return nil, fmt.Errorf("invalid uint256 number %q: overflows 256 bits", text)
+	}
+
+	return value, nil
+}
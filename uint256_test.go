@@ -0,0 +1,185 @@
+// Copyright 2021 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUint256_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          string
+		expected    string
+		expectError bool
+	}{
+		{"hex", `"0x8792c6f47f70f"`, "2385031566194447", false},
+		{"decimal string", `"2385031566194447"`, "2385031566194447", false},
+		{"json number", `58750003716598352816469`, "58750003716598352816469", false},
+		{"empty hex", `"0x"`, "0", false},
+		{"max", `"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"`, maxUint256.String(), false},
+		{"overflow", `"0x10000000000000000000000000000000000000000000000000000000000000000"`, "", true},
+		{"negative", `"-1"`, "", true},
+		{"invalid", `"0xzz"`, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var actual *Uint256
+			err := json.Unmarshal([]byte(test.in), &actual)
+			if test.expectError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual.String())
+		})
+	}
+}
+
+func TestUint256_MarshalJSON(t *testing.T) {
+	out, err := json.Marshal(struct {
+		Value *Uint256 `json:"value"`
+		Zero  *Uint256 `json:"zero"`
+		Nil   *Uint256 `json:"nil"`
+	}{Value: NewUint256FromUint64(0x8792c6f47f70f), Zero: new(Uint256)})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"value":"0x8792c6f47f70f","zero":"0x0","nil":null}`, string(out))
+
+	rpcOut, err := NewUint256FromUint64(255).MarshalJSONRPC()
+	require.NoError(t, err)
+	assert.Equal(t, `"0xff"`, string(rpcOut))
+}
+
+func TestUint256_Arithmetic(t *testing.T) {
+	max := NewUint256(maxUint256)
+	one := NewUint256FromUint64(1)
+
+	sum, overflow := max.Add(one)
+	assert.True(t, overflow)
+	assert.True(t, sum.IsZero())
+
+	difference, overflow := new(Uint256).Sub(one)
+	assert.True(t, overflow)
+	assert.Equal(t, 0, difference.Cmp(max))
+
+	product, overflow := max.Mul(NewUint256FromUint64(2))
+	assert.True(t, overflow)
+	assert.Equal(t, maxUint256.String(), new(big.Int).Add(product.Int(), big.NewInt(1)).String())
+
+	product, overflow = NewUint256FromUint64(6).Mul(NewUint256FromUint64(7))
+	assert.False(t, overflow)
+	assert.Equal(t, "42", product.String())
+
+	assert.Equal(t, "3", NewUint256FromUint64(7).Div(NewUint256FromUint64(2)).String())
+	assert.Equal(t, "1", NewUint256FromUint64(7).Mod(NewUint256FromUint64(2)).String())
+	assert.True(t, NewUint256FromUint64(7).Div(new(Uint256)).IsZero())
+
+	value, ok := max.Uint64()
+	assert.False(t, ok)
+	assert.Equal(t, uint64(0xffffffffffffffff), value)
+
+	// Receiver must not be modified
+	assert.Equal(t, maxUint256.String(), max.String())
+}
+
+func TestNewUint256FromBig(t *testing.T) {
+	_, err := NewUint256FromBig(big.NewInt(-1))
+	assert.Error(t, err)
+
+	_, err = NewUint256FromBig(new(big.Int).Lsh(big.NewInt(1), 256))
+	assert.Error(t, err)
+
+	value, err := NewUint256FromBig(maxUint256)
+	require.NoError(t, err)
+	assert.Equal(t, [32]byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	}, value.Bytes32())
+}
+
+func TestInt256_JSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          string
+		expected    string
+		expectJSON  string
+		expectError bool
+	}{
+		{"positive hex", `"0x2a"`, "42", `"0x2a"`, false},
+		{"negative hex", `"-0x2a"`, "-42", `"-0x2a"`, false},
+		{"negative decimal", `"-42"`, "-42", `"-0x2a"`, false},
+		{"json number", `-42`, "-42", `"-0x2a"`, false},
+		{"min", `"-0x8000000000000000000000000000000000000000000000000000000000000000"`, minInt256.String(), `"-0x8000000000000000000000000000000000000000000000000000000000000000"`, false},
+		{"overflow", `"0x8000000000000000000000000000000000000000000000000000000000000000"`, "", "", true},
+		{"underflow", `"-0x8000000000000000000000000000000000000000000000000000000000000001"`, "", "", true},
+		{"double sign", `"--1"`, "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var actual *Int256
+			err := json.Unmarshal([]byte(test.in), &actual)
+			if test.expectError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual.String())
+
+			out, err := json.Marshal(actual)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectJSON, string(out))
+		})
+	}
+}
+
+func TestInt256_Arithmetic(t *testing.T) {
+	min := NewInt256(minInt256)
+	max := NewInt256(maxInt256)
+
+	sum, overflow := max.Add(NewInt256FromInt64(1))
+	assert.True(t, overflow)
+	assert.Equal(t, 0, sum.Cmp(min))
+
+	negated, overflow := min.Neg()
+	assert.True(t, overflow)
+	assert.Equal(t, 0, negated.Cmp(min))
+
+	difference, overflow := NewInt256FromInt64(-2).Sub(NewInt256FromInt64(40))
+	assert.False(t, overflow)
+	assert.Equal(t, "-42", difference.String())
+
+	quotient, overflow := NewInt256FromInt64(-7).Quo(NewInt256FromInt64(2))
+	assert.False(t, overflow)
+	assert.Equal(t, "-3", quotient.String())
+
+	quotient, overflow = min.Quo(NewInt256FromInt64(-1))
+	assert.True(t, overflow)
+	assert.Equal(t, 0, quotient.Cmp(min))
+
+	assert.Equal(t, [32]byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xd6,
+	}, NewInt256FromInt64(-42).Bytes32())
+}